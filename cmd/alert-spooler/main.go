@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +27,7 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	var configPath string
+	var configDir string
 	var inputGlobs multiFlag
 	var dbPath string
 	var dbFolder string
@@ -37,12 +40,41 @@ func main() {
 	var ccccCodesCSV string
 	var deleteAfterSend bool
 	var timeout time.Duration
+	var minFileAge time.Duration
+	var maxSendRate float64
+	var maxDBScan int
 	var deadman string
 	var once bool
+	var drain bool
+	var reprocessErrors bool
+	var reconcile bool
+	var requireSyslog bool
+	var failOnNoInputs bool
+	var lifecycleEvents bool
+	var follow string
+	var syslogMaxConns int
+	var syslogNetwork string
+	var syslogHostname string
+	var output string
+	var dryRun bool
+	var dryRunOut string
+	var seed bool
+	var flushOnly bool
+	var drainMax int
+	var maxIterations int
 	var pollInterval time.Duration
 	var replayFrom string
+	var replayDest string
+	var replayForce bool
+	var summary bool
+	var runSummary bool
+	var checkDB bool
+	var explainHash string
+	var summaryFrom string
+	var summaryTo string
 
 	flag.StringVar(&configPath, "config", "", "YAML config file path.")
+	flag.StringVar(&configDir, "config-dir", "", "Directory of *.yaml config fragments merged in lexical order (after --config, if both are set).")
 	flag.Var(&inputGlobs, "input-glob", "Input glob(s) for alert files. Can be repeated.")
 	flag.StringVar(&dbPath, "db", "spooler.db", "SQLite database path.")
 	flag.StringVar(&dbFolder, "db-folder", "", "Monthly rolling DB folder (overrides config.database.folder).")
@@ -55,9 +87,37 @@ func main() {
 	flag.StringVar(&ccccCodesCSV, "cccc", "", "Comma-separated CCCC codes list (e.g. ZBBB,ZGGG). Overrides config.")
 	flag.BoolVar(&deleteAfterSend, "delete-after-send", true, "Delete source files only after syslog send + DB insert succeed.")
 	flag.DurationVar(&timeout, "timeout", 0, "Overall timeout for one run (e.g. 30s, 2m).")
+	flag.DurationVar(&minFileAge, "min-file-age", 0, "Skip input files modified less than this long ago (e.g. 30s); later runs pick them up.")
 	flag.StringVar(&deadman, "deadman", "", "Deadman token/message. Required each run.")
 	flag.StringVar(&replayFrom, "replay-from", "", "Replay mode: resend archived events from this time (adds replay label). Formats: RFC3339 or '2006-01-02 15:04:05'.")
+	flag.BoolVar(&summary, "summary", false, "Print event counts by alert_type/alert_level/cccc from the DBs and exit (read-only).")
+	flag.StringVar(&replayDest, "replay-dest", "", "With --replay-from, replay only to this destination: primary, or a syslog_destinations name/addr.")
+	flag.BoolVar(&replayForce, "replay-force", false, "With --replay-from, also resend events already replayed to the same destination.")
+	flag.BoolVar(&runSummary, "run-summary", false, "Print one summary line (ingested/new/sent/err/deleted/maxlag) to stdout after each run.")
+	flag.StringVar(&summaryFrom, "summary-from", "", "Summary window start (same formats as --replay-from). Default: 24h ago.")
+	flag.StringVar(&summaryTo, "summary-to", "", "Summary window end (same formats as --replay-from). Default: now.")
+	flag.BoolVar(&checkDB, "check-db", false, "Print row counts, pending/stuck counts, archived_at range and size per DB (--db, or every monthly DB) and exit (read-only).")
+	flag.StringVar(&explainHash, "explain-hash", "", "Print the key text, normalized text and hash of each event in this file and exit (no DB or syslog).")
 	flag.BoolVar(&once, "once", true, "Run once and exit (default true for crontab).")
+	flag.BoolVar(&drain, "drain", false, "Process backlog (files + pending events) until empty, then exit. Overrides --once.")
+	flag.IntVar(&drainMax, "drain-max-iterations", 100, "Max sweeps in --drain mode before giving up (0 = no cap).")
+	flag.IntVar(&maxIterations, "max-iterations", 0, "With --once=false: exit cleanly after this many sweeps (0 = unlimited).")
+	flag.BoolVar(&dryRun, "dry-run", false, "Build events for new input files without sending, writing to the DB, or deleting files.")
+	flag.StringVar(&dryRunOut, "dry-run-out", "", "Write the would-be RFC5424 syslog lines to this file (implies --dry-run); gzipped if it ends in .gz.")
+	flag.BoolVar(&seed, "seed", false, "Record new input files as processed (archived, deleted/moved per config) without sending anything; for a backlog present at first deploy.")
+	flag.BoolVar(&flushOnly, "flush-only", false, "Skip scanning inputs: only resend pending events and delete fully sent files (deadman still sent). For outage recovery.")
+	flag.StringVar(&output, "output", "syslog", "Event sink: syslog (TCP to --syslog-addr) or journald (local systemd journal).")
+	flag.StringVar(&syslogHostname, "syslog-hostname", "", "HOSTNAME in the syslog header (default os.Hostname()).")
+	flag.StringVar(&syslogNetwork, "syslog-network", "tcp", "Syslog network: tcp, udp, unix or unixgram (--syslog-addr is then the socket path).")
+	flag.IntVar(&maxDBScan, "max-db-scan", 0, "Scan at most this many most recent monthly DBs on resend/replay (0 = config or 24, -1 = all).")
+	flag.Float64Var(&maxSendRate, "max-send-rate", 0, "Cap new and resent events at this many per second (0 = unlimited); replay is not paced.")
+	flag.IntVar(&syslogMaxConns, "syslog-max-conns", 0, "Max concurrent syslog TCP connections across destinations (0 = unlimited).")
+	flag.StringVar(&follow, "follow", "", "Tail a single growing NDJSON file; each new complete line is ingested once (offset kept in the DB).")
+	flag.BoolVar(&failOnNoInputs, "fail-on-no-inputs", false, "Fail the run (deadman reports the error) when no input globs match any file; otherwise only a warning is logged.")
+	flag.BoolVar(&requireSyslog, "require-syslog", false, "Fail each run early (deadman still sent) if the syslog receiver is unreachable.")
+	flag.BoolVar(&lifecycleEvents, "lifecycle-events", false, "In poll mode, send a kind=\"lifecycle\" event with version and config fingerprint on start and on clean stop (SIGINT/SIGTERM).")
+	flag.BoolVar(&reprocessErrors, "reprocess-errors", false, "Re-ingest files from each input's error_dir, then exit. Still-bad files are left in place.")
+	flag.BoolVar(&reconcile, "reconcile", false, "Fix processed-file rows that disagree with the filesystem (missing files, deleted files still present, all_sent), then exit. Sends nothing.")
 	flag.DurationVar(&pollInterval, "poll-interval", 5*time.Second, "Polling interval when not running with --once=false.")
 	flag.Parse()
 
@@ -68,8 +128,19 @@ func main() {
 
 	// Base config from file (optional)
 	fileCfg := &spooler.FileConfig{}
-	if configPath != "" {
-		cfg, err := spooler.LoadConfig(configPath)
+	if configPath != "" || configDir != "" {
+		var paths []string
+		if configPath != "" {
+			paths = append(paths, configPath)
+		}
+		if configDir != "" {
+			fragments, err := spooler.ConfigFragments(configDir)
+			if err != nil {
+				log.Fatalf("load config: %v", err)
+			}
+			paths = append(paths, fragments...)
+		}
+		cfg, err := spooler.LoadConfigFiles(paths)
 		if err != nil {
 			log.Fatalf("load config: %v", err)
 		}
@@ -91,6 +162,45 @@ func main() {
 		finalDB = dbPath
 	}
 
+	if checkDB {
+		folder := finalDBFolder
+		if visited["db"] {
+			// An explicit --db checks just that file.
+			folder = ""
+		}
+		stats, err := spooler.CheckDBs(folder, finalDBPrefix, finalDB)
+		if err != nil {
+			log.Fatalf("check-db: %v", err)
+		}
+		spooler.WriteDBStatsText(os.Stdout, stats)
+		return
+	}
+
+	if summary {
+		to := time.Now().UTC()
+		if strings.TrimSpace(summaryTo) != "" {
+			tm, err := parseReplayFrom(summaryTo)
+			if err != nil {
+				log.Fatalf("parse --summary-to: %v", err)
+			}
+			to = tm
+		}
+		from := to.Add(-24 * time.Hour)
+		if strings.TrimSpace(summaryFrom) != "" {
+			tm, err := parseReplayFrom(summaryFrom)
+			if err != nil {
+				log.Fatalf("parse --summary-from: %v", err)
+			}
+			from = tm
+		}
+		s, err := spooler.Summarize(finalDBFolder, finalDBPrefix, finalDB, from, to)
+		if err != nil {
+			log.Fatalf("summary: %v", err)
+		}
+		s.WriteText(os.Stdout)
+		return
+	}
+
 	finalJob := fileCfg.Job
 	if visited["job"] {
 		finalJob = jobLabel
@@ -114,6 +224,26 @@ func main() {
 	if visited["syslog-addr"] {
 		finalSyslog = syslogAddr
 	}
+	finalMaxDBScan := fileCfg.Database.MaxScan
+	if visited["max-db-scan"] {
+		finalMaxDBScan = maxDBScan
+	}
+	finalMaxSendRate := fileCfg.MaxSendRate
+	if visited["max-send-rate"] {
+		finalMaxSendRate = maxSendRate
+	}
+	finalMinFileAge := fileCfg.MinFileAge
+	if visited["min-file-age"] {
+		finalMinFileAge = minFileAge
+	}
+	finalSyslogHostname := fileCfg.SyslogHostname
+	if visited["syslog-hostname"] {
+		finalSyslogHostname = syslogHostname
+	}
+	finalSyslogNetwork := fileCfg.SyslogNetwork
+	if visited["syslog-network"] {
+		finalSyslogNetwork = syslogNetwork
+	}
 
 	finalService := fileCfg.Service
 	if finalService == "" {
@@ -138,7 +268,7 @@ func main() {
 
 	finalInputs := make([]spooler.InputSpec, 0, len(fileCfg.Files.Items))
 	for _, f := range fileCfg.Files.Items {
-		finalInputs = append(finalInputs, spooler.InputSpec{Glob: f.AlertDir, AlertType: f.AlertType})
+		finalInputs = append(finalInputs, spooler.InputSpec{Glob: f.AlertDir, AlertType: f.AlertType, ErrorDir: f.ErrorDir, Ordered: f.Ordered, Workers: f.Workers, HashMode: f.HashMode, HashFields: f.HashFields, Shards: f.Shards, DefaultLevel: f.DefaultLevel, Dedup: f.Dedup})
 	}
 
 	// CCCC codes
@@ -156,17 +286,21 @@ func main() {
 	// CCCC tagging is enabled iff codes is non-empty.
 	finalCCCCEnabled := len(finalCCCCCodes) > 0
 
-	if len(finalGlobs) == 0 && len(finalInputs) == 0 {
-		fmt.Fprintln(os.Stderr, "missing inputs (use config.yaml files[] or --input-glob / input_globs)")
-		os.Exit(2)
-	}
-	if strings.TrimSpace(finalJob) == "" {
-		fmt.Fprintln(os.Stderr, "missing job label (use --job or config.yaml job)")
-		os.Exit(2)
-	}
-	if strings.TrimSpace(deadman) == "" {
-		fmt.Fprintln(os.Stderr, "missing deadman token (use --deadman=...)")
-		os.Exit(2)
+	// --explain-hash only reads the given file, so it needs none of these.
+	if explainHash == "" {
+		if len(finalGlobs) == 0 && len(finalInputs) == 0 && strings.TrimSpace(follow) == "" && len(fileCfg.QueueInputs) == 0 && !flushOnly {
+			fmt.Fprintln(os.Stderr, "missing inputs (use config.yaml files[] / queue_inputs, --input-glob / input_globs, or --follow)")
+			os.Exit(2)
+		}
+		if strings.TrimSpace(finalJob) == "" {
+			fmt.Fprintln(os.Stderr, "missing job label (use --job or config.yaml job)")
+			os.Exit(2)
+		}
+		// A seed or reconcile run never sends, the deadman included.
+		if strings.TrimSpace(deadman) == "" && !seed && !reconcile {
+			fmt.Fprintln(os.Stderr, "missing deadman token (use --deadman=...)")
+			os.Exit(2)
+		}
 	}
 
 	var finalReplayFrom time.Time
@@ -178,29 +312,128 @@ func main() {
 		finalReplayFrom = tm
 	}
 
-	runner, err := spooler.NewRunner(spooler.RunnerConfig{
-		DBPath:          finalDB,
-		DBFolder:        finalDBFolder,
-		DBPrefix:        finalDBPrefix,
-		JobLabel:        finalJob,
-		Debug:           finalDebug,
-		InputGlobs:      finalGlobs,
-		Inputs:          finalInputs,
-		SyslogAddr:      finalSyslog,
-		ServiceLabel:    finalService,
-		HashHexLen:      finalHashLen,
-		CCCCEnabled:     finalCCCCEnabled,
-		CCCCCodes:       finalCCCCCodes,
-		DeleteAfterSend: finalDeleteAfterSend,
-		Timeout:         timeout,
-		DeadmanToken:    deadman,
-		ReplayFrom:      finalReplayFrom,
-	})
+	runnerCfg := spooler.RunnerConfig{
+		DBPath:                   finalDB,
+		DBFolder:                 finalDBFolder,
+		DBPrefix:                 finalDBPrefix,
+		DBByEventTime:            fileCfg.Database.KeyByEventTime,
+		MaxDBScan:                finalMaxDBScan,
+		JobLabel:                 finalJob,
+		Debug:                    finalDebug,
+		InputGlobs:               finalGlobs,
+		Inputs:                   finalInputs,
+		FollowPath:               follow,
+		QueueInputs:              fileCfg.QueueInputs,
+		QuietHours:               fileCfg.QuietHours,
+		QuietHoursTZ:             fileCfg.QuietHoursTZ,
+		SyslogAddr:               finalSyslog,
+		Output:                   output,
+		DryRun:                   dryRun || dryRunOut != "",
+		DryRunOut:                dryRunOut,
+		Seed:                     seed,
+		FlushOnly:                flushOnly,
+		SyslogNoDelay:            fileCfg.SyslogNoDelay,
+		SyslogKeepAlive:          fileCfg.SyslogKeepAlive,
+		SyslogFacility:           fileCfg.SyslogFacility,
+		SyslogSeverity:           fileCfg.SyslogSeverity,
+		SyslogNetwork:            finalSyslogNetwork,
+		SyslogHostname:           finalSyslogHostname,
+		SyslogTLS:                fileCfg.SyslogTLS,
+		SyslogFormat:             fileCfg.SyslogFormat,
+		SyslogFraming:            fileCfg.SyslogFraming,
+		SyslogMaxConns:           syslogMaxConns,
+		MaxSendRate:              finalMaxSendRate,
+		SendRetries:              fileCfg.SendRetries,
+		SendBackoff:              fileCfg.SendBackoff,
+		MTimeSkew:                fileCfg.MTimeSkew,
+		SyslogDestinations:       fileCfg.SyslogDestinations,
+		ServiceLabel:             finalService,
+		HashHexLen:               finalHashLen,
+		CCCCEnabled:              finalCCCCEnabled,
+		CCCCCodes:                finalCCCCCodes,
+		DeleteAfterSend:          finalDeleteAfterSend,
+		Timeout:                  timeout,
+		DeadmanToken:             deadman,
+		ReplayFrom:               finalReplayFrom,
+		ReplayDest:               replayDest,
+		ReplayForce:              replayForce,
+		RunSummary:               runSummary,
+		NormalizeStripPrefixes:   fileCfg.NormalizeStripPrefixes,
+		NormalizeMaxBytes:        fileCfg.NormalizeMaxBytes,
+		PayloadIncludeNormalized: fileCfg.PayloadIncludeNormalized,
+		PayloadGzipMinBytes:      fileCfg.PayloadGzipMinBytes,
+		PayloadShape:             fileCfg.PayloadShape,
+		SDOrder:                  fileCfg.SDOrder,
+		SDID:                     fileCfg.SDID,
+		SDGroups:                 fileCfg.SDGroups,
+		FlattenEnabled:           fileCfg.FlattenEnabled,
+		TraceIDField:             fileCfg.TraceIDField,
+		SkipOpenFiles:            fileCfg.SkipOpenFiles,
+		MaxOpenFiles:             fileCfg.MaxOpenFiles,
+		EmptyFiles:               fileCfg.EmptyFiles,
+		Reappear:                 fileCfg.Reappear,
+		AuditDir:                 fileCfg.AuditDir,
+		AuditGzip:                fileCfg.AuditGzip,
+		AuditIndent:              fileCfg.AuditIndent,
+		SpillDir:                 fileCfg.SpillDir,
+		HashScope:                fileCfg.HashScope,
+		MinFileAge:               finalMinFileAge,
+		TimeLayouts:              fileCfg.TimeLayouts,
+		EventTimeKeys:            fileCfg.EventTimeKeys,
+		RequireSyslog:            requireSyslog,
+		FailOnNoInputs:           failOnNoInputs,
+		Version:                  version,
+		FixedLabels:              fileCfg.FixedLabels,
+		HostnameLabels:           fileCfg.HostnameLabels,
+		KeepFields:               fileCfg.KeepFields,
+		DropFields:               fileCfg.DropFields,
+		ProcessedFileRetention:   fileCfg.ProcessedFileRetention,
+		EventTimeFromMTime:       fileCfg.EventTimeFromMTime,
+		FinalizeBatchSize:        fileCfg.FinalizeBatchSize,
+		InsertBatchSize:          fileCfg.InsertBatchSize,
+		SourceTypeSniff:          fileCfg.SourceTypeSniff,
+		DecodeRetries:            fileCfg.DecodeRetries,
+		MoveVerify:               fileCfg.MoveVerify,
+		DiskFreeMinBytes:         fileCfg.DiskFreeMinBytes,
+		SyslogTimestampFromEvent: fileCfg.SyslogTimestampFromEvent,
+	}
+
+	if explainHash != "" {
+		if err := spooler.ExplainHash(runnerCfg, explainHash, os.Stdout); err != nil {
+			log.Fatalf("explain-hash: %v", err)
+		}
+		return
+	}
+
+	runner, err := spooler.NewRunner(runnerCfg)
 	if err != nil {
 		log.Fatalf("init runner: %v", err)
 	}
 	defer runner.Close()
 
+	if reconcile {
+		res, err := runner.Reconcile()
+		if err != nil {
+			log.Fatalf("reconcile: %v", err)
+		}
+		log.Printf("reconcile: checked=%d marked_deleted=%d requeued=%d all_sent_fixed=%d", res.Checked, res.MarkedDeleted, res.Requeued, res.AllSentFixed)
+		return
+	}
+
+	if reprocessErrors {
+		if err := runner.ReprocessErrors(); err != nil {
+			log.Fatalf("reprocess errors: %v", err)
+		}
+		return
+	}
+
+	if drain {
+		if err := runner.Drain(drainMax, pollInterval); err != nil {
+			log.Fatalf("drain: %v", err)
+		}
+		return
+	}
+
 	if once {
 		if err := runner.RunOnce(); err != nil {
 			log.Fatalf("run once: %v", err)
@@ -208,11 +441,25 @@ func main() {
 		return
 	}
 
-	for {
-		if err := runner.RunOnce(); err != nil {
-			log.Printf("run once error: %v", err)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		sig := <-sigs
+		log.Printf("received %s, stopping", sig)
+		close(stop)
+	}()
+	if lifecycleEvents {
+		if err := runner.SendLifecycle("start"); err != nil {
+			log.Printf("lifecycle start: %v", err)
+		}
+	}
+	n := runner.Poll(pollInterval, maxIterations, stop)
+	log.Printf("poll loop done after %d sweep(s)", n)
+	if lifecycleEvents {
+		if err := runner.SendLifecycle("stop"); err != nil {
+			log.Printf("lifecycle stop: %v", err)
 		}
-		time.Sleep(pollInterval)
 	}
 }
 
@@ -22,11 +22,24 @@ func NormalizeAlertLevel(v string) string {
 	}
 }
 
+// ExtractAlertLevel derives the alert level from the first recognized status, level or
+// severity field of item, then from the .warn/.alarm extension of sourcePath.
 func ExtractAlertLevel(item any, sourcePath string) string {
+	return ExtractAlertLevelOr(item, sourcePath, "")
+}
+
+// ExtractAlertLevelOr is ExtractAlertLevel with fallback (when non-empty) instead of
+// "unknown" for events with no recognized level field in files without a .warn/.alarm
+// extension.
+func ExtractAlertLevelOr(item any, sourcePath string, fallback string) string {
 	if m, ok := item.(map[string]any); ok {
+		// A field whose value maps to unknown does not decide: the next field, then the
+		// extension, may still know the level.
 		for _, key := range []string{"status", "level", "severity"} {
 			if v, ok := m[key]; ok {
-				return NormalizeAlertLevel(fmt.Sprint(v))
+				if level := NormalizeAlertLevel(fmt.Sprint(v)); level != "unknown" {
+					return level
+				}
 			}
 		}
 	}
@@ -37,7 +50,9 @@ func ExtractAlertLevel(item any, sourcePath string) string {
 		return "warning"
 	case ".alarm":
 		return "critical"
-	default:
-		return "unknown"
 	}
+	if fallback != "" {
+		return fallback
+	}
+	return "unknown"
 }
@@ -0,0 +1,25 @@
+package spooler
+
+import "testing"
+
+func TestExtractAlertLevel_UnrecognizedStatusFallsBackToExtension(t *testing.T) {
+	cases := []struct {
+		item any
+		path string
+		want string
+	}{
+		{map[string]any{"status": "foobar"}, "a.alarm", "critical"},
+		{map[string]any{"status": "foobar"}, "a.warn", "warning"},
+		{map[string]any{"status": "foobar", "severity": "error"}, "a.warn", "critical"},
+		{map[string]any{"status": "1"}, "a.alarm", "warning"},
+		{map[string]any{"status": "foobar"}, "a.json", "unknown"},
+	}
+	for _, c := range cases {
+		if got := ExtractAlertLevel(c.item, c.path); got != c.want {
+			t.Fatalf("ExtractAlertLevel(%v, %q) = %q, want %q", c.item, c.path, got, c.want)
+		}
+	}
+	if got := ExtractAlertLevelOr(map[string]any{"status": "foobar"}, "a.json", "critical"); got != "critical" {
+		t.Fatalf("expected the input default for an unrecognized status, got %q", got)
+	}
+}
@@ -0,0 +1,114 @@
+package spooler
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditRecord is one AuditDir line: what was shipped and when.
+type auditRecord struct {
+	SentAt  time.Time         `json:"sent_at"`
+	Labels  map[string]string `json:"labels"`
+	Payload string            `json:"payload"`
+}
+
+// auditFilePath is the monthly audit file for t: <dir>/audit_<YYYYMM>.jsonl, plus ".gz"
+// with gz.
+func auditFilePath(dir string, t time.Time, gz bool) string {
+	name := "audit_" + monthKey(t) + ".jsonl"
+	if gz {
+		name += ".gz"
+	}
+	return filepath.Join(dir, name)
+}
+
+// audit appends a shipped event to the current audit file when AuditDir is set. It is
+// best-effort: a failed write is logged and never fails the send. Workers share one open
+// audit file (one gzip stream with AuditGzip), kept until closeAudit at run end.
+func (r *Runner) audit(labels map[string]string, payload string) {
+	dir := strings.TrimSpace(r.cfg.AuditDir)
+	if dir == "" {
+		return
+	}
+	now := time.Now().UTC()
+	line, err := marshalAuditRecord(auditRecord{SentAt: now, Labels: labels, Payload: payload}, r.cfg.AuditIndent)
+	if err == nil {
+		err = r.writeAudit(auditFilePath(dir, now, r.cfg.AuditGzip), append(line, '\n'))
+	}
+	if err != nil {
+		log.Printf("warn: audit write failed dir=%q err=%v", dir, err)
+	}
+}
+
+// writeAudit writes b to the audit file at path, opening it for append (and closing the
+// previous one) when the month rolled over since the last write.
+func (r *Runner) writeAudit(path string, b []byte) error {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	if r.auditOut != nil && r.auditPath != path {
+		err := r.auditOut.Close()
+		r.auditOut, r.auditPath = nil, ""
+		if err != nil {
+			log.Printf("warn: audit close failed path=%q err=%v", path, err)
+		}
+	}
+	if r.auditOut == nil {
+		w, err := openAppend(path)
+		if err != nil {
+			return err
+		}
+		r.auditOut, r.auditPath = w, path
+	}
+	_, err := r.auditOut.Write(b)
+	return err
+}
+
+// closeAudit flushes and closes the open audit file, ending its gzip member with
+// AuditGzip. Called at the end of each run and by Close.
+func (r *Runner) closeAudit() {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	if r.auditOut == nil {
+		return
+	}
+	if err := r.auditOut.Close(); err != nil {
+		log.Printf("warn: audit close failed path=%q err=%v", r.auditPath, err)
+	}
+	r.auditOut, r.auditPath = nil, ""
+}
+
+// marshalAuditRecord encodes rec as one compact line, or with indent as an indented
+// document for human review, its payload (when valid JSON) nested as an object rather than
+// an escaped string. Only the audit copy is affected; the sent payload stays compact.
+func marshalAuditRecord(rec auditRecord, indent bool) ([]byte, error) {
+	if !indent {
+		return json.Marshal(rec)
+	}
+	var payload any = rec.Payload
+	if json.Valid([]byte(rec.Payload)) {
+		payload = json.RawMessage(rec.Payload)
+	}
+	return json.MarshalIndent(struct {
+		SentAt  time.Time         `json:"sent_at"`
+		Labels  map[string]string `json:"labels"`
+		Payload any               `json:"payload"`
+	}{rec.SentAt, rec.Labels, payload}, "", "  ")
+}
+
+// openAppend opens path for append, creating it and its directory as needed; a ".gz" path
+// is written as a new gzip member, ended by Close.
+func openAppend(path string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return gzipIfSuffix(path, f), nil
+}
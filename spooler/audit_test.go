@@ -0,0 +1,245 @@
+package spooler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunner_AuditDirRecordsEachSend(t *testing.T) {
+	tmp := t.TempDir()
+	auditDir := filepath.Join(tmp, "audit")
+	for _, name := range []string{"a.warn", "b.warn"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), mustBuildFixtureJSON(t, "detail "+name+" ZBBB"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		AuditDir:     auditDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(auditFilePath(auditDir, time.Now(), false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []auditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	calls := sender.Calls()
+	if len(calls) != 2 || len(records) != len(calls) {
+		t.Fatalf("expected one audit line per send, got %d lines for %d sends", len(records), len(calls))
+	}
+	for i, rec := range records {
+		if rec.Payload != calls[i].message {
+			t.Fatalf("audit payload %d differs from sent message", i)
+		}
+		if rec.Labels["job"] != "mhdbs" || rec.Labels["hash"] == "" {
+			t.Fatalf("expected audit labels, got %v", rec.Labels)
+		}
+	}
+}
+
+func TestRunner_AuditGzipAppendsAcrossRuns(t *testing.T) {
+	tmp := t.TempDir()
+	auditDir := filepath.Join(tmp, "audit")
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		AuditDir:     auditDir,
+		AuditGzip:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	for _, name := range []string{"a.warn", "b.warn"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), mustBuildFixtureJSON(t, "detail "+name+" ZBBB"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := runner.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(auditFilePath(auditDir, time.Now(), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		lines++
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 audit lines from 2 runs, got %d", lines)
+	}
+}
+
+func TestRunner_AuditIndentKeepsSyslogCompact(t *testing.T) {
+	tmp := t.TempDir()
+	auditDir := filepath.Join(tmp, "audit")
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		AuditDir:     auditDir,
+		AuditIndent:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 send, got %d", len(calls))
+	}
+	if strings.Contains(calls[0].message, "\n") {
+		t.Fatalf("expected a single-line syslog payload, got %q", calls[0].message)
+	}
+
+	b, err := os.ReadFile(auditFilePath(auditDir, time.Now(), false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "{\n  \"sent_at\": ") || !strings.Contains(string(b), "\n  \"payload\": {\n    ") {
+		t.Fatalf("expected an indented audit record with a nested payload, got:\n%s", b)
+	}
+	var rec struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, rec.Payload); err != nil {
+		t.Fatal(err)
+	}
+	if compact.String() != calls[0].message {
+		t.Fatalf("audit payload differs from sent message:\n%s\n%s", compact.String(), calls[0].message)
+	}
+}
+
+func TestRunner_AuditGzipConcurrentWritesShareOneMember(t *testing.T) {
+	tmp := t.TempDir()
+	auditDir := filepath.Join(tmp, "audit")
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		AuditDir:     auditDir,
+		AuditGzip:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runner.audit(map[string]string{"seq": strconv.Itoa(i)}, strings.Repeat("x", 4096))
+		}(i)
+	}
+	wg.Wait()
+	runner.closeAudit()
+
+	f, err := os.Open(auditFilePath(auditDir, time.Now(), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the first member is read: every line must be in it.
+	zr.Multistream(false)
+	lines := 0
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		lines++
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if lines != n {
+		t.Fatalf("expected %d audit lines in one gzip member, got %d", n, lines)
+	}
+}
@@ -0,0 +1,127 @@
+package spooler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DBStats is the health view of one DB file.
+type DBStats struct {
+	Path           string
+	SizeBytes      int64
+	Events         int64
+	ProcessedFiles int64
+	// Pending counts events not yet sent to syslog.
+	Pending int64
+	// Stuck counts processed files whose events were all sent but that were never deleted.
+	Stuck         int64
+	MinArchivedAt *time.Time
+	MaxArchivedAt *time.Time
+}
+
+// CheckDBs reports DBStats for every monthly DB (or the legacy single DB when folder is
+// empty), opened read-only.
+func CheckDBs(folder string, prefix string, dbPath string) ([]DBStats, error) {
+	var paths []string
+	if strings.TrimSpace(folder) == "" {
+		if strings.TrimSpace(dbPath) == "" {
+			return nil, fmt.Errorf("DBPath or DBFolder is required")
+		}
+		paths = []string{dbPath}
+	} else {
+		if strings.TrimSpace(prefix) == "" {
+			prefix = "alerts_"
+		}
+		var err error
+		paths, err = listMonthlyDBs(folder, prefix, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]DBStats, 0, len(paths))
+	for _, p := range paths {
+		st, err := checkDB(p)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", p, err)
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+func checkDB(path string) (DBStats, error) {
+	st := DBStats{Path: path}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return st, err
+	}
+	st.SizeBytes = fi.Size()
+
+	db, err := OpenQueryDB(path)
+	if err != nil {
+		return st, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return st, err
+	}
+	defer sqlDB.Close()
+
+	if err := db.Model(&SpoolEvent{}).Count(&st.Events).Error; err != nil {
+		return st, err
+	}
+	if err := db.Model(&SpoolEvent{}).Where("sent_syslog = ?", false).Count(&st.Pending).Error; err != nil {
+		return st, err
+	}
+	if err := db.Model(&ProcessedFile{}).Count(&st.ProcessedFiles).Error; err != nil {
+		return st, err
+	}
+	if err := db.Model(&ProcessedFile{}).Where("all_sent = ? AND deleted = ?", true, false).Count(&st.Stuck).Error; err != nil {
+		return st, err
+	}
+	if st.Events == 0 {
+		return st, nil
+	}
+	for _, bound := range []struct {
+		order string
+		out   **time.Time
+	}{
+		{"archived_at asc", &st.MinArchivedAt},
+		{"archived_at desc", &st.MaxArchivedAt},
+	} {
+		var ev SpoolEvent
+		if err := db.Select("archived_at").Order(bound.order).Take(&ev).Error; err != nil {
+			return st, err
+		}
+		t := ev.ArchivedAt.UTC()
+		*bound.out = &t
+	}
+	return st, nil
+}
+
+// WriteDBStatsText prints one block per DB.
+func WriteDBStatsText(w io.Writer, stats []DBStats) {
+	for i, st := range stats {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "db: %s\n", st.Path)
+		fmt.Fprintf(w, "  size_bytes:      %d\n", st.SizeBytes)
+		fmt.Fprintf(w, "  events:          %d\n", st.Events)
+		fmt.Fprintf(w, "  pending:         %d\n", st.Pending)
+		fmt.Fprintf(w, "  processed_files: %d\n", st.ProcessedFiles)
+		fmt.Fprintf(w, "  stuck:           %d\n", st.Stuck)
+		fmt.Fprintf(w, "  archived_at:     %s .. %s\n", formatOptionalTime(st.MinArchivedAt), formatOptionalTime(st.MaxArchivedAt))
+	}
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
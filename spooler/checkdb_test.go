@@ -0,0 +1,77 @@
+package spooler
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDBs_ReportsCounts(t *testing.T) {
+	tmp := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	db, err := OpenDB(monthlyDBPath(tmp, "spooler_", now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	events := []SpoolEvent{
+		{AlertType: "dev", SentSyslog: true, ArchivedAt: now.Add(-2 * time.Hour)},
+		{AlertType: "dev", SentSyslog: false, ArchivedAt: now.Add(-time.Hour)},
+		{AlertType: "iec", SentSyslog: false, ArchivedAt: now},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	files := []ProcessedFile{
+		{Path: "a.warn", SHA256: "a", AllSent: true, Deleted: true},
+		{Path: "b.warn", SHA256: "b", AllSent: true, Deleted: false},
+		{Path: "c.warn", SHA256: "c", AllSent: false, Deleted: false},
+	}
+	if err := db.Create(&files).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := CheckDBs(tmp, "spooler_", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 db, got %d", len(stats))
+	}
+	st := stats[0]
+	if st.Events != 3 || st.Pending != 2 || st.ProcessedFiles != 3 || st.Stuck != 1 {
+		t.Fatalf("unexpected counts: %+v", st)
+	}
+	if st.MinArchivedAt == nil || !st.MinArchivedAt.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("expected min archived_at %s, got %v", now.Add(-2*time.Hour), st.MinArchivedAt)
+	}
+	if st.MaxArchivedAt == nil || !st.MaxArchivedAt.Equal(now) {
+		t.Fatalf("expected max archived_at %s, got %v", now, st.MaxArchivedAt)
+	}
+	if st.SizeBytes <= 0 {
+		t.Fatalf("expected a positive size, got %d", st.SizeBytes)
+	}
+
+	// The legacy single-DB form reads the same file.
+	single, err := CheckDBs("", "", filepath.Join(tmp, "spooler_"+monthKey(now)+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single[0].Events != 3 {
+		t.Fatalf("expected 3 events via db path, got %d", single[0].Events)
+	}
+
+	var buf bytes.Buffer
+	WriteDBStatsText(&buf, stats)
+	if !strings.Contains(buf.String(), "stuck:           1") {
+		t.Fatalf("expected stuck count in text output:\n%s", buf.String())
+	}
+}
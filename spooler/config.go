@@ -1,8 +1,12 @@
 package spooler
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,6 +23,17 @@ type InputFileConfig struct {
 	AlertDir  string `yaml:"alert_dir"`
 	AlertType string `yaml:"alert_type"`
 	ErrorDir  string `yaml:"error_dir"`
+	Ordered   bool   `yaml:"ordered"`
+	Workers   int    `yaml:"workers"`
+	// HashMode is keytext (default), event or fields (see InputSpec.HashMode).
+	HashMode   string   `yaml:"hash_mode"`
+	HashFields []string `yaml:"hash_fields"`
+	// Shards: alert_dir matches directories of *.json shards, each ingested as one file.
+	Shards bool `yaml:"shards"`
+	// DefaultLevel (warning or critical) replaces unknown for events without a level.
+	DefaultLevel string `yaml:"default_level"`
+	// Dedup is event (default) or file: all events of a file share its digest as hash.
+	Dedup string `yaml:"dedup"`
 }
 
 // FilesConfig accepts either:
@@ -51,7 +66,7 @@ func (f *FilesConfig) UnmarshalYAML(value *yaml.Node) error {
 
 			// Allow mapping values to be either:
 			// - scalar string: <alert_dir>
-			// - mapping object: {alert_dir: ..., error_dir: ...}
+			// - mapping object: any InputFileConfig fields; the key is the alert type.
 			switch v.Kind {
 			case yaml.ScalarNode:
 				alertDir := strings.TrimSpace(v.Value)
@@ -60,17 +75,18 @@ func (f *FilesConfig) UnmarshalYAML(value *yaml.Node) error {
 				}
 				items = append(items, InputFileConfig{AlertDir: alertDir, AlertType: alertType})
 			case yaml.MappingNode:
-				var tmp struct {
-					AlertDir string `yaml:"alert_dir"`
-					ErrorDir string `yaml:"error_dir"`
-				}
-				if err := v.Decode(&tmp); err != nil {
+				var item InputFileConfig
+				if err := v.Decode(&item); err != nil {
 					return err
 				}
-				if strings.TrimSpace(tmp.AlertDir) == "" {
+				item.AlertDir = strings.TrimSpace(item.AlertDir)
+				if item.AlertDir == "" {
 					continue
 				}
-				items = append(items, InputFileConfig{AlertDir: strings.TrimSpace(tmp.AlertDir), AlertType: alertType, ErrorDir: strings.TrimSpace(tmp.ErrorDir)})
+				item.AlertType = alertType
+				item.ErrorDir = strings.TrimSpace(item.ErrorDir)
+				item.HashMode = strings.TrimSpace(item.HashMode)
+				items = append(items, item)
 			default:
 				continue
 			}
@@ -93,6 +109,10 @@ func (f *FilesConfig) UnmarshalYAML(value *yaml.Node) error {
 type DatabaseConfig struct {
 	Folder string `yaml:"folder"`
 	Prefix string `yaml:"prefix"`
+	// KeyByEventTime stores each event in the DB for its event-time month instead of the current month.
+	KeyByEventTime bool `yaml:"key_by_event_time"`
+	// Most recent monthly DBs scanned by resend/replay (default 24, -1 = all).
+	MaxScan int `yaml:"max_scan"`
 }
 
 type FileConfig struct {
@@ -119,20 +139,193 @@ type FileConfig struct {
 	// Note: Alloy must be configured to extract these keys.
 	FixedLabels map[string]string `yaml:"fixed_labels"`
 
-	SyslogAddr string     `yaml:"syslog_addr"`
+	// Labels derived from the hostname: label -> regex (capture group 1). fixed_labels take precedence.
+	HostnameLabels map[string]string `yaml:"hostname_labels"`
+
+	SyslogAddr string `yaml:"syslog_addr"`
+	// Network for syslog_addr: tcp (default), udp, unix or unixgram (syslog_addr is the socket path).
+	SyslogNetwork string `yaml:"syslog_network"`
+	// TCP_NODELAY on syslog connections (default true).
+	SyslogNoDelay *bool `yaml:"syslog_no_delay"`
+	// TCP keep-alive period for syslog connections (e.g. 30s). Zero leaves the OS default.
+	SyslogKeepAlive time.Duration `yaml:"syslog_keep_alive"`
+	// PRI parts: facility 0-23 and severity 0-7 (default local0.info, PRI 134).
+	SyslogFacility *int `yaml:"syslog_facility"`
+	SyslogSeverity *int `yaml:"syslog_severity"`
+	// RFC5424 HOSTNAME in the syslog header (default os.Hostname()).
+	SyslogHostname string `yaml:"syslog_hostname"`
+	// Syslog line format: rfc5424 (default) or rfc3164 (BSD, labels folded into the message).
+	SyslogFormat string `yaml:"syslog_format"`
+	// Stream framing: lf (default, newline-delimited) or octet (RFC6587 octet counting).
+	SyslogFraming string `yaml:"syslog_framing"`
+	// TLS for tcp syslog connections (primary and syslog_destinations).
+	SyslogTLS SyslogTLSConfig `yaml:"syslog_tls"`
+	// Extra syslog receivers; each gets every event, optionally with only the listed labels.
+	SyslogDestinations []SyslogDestination `yaml:"syslog_destinations"`
+	// Message queues (Redis lists) polled after the files on each run.
+	QueueInputs []QueueInput `yaml:"queue_inputs"`
+	// Daily windows in which matching events are archived but not shipped.
+	QuietHours []QuietHours `yaml:"quiet_hours"`
+	// Zone of the quiet_hours times (default Asia/Shanghai).
+	QuietHoursTZ string `yaml:"quiet_hours_tz"`
+
 	Service    string     `yaml:"service"`
 	HashHexLen int        `yaml:"hash_hex_len"`
 	CCCC       CCCCConfig `yaml:"cccc"`
+
+	// Salt the content hash with alert_type and/or cccc (default: text only).
+	HashScope []string `yaml:"hash_scope"`
+
+	// Regexes for leading tokens stripped before hashing (e.g. log-level prefixes).
+	NormalizeStripPrefixes []string `yaml:"normalize_strip_prefixes"`
+
+	// Cap on the normalized key text (bytes) before hashing; 0 means no cap.
+	NormalizeMaxBytes int `yaml:"normalize_max_bytes"`
+
+	// Include the normalized key text (hash input) in the syslog payload. Off by default.
+	PayloadIncludeNormalized bool `yaml:"payload_include_normalized"`
+
+	// Gzip + base64 payloads of at least this many bytes (tagged ct="gzip"). 0 disables.
+	PayloadGzipMinBytes int `yaml:"payload_gzip_min_bytes"`
+
+	// Dotted path of an event field (e.g. ctx.trace_id) sent as the trace_id label and payload field.
+	TraceIDField string `yaml:"trace_id_field"`
+
+	// Payload shape: flat (default) or envelope ({"meta": labels, "body": payload}).
+	PayloadShape string `yaml:"payload_shape"`
+
+	// Compute the flattened event view (payload "flat"); default true. false skips it.
+	FlattenEnabled *bool `yaml:"flatten_enabled"`
+
+	// Structured-data param order replacing the built-in one; unlisted params follow sorted.
+	SDOrder []string `yaml:"sd_order"`
+	// SD-ID of the main structured-data element (default cndp), e.g. acme@32473.
+	SDID string `yaml:"sd_id"`
+	// Extra structured-data elements: SD-ID -> labels moved there out of the main one.
+	SDGroups map[string][]string `yaml:"sd_groups"`
+
+	// Runs a file that fails to decode is left in place and retried before it is archived
+	// as a decode error (and moved to error_dir). 0 gives up on the first failure.
+	DecodeRetries int `yaml:"decode_retries"`
+
+	// Check cross-device moves to error_dir before removing the source: size or sha256.
+	MoveVerify string `yaml:"move_verify"`
+
+	// Skip input files modified less than this long ago (e.g. 30s); later runs pick them up.
+	MinFileAge time.Duration `yaml:"min_file_age"`
+	// Tolerated clock skew for input mtimes ahead of the local clock (min_file_age check).
+	MTimeSkew time.Duration `yaml:"mtime_skew"`
+
+	// Max new/resent events sent per second (0 = unlimited).
+	MaxSendRate float64 `yaml:"max_send_rate"`
+	// Retries of a failed send within the run (default 0) and the first wait between them,
+	// doubled per retry (default 200ms).
+	SendRetries int           `yaml:"send_retries"`
+	SendBackoff time.Duration `yaml:"send_backoff"`
+
+	// Max input files read at once across ingest workers (0 = unlimited).
+	MaxOpenFiles int `yaml:"max_open_files"`
+
+	// Skip input files still open for writing by another process (Linux only).
+	SkipOpenFiles bool `yaml:"skip_open_files"`
+
+	// Append a JSON-lines copy of every shipped event to audit_<YYYYMM>.jsonl in this dir.
+	AuditDir string `yaml:"audit_dir"`
+	// Write the audit files gzipped (audit_<YYYYMM>.jsonl.gz).
+	AuditGzip bool `yaml:"audit_gzip"`
+	// Pretty-print audit records (payload nested as JSON) for human review.
+	AuditIndent bool `yaml:"audit_indent"`
+	// Directory receiving the syslog line of each failed send, drained at the start of each run.
+	SpillDir string `yaml:"spill_dir"`
+
+	// Zero-byte input files: skip (default), record (and delete), or error_dir.
+	EmptyFiles string `yaml:"empty_files"`
+	// An identical file reappearing after its copy was sent and deleted: skip (default,
+	// deleted again unsent) or resend.
+	Reappear string `yaml:"reappear"`
+
+	// Extra Go time layouts for event-time fields, tried after the built-in formats.
+	TimeLayouts []string `yaml:"time_layouts"`
+	// Event-time fields (dotted paths, e.g. header.timestamp) tried before the built-in keys.
+	EventTimeKeys []string `yaml:"event_time_keys"`
+
+	// Field projection (dotted paths) applied to events before storing/shipping.
+	// keep_fields keeps only the listed fields; drop_fields removes fields. The hash is unaffected.
+	KeepFields []string `yaml:"keep_fields"`
+	DropFields []string `yaml:"drop_fields"`
+
+	// Prune records of sent+deleted files older than this (e.g. 720h). Zero keeps them forever.
+	ProcessedFileRetention time.Duration `yaml:"processed_file_retention"`
+
+	// Rules deriving the source type from a leading marker line for files whose
+	// extension is not warn/alarm.
+	SourceTypeSniff []SourceTypeSniffRule `yaml:"source_type_sniff"`
+
+	// Warn (and report disk_free_bytes in the deadman) when the DB folder, an error dir,
+	// the spill dir or the audit dir has less free space than this many bytes. 0 disables
+	// the check.
+	DiskFreeMinBytes int64 `yaml:"disk_free_min_bytes"`
+
+	// Processed-file rows loaded per page when finalizing sent files (default 500).
+	FinalizeBatchSize int `yaml:"finalize_batch_size"`
+
+	// Events archived per INSERT (default 500); keeps huge files under SQLite's variable limit.
+	InsertBatchSize int `yaml:"insert_batch_size"`
+
+	// Use the source file's mtime as event time (for lag) when an event has no time field.
+	EventTimeFromMTime bool `yaml:"event_time_from_mtime"`
+
+	// Stamp the RFC5424 header with the event's time instead of the send time (falls back to now).
+	SyslogTimestampFromEvent bool `yaml:"syslog_timestamp_from_event"`
 }
 
 func LoadConfig(path string) (*FileConfig, error) {
-	b, err := os.ReadFile(path)
+	return LoadConfigFiles([]string{path})
+}
+
+// LoadConfigDir loads and merges all *.yaml fragments in dir in lexical order (conf.d style).
+func LoadConfigDir(dir string) (*FileConfig, error) {
+	paths, err := ConfigFragments(dir)
 	if err != nil {
 		return nil, err
 	}
-	var cfg FileConfig
-	if err := yaml.Unmarshal(b, &cfg); err != nil {
+	return LoadConfigFiles(paths)
+}
+
+// ConfigFragments lists the *.yaml files in dir in lexical order.
+func ConfigFragments(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
 		return nil, err
 	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.yaml config fragments in %s", dir)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// LoadConfigFiles merges config files in order: files and input_globs entries accumulate,
+// maps (e.g. fixed_labels) merge key by key, and any other setting a later file sets wins.
+func LoadConfigFiles(paths []string) (*FileConfig, error) {
+	var cfg FileConfig
+	var items []InputFileConfig
+	var globs []string
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		// Decoding into the same struct keeps settings the file does not mention.
+		if err := yaml.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		items = append(items, cfg.Files.Items...)
+		globs = append(globs, cfg.InputGlobs...)
+		cfg.Files.Items = nil
+		cfg.InputGlobs = nil
+	}
+	cfg.Files.Items = items
+	cfg.InputGlobs = globs
 	return &cfg, nil
 }
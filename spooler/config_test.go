@@ -0,0 +1,111 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfigDir_MergesFragments(t *testing.T) {
+	tmp := t.TempDir()
+	confDir := filepath.Join(tmp, "conf.d")
+	devDir := filepath.Join(tmp, "dev")
+	bizDir := filepath.Join(tmp, "business")
+	for _, d := range []string{confDir, devDir, bizDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fragments := map[string]string{
+		"10-base.yaml": "job: mhdbs\nservice: alerts\nfixed_labels:\n  env: prod\nfiles:\n  dev: " + filepath.Join(devDir, "*.alarm") + "\n",
+		"20-biz.yaml":  "fixed_labels:\n  site: cn\nfiles:\n  business:\n    alert_dir: " + filepath.Join(bizDir, "*.warn") + "\n",
+		"notes.txt":    "files:\n  iec: /nowhere/*.warn\n",
+	}
+	for name, content := range fragments {
+		if err := os.WriteFile(filepath.Join(confDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadConfigDir(confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Job != "mhdbs" || cfg.FixedLabels["env"] != "prod" || cfg.FixedLabels["site"] != "cn" {
+		t.Fatalf("expected shared settings merged, got job=%q fixed_labels=%v", cfg.Job, cfg.FixedLabels)
+	}
+	if len(cfg.Files.Items) != 2 {
+		t.Fatalf("expected files from both fragments, got %+v", cfg.Files.Items)
+	}
+
+	if err := os.WriteFile(filepath.Join(devDir, "one.alarm"), mustBuildFixtureJSON(t, "dev alert"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bizDir, "one.warn"), mustBuildFixtureJSON(t, "business alert"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inputs := make([]InputSpec, 0, len(cfg.Files.Items))
+	for _, f := range cfg.Files.Items {
+		inputs = append(inputs, InputSpec{Glob: f.AlertDir, AlertType: f.AlertType, ErrorDir: f.ErrorDir})
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     cfg.Job,
+		Inputs:       inputs,
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: cfg.Service,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	if err := runner.db.Model(&SpoolEvent{}).Order("alert_type").Pluck("alert_type", &types).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 || types[0] != "business" || types[1] != "dev" {
+		t.Fatalf("expected both alert types ingested, got %v", types)
+	}
+}
+
+func TestFilesConfig_MappingFormDecodesEveryField(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		field string
+		check func(InputFileConfig) bool
+	}{
+		{"error_dir", "error_dir: /err", func(f InputFileConfig) bool { return f.ErrorDir == "/err" }},
+		{"ordered", "ordered: true", func(f InputFileConfig) bool { return f.Ordered }},
+		{"workers", "workers: 3", func(f InputFileConfig) bool { return f.Workers == 3 }},
+		{"hash_mode", "hash_mode: fields", func(f InputFileConfig) bool { return f.HashMode == "fields" }},
+		{"hash_fields", "hash_fields: [code]", func(f InputFileConfig) bool { return len(f.HashFields) == 1 && f.HashFields[0] == "code" }},
+		{"shards", "shards: true", func(f InputFileConfig) bool { return f.Shards }},
+		{"default_level", "default_level: critical", func(f InputFileConfig) bool { return f.DefaultLevel == "critical" }},
+		{"dedup", "dedup: file", func(f InputFileConfig) bool { return f.Dedup == "file" }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg struct {
+				Files FilesConfig `yaml:"files"`
+			}
+			doc := "files:\n  business:\n    alert_dir: /in/*.warn\n    " + tc.field + "\n"
+			if err := yaml.Unmarshal([]byte(doc), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Files.Items) != 1 {
+				t.Fatalf("expected one input, got %+v", cfg.Files.Items)
+			}
+			f := cfg.Files.Items[0]
+			if f.AlertType != "business" || f.AlertDir != "/in/*.warn" || !tc.check(f) {
+				t.Fatalf("expected %s decoded in the mapping form, got %+v", tc.field, f)
+			}
+		})
+	}
+}
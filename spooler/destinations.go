@@ -0,0 +1,152 @@
+package spooler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SyslogDestination is an additional syslog receiver that gets every event the primary
+// (SyslogAddr) gets. Labels, when set, is the allowlist of structured-data labels sent to it.
+// Name identifies it for ReplayDest (its Addr works too).
+type SyslogDestination struct {
+	Name   string   `yaml:"name"`
+	Addr   string   `yaml:"addr"`
+	Labels []string `yaml:"labels"`
+}
+
+// primaryDestination is the ReplayDest selecting the primary output.
+const primaryDestination = "primary"
+
+type destination struct {
+	name   string
+	addr   string
+	sender SyslogSender
+	// allow is the label allowlist; nil sends every label.
+	allow map[string]struct{}
+}
+
+func newDestinations(dests []SyslogDestination, opts SyslogOptions) ([]destination, error) {
+	out := make([]destination, 0, len(dests))
+	for i, d := range dests {
+		addr := strings.TrimSpace(d.Addr)
+		if addr == "" {
+			return nil, fmt.Errorf("syslog_destinations[%d]: addr is required", i)
+		}
+		name := strings.TrimSpace(d.Name)
+		if name == primaryDestination {
+			return nil, fmt.Errorf("syslog_destinations[%d]: name %q is reserved", i, name)
+		}
+		dest := destination{name: name, addr: addr, sender: NewSyslogClientWithOptions(addr, opts)}
+		if len(d.Labels) > 0 {
+			dest.allow = make(map[string]struct{}, len(d.Labels))
+			for _, l := range d.Labels {
+				dest.allow[strings.TrimSpace(l)] = struct{}{}
+			}
+		}
+		out = append(out, dest)
+	}
+	return out, nil
+}
+
+// key is how the destination is recorded in SpoolEvent.SentTo and ReplayLog: its name,
+// or its addr when unnamed.
+func (d destination) key() string {
+	if d.name != "" {
+		return d.name
+	}
+	return d.addr
+}
+
+func findDestination(dests []destination, sel string) (destination, bool) {
+	for _, d := range dests {
+		if (d.name != "" && d.name == sel) || d.addr == sel {
+			return d, true
+		}
+	}
+	return destination{}, false
+}
+
+func (r *Runner) destination(sel string) (destination, bool) {
+	return findDestination(r.destinations, sel)
+}
+
+// labels returns the subset of labels this destination receives. ct is always kept so a
+// gzip payload stays decodable.
+func (d destination) labels(labels map[string]string) map[string]string {
+	if d.allow == nil {
+		return labels
+	}
+	out := make(map[string]string, len(d.allow))
+	for k, v := range labels {
+		if _, ok := d.allow[k]; ok || k == "ct" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// sendTarget is one receiver of an event: the primary output (dest nil) or a
+// SyslogDestinations entry.
+type sendTarget struct {
+	key    string
+	sender SyslogSender
+	dest   *destination
+}
+
+// sendTargets are every event's receivers: the primary output, then each destination.
+func (r *Runner) sendTargets() []sendTarget {
+	out := make([]sendTarget, 0, 1+len(r.destinations))
+	out = append(out, sendTarget{key: primaryDestination, sender: r.syslog})
+	for i := range r.destinations {
+		d := &r.destinations[i]
+		out = append(out, sendTarget{key: d.key(), sender: d.sender, dest: d})
+	}
+	return out
+}
+
+// labels returns the subset of labels the target receives.
+func (t sendTarget) labels(labels map[string]string) map[string]string {
+	if t.dest == nil {
+		return labels
+	}
+	return t.dest.labels(labels)
+}
+
+// parseSentTo reads SpoolEvent.SentTo into a set of target keys.
+func parseSentTo(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	out := make(map[string]bool)
+	for _, k := range strings.Split(s, ",") {
+		out[k] = true
+	}
+	return out
+}
+
+// addSentTo appends the keys not yet in SpoolEvent.SentTo s.
+func addSentTo(s string, keys []string) string {
+	have := parseSentTo(s)
+	for _, k := range keys {
+		if have[k] {
+			continue
+		}
+		if s != "" {
+			s += ","
+		}
+		s += k
+	}
+	return s
+}
+
+// sendAt sends one line with msgID to s, stamping the header with ts when it is set and s
+// supports it.
+func sendAt(s SyslogSender, ts time.Time, msgID string, structured string, payload string, timeout time.Duration) error {
+	if !ts.IsZero() {
+		if tss, ok := s.(SyslogTimestampSender); ok {
+			return tss.SendRFC5424AtTimeout(ts, "alert-spooler", msgID, structured, payload, timeout)
+		}
+	}
+	return s.SendRFC5424Timeout("alert-spooler", msgID, structured, payload, timeout)
+}
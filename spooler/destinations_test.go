@@ -0,0 +1,243 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunner_SyslogDestinationLabelSubset(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		CCCCCodes:    []string{"ZBBB"},
+		SyslogDestinations: []SyslogDestination{
+			{Addr: "127.0.0.1:2", Labels: []string{"job", "alert_type"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	primary := &mockSyslogSender{}
+	dr := &mockSyslogSender{}
+	runner.syslog = primary
+	runner.destinations[0].sender = dr
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 1 || len(dr.Calls()) != 1 {
+		t.Fatalf("expected 1 call per destination, got primary=%d dr=%d", len(primary.Calls()), len(dr.Calls()))
+	}
+
+	full := primary.Calls()[0].structuredData
+	for _, want := range []string{`job="mhdbs"`, `alert_type="general"`, `service="alerts"`, `hash="`, `cccc="ZBBB"`} {
+		if !strings.Contains(full, want) {
+			t.Fatalf("expected primary structured data to contain %s: %q", want, full)
+		}
+	}
+	if got, want := dr.Calls()[0].structuredData, `[cndp job="mhdbs" alert_type="general"]`; got != want {
+		t.Fatalf("expected reduced structured data %q, got %q", want, got)
+	}
+	if dr.Calls()[0].message != primary.Calls()[0].message {
+		t.Fatalf("expected the same payload on both destinations")
+	}
+}
+
+func TestRunner_ReplayDestSendsOnlyToSelected(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SyslogDestinations: []SyslogDestination{
+			{Name: "dr", Addr: "127.0.0.1:2"},
+		},
+		ReplayDest: "dr",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	primary := &mockSyslogSender{}
+	dr := &mockSyslogSender{}
+	runner.syslog = primary
+	runner.destinations[0].sender = dr
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 1 || len(dr.Calls()) != 1 {
+		t.Fatalf("expected a normal send to reach both, got primary=%d dr=%d", len(primary.Calls()), len(dr.Calls()))
+	}
+
+	runner.cfg.ReplayFrom = time.Now().Add(-10 * time.Minute).UTC()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 1 {
+		t.Fatalf("expected replay to skip primary, got %d primary calls", len(primary.Calls()))
+	}
+	if len(dr.Calls()) != 2 || !strings.Contains(dr.Calls()[1].structuredData, `replay="true"`) {
+		t.Fatalf("expected replay sent to dr, got %+v", dr.Calls())
+	}
+}
+
+func TestRunner_ReplayResendsOnlyToDestinationsThatMissedIt(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SyslogDestinations: []SyslogDestination{
+			{Name: "dr", Addr: "127.0.0.1:2"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	primary := &mockSyslogSender{}
+	dr := &mockSyslogSender{}
+	runner.syslog = primary
+	runner.destinations[0].sender = dr
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first replay reaches primary only; the second one owes dr alone.
+	runner.cfg.ReplayFrom = time.Now().Add(-10 * time.Minute).UTC()
+	dr.FailNext(1)
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 2 {
+		t.Fatalf("expected primary to get the replay once, got %d calls", len(primary.Calls()))
+	}
+	if len(dr.Calls()) != 3 || !strings.Contains(dr.Calls()[2].structuredData, `replay="true"`) {
+		t.Fatalf("expected dr to get the replay on the second pass, got %+v", dr.Calls())
+	}
+
+	// Every destination has it now.
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 2 || len(dr.Calls()) != 3 {
+		t.Fatalf("expected nothing replayed again, got primary=%d dr=%d", len(primary.Calls()), len(dr.Calls()))
+	}
+}
+
+func TestNewRunner_UnknownReplayDest(t *testing.T) {
+	tmp := t.TempDir()
+	_, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		ReplayDest: "nope",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown replay destination") {
+		t.Fatalf("expected unknown replay destination error, got %v", err)
+	}
+}
+
+func TestRunner_DestinationFailureResendsOnlyToThatDestination(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		PayloadShape: "envelope",
+		SyslogDestinations: []SyslogDestination{
+			{Name: "loki", Addr: "127.0.0.1:2", Labels: []string{"job", "alert_type"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	primary := &mockSyslogSender{}
+	loki := &mockSyslogSender{}
+	// The new send and the in-run resend both fail on loki only.
+	loki.FailNext(2)
+	runner.syslog = primary
+	runner.destinations[0].sender = loki
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 1 || len(loki.Calls()) != 2 {
+		t.Fatalf("expected the resend to skip the primary, got primary=%d loki=%d", len(primary.Calls()), len(loki.Calls()))
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ev.SentSyslog || ev.SentTo != "primary" {
+		t.Fatalf("expected the event pending with the primary delivered, got sent=%v sent_to=%q", ev.SentSyslog, ev.SentTo)
+	}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.Calls()) != 1 || len(loki.Calls()) != 3 {
+		t.Fatalf("expected only loki retried, got primary=%d loki=%d", len(primary.Calls()), len(loki.Calls()))
+	}
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !ev.SentSyslog || ev.SentTo != "primary,loki" {
+		t.Fatalf("expected the event sent to both, got sent=%v sent_to=%q", ev.SentSyslog, ev.SentTo)
+	}
+
+	// The envelope meta follows each destination's allowlist.
+	msg := loki.Calls()[2].message
+	if !strings.Contains(msg, `"meta":{"alert_type":"general","job":"mhdbs"}`) {
+		t.Fatalf("expected loki's meta limited to its labels, got %s", msg)
+	}
+	if !strings.Contains(primary.Calls()[0].message, `"service":"alerts"`) {
+		t.Fatalf("expected the primary meta to keep every label, got %s", primary.Calls()[0].message)
+	}
+}
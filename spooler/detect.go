@@ -0,0 +1,74 @@
+package spooler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+)
+
+// csvHeaderField is what a CSV header cell must look like for content to be read as CSV,
+// so free text with commas is not mistaken for a table.
+var csvHeaderField = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// decodeContent decodes a whole input file. Content that is not one JSON document is tried
+// as NDJSON (every non-empty line a JSON document) and then as CSV with a header row (each
+// row an object of header -> string value); both yield an array of events. The detected
+// format is returned; when nothing fits, the JSON error is.
+func decodeContent(body []byte) (any, string, error) {
+	var decoded any
+	jsonErr := json.Unmarshal(body, &decoded)
+	if jsonErr == nil {
+		return decoded, "json", nil
+	}
+	if items, ok := decodeNDJSON(body); ok {
+		return items, "ndjson", nil
+	}
+	if items, ok := decodeCSV(body); ok {
+		return items, "csv", nil
+	}
+	return nil, "", jsonErr
+}
+
+func decodeNDJSON(body []byte) ([]any, bool) {
+	var items []any
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(line, &v); err != nil {
+			return nil, false
+		}
+		items = append(items, v)
+	}
+	return items, len(items) > 0
+}
+
+func decodeCSV(body []byte) ([]any, bool) {
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || len(rows) < 2 || len(rows[0]) < 2 {
+		return nil, false
+	}
+	header := rows[0]
+	seen := make(map[string]struct{}, len(header))
+	for _, h := range header {
+		if !csvHeaderField.MatchString(h) {
+			return nil, false
+		}
+		if _, dup := seen[h]; dup {
+			return nil, false
+		}
+		seen[h] = struct{}{}
+	}
+	items := make([]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		obj := make(map[string]any, len(header))
+		for i, h := range header {
+			obj[h] = row[i]
+		}
+		items = append(items, obj)
+	}
+	return items, true
+}
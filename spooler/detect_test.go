@@ -0,0 +1,81 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunner_AutoDetectsJSONNDJSONAndCSV(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ndjson := string(mustBuildFixtureJSON(t, "ndjson one ZBBB")) + "\n" + string(mustBuildFixtureJSON(t, "ndjson two ZBBB")) + "\n"
+	files := map[string]string{
+		"a.warn": string(mustBuildFixtureJSON(t, "json doc ZBBB")),
+		"b.warn": ndjson,
+		"c.warn": "code,detail\nNIL_REPORT,csv row ZBBB\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(alertDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 events (1 json + 2 ndjson + 1 csv), got %d", len(calls))
+	}
+	var all strings.Builder
+	for _, c := range calls {
+		if strings.Contains(c.structuredData, "error=") {
+			t.Fatalf("expected no decode errors, got %q", c.structuredData)
+		}
+		all.WriteString(c.message)
+	}
+	for _, want := range []string{"json doc", "ndjson one", "ndjson two", "csv row"} {
+		if !strings.Contains(all.String(), want) {
+			t.Fatalf("expected an event with %q", want)
+		}
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(alertDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s ingested and deleted, stat err=%v", name, err)
+		}
+	}
+}
+
+func TestDecodeContent_DoesNotMisclassify(t *testing.T) {
+	if _, format, err := decodeContent([]byte(`[{"a":1},{"a":2}]`)); err != nil || format != "json" {
+		t.Fatalf("expected json, got format=%q err=%v", format, err)
+	}
+	if _, _, err := decodeContent([]byte("hello, world\nfoo, bar\n")); err == nil {
+		t.Fatalf("expected free text with commas to stay a decode error")
+	}
+	if _, _, err := decodeContent([]byte("not json")); err == nil {
+		t.Fatalf("expected a decode error")
+	}
+}
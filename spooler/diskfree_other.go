@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package spooler
+
+import "errors"
+
+// diskFreeBytes is not implemented on this platform; the disk-space check is skipped.
+func diskFreeBytes(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
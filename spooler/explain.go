@@ -0,0 +1,104 @@
+package spooler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ExplainHash prints, for each event in the file at path, the stages of its ContentHash:
+// the extracted key text, the hash input (per the matching input's hash_mode), the
+// normalized text, the CCCC code and the hash, using cfg's normalization, hash_scope and
+// hash length. The events are built by toEvents as a run would build them. The first Inputs
+// entry whose glob (** included, as expanded by a run) matches path supplies the alert
+// type and hash mode; otherwise they are inferred as for InputGlobs. Nothing is written
+// and only the file (and the input dirs, to match the globs) is read.
+func ExplainHash(cfg RunnerConfig, path string, w io.Writer) error {
+	stripPrefixes, err := CompileStripPrefixes(cfg.NormalizeStripPrefixes)
+	if err != nil {
+		return err
+	}
+	sniffers, err := compileSourceTypeSniff(cfg.SourceTypeSniff)
+	if err != nil {
+		return err
+	}
+	if cfg.HashHexLen <= 0 {
+		cfg.HashHexLen = 24
+	}
+	r := &Runner{
+		cfg:           cfg,
+		fs:            OSFS{},
+		normalizeOpts: NormalizeOptions{StripPrefixes: stripPrefixes, MaxBytes: cfg.NormalizeMaxBytes},
+		sniffers:      sniffers,
+	}
+
+	items, err := r.expandInputs(cfg.Inputs)
+	if err != nil {
+		return err
+	}
+	var hash hashSpec
+	alertType, alertTypeSrc := "", ""
+	for _, it := range items {
+		if filepath.Clean(it.Path) == filepath.Clean(path) {
+			hash = it.Hash
+			alertType, alertTypeSrc = strings.TrimSpace(it.AlertType), "forced"
+			break
+		}
+	}
+	if alertType == "" {
+		alertType, alertTypeSrc = inferAlertType(path)
+	}
+
+	content, err := r.fs.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fileSHA := sha256.Sum256(content)
+	sourceType, body := r.sourceTypeFor(path, content)
+	decoded, format, err := decodeContent(body)
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	events, err := r.toEvents(decoded, string(content), path, sourceType, alertType, hex.EncodeToString(fileSHA[:]), hash, "", nil)
+	if err != nil {
+		return fmt.Errorf("build events %s: %w", path, err)
+	}
+	docs, ok := decoded.([]any)
+	if !ok {
+		docs = []any{decoded}
+	}
+
+	mode := hash.Mode
+	if mode == "" {
+		mode = "keytext"
+	}
+	fmt.Fprintf(w, "file: %s\n", path)
+	fmt.Fprintf(w, "format: %s\n", format)
+	fmt.Fprintf(w, "alert_type: %s (%s)\n", alertType, alertTypeSrc)
+	fmt.Fprintf(w, "hash_mode: %s\n", mode)
+	if hash.Dedup == "file" {
+		fmt.Fprintf(w, "dedup: file (every event's hash is the file digest)\n")
+	}
+	for i, ev := range events {
+		fmt.Fprintf(w, "\nevent %d:\n", i)
+		if ev.DecodeError != "" {
+			fmt.Fprintf(w, "  error:      %s\n", ev.DecodeError)
+			continue
+		}
+		keyText := extractKeyText(docs[i])
+		fmt.Fprintf(w, "  key_text:   %q\n", keyText)
+		if input := hashInput(docs[i], keyText, hash); input != keyText {
+			fmt.Fprintf(w, "  hash_input: %q\n", input)
+		}
+		fmt.Fprintf(w, "  normalized: %q\n", ev.Normalized)
+		fmt.Fprintf(w, "  cccc:       %s\n", ev.CCCC)
+		if scope := r.hashScopePrefix(alertType, ev.CCCC); scope != "" {
+			fmt.Fprintf(w, "  scope:      %q\n", scope)
+		}
+		fmt.Fprintf(w, "  hash:       %s\n", ev.ContentHash)
+	}
+	return nil
+}
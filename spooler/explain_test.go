@@ -0,0 +1,88 @@
+package spooler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplainHash_PrintsStages(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := ExplainHash(RunnerConfig{
+		Inputs:     []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		CCCCCodes:  []string{"ZBBB"},
+		HashHexLen: 16,
+	}, src, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"alert_type: general (forced)",
+		`normalized: "heart beat missing ZBBB"`,
+		"cccc:       ZBBB",
+		"hash:       " + HashNormalized("heart beat missing ZBBB", 16),
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected output to contain %q:\n%s", want, got)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmp, "*.db")); len(matches) != 0 {
+		t.Fatalf("expected no DB to be created, got %v", matches)
+	}
+}
+
+func TestExplainHash_MatchesDoubleStarGlobAndRunHash(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "site", "a")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "one.warn")
+	content := mustBuildFixtureJSON(t, "heart beat missing ZBBB")
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		Inputs:     []InputSpec{{Glob: filepath.Join(tmp, "**", "*.warn"), AlertType: "general", Dedup: "file"}},
+		SyslogAddr: "127.0.0.1:1",
+		HashHexLen: 16,
+	}
+
+	var out bytes.Buffer
+	if err := ExplainHash(cfg, src, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "alert_type: general (forced)") {
+		t.Fatalf("expected the ** input to match:\n%s", out.String())
+	}
+
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := "hash:       " + ev.ContentHash; !strings.Contains(out.String(), want) {
+		t.Fatalf("expected the run's hash %q:\n%s", want, out.String())
+	}
+}
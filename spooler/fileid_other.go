@@ -0,0 +1,10 @@
+//go:build !unix
+
+package spooler
+
+import "io/fs"
+
+// fileIdentity is unavailable here; rotation is then detected by size only.
+func fileIdentity(info fs.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package spooler
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode of info, used to detect rotation of followed files.
+func fileIdentity(info fs.FileInfo) (dev uint64, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
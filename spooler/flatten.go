@@ -5,6 +5,9 @@ import (
 	"strconv"
 )
 
+// flattenTruncatedKey is set (true) in FlattenJSON's result when MaxKeys dropped keys.
+const flattenTruncatedKey = "_flatten_truncated"
+
 type FlattenOptions struct {
 	MaxDepth int
 	MaxKeys  int
@@ -19,12 +22,17 @@ func FlattenJSON(value any, opts FlattenOptions) map[string]any {
 	}
 
 	out := make(map[string]any)
-	flattenInto(out, "", value, 0, opts)
+	truncated := false
+	flattenInto(out, "", value, 0, opts, &truncated)
+	if truncated {
+		out[flattenTruncatedKey] = true
+	}
 	return out
 }
 
-func flattenInto(out map[string]any, prefix string, value any, depth int, opts FlattenOptions) {
+func flattenInto(out map[string]any, prefix string, value any, depth int, opts FlattenOptions, truncated *bool) {
 	if len(out) >= opts.MaxKeys {
+		*truncated = true
 		return
 	}
 	if depth > opts.MaxDepth {
@@ -41,10 +49,11 @@ func flattenInto(out map[string]any, prefix string, value any, depth int, opts F
 			if prefix != "" {
 				key = prefix + "." + k
 			}
-			flattenInto(out, key, child, depth+1, opts)
 			if len(out) >= opts.MaxKeys {
+				*truncated = true
 				return
 			}
+			flattenInto(out, key, child, depth+1, opts, truncated)
 		}
 	case []any:
 		for i, child := range v {
@@ -53,10 +62,11 @@ func flattenInto(out map[string]any, prefix string, value any, depth int, opts F
 			if prefix != "" {
 				key = prefix + "[" + idx + "]"
 			}
-			flattenInto(out, key, child, depth+1, opts)
 			if len(out) >= opts.MaxKeys {
+				*truncated = true
 				return
 			}
+			flattenInto(out, key, child, depth+1, opts, truncated)
 		}
 	default:
 		if prefix == "" {
@@ -20,3 +20,19 @@ func TestFlattenJSON(t *testing.T) {
 		t.Fatalf("expected a.c[1].y=true, got %v", flat["a.c[1].y"])
 	}
 }
+
+func TestFlattenJSON_MarksTruncation(t *testing.T) {
+	input := map[string]any{"a": 1, "b": 2, "c": []any{3, 4, 5}}
+	flat := FlattenJSON(input, FlattenOptions{MaxKeys: 2})
+	if flat[flattenTruncatedKey] != true {
+		t.Fatalf("expected %s=true, got %v", flattenTruncatedKey, flat)
+	}
+	if len(flat) != 3 {
+		t.Fatalf("expected 2 keys plus the marker, got %v", flat)
+	}
+
+	flat = FlattenJSON(input, FlattenOptions{MaxKeys: 5})
+	if _, ok := flat[flattenTruncatedKey]; ok {
+		t.Fatalf("did not expect a truncation marker when all keys fit: %v", flat)
+	}
+}
@@ -0,0 +1,176 @@
+package spooler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// followFile ingests complete NDJSON lines appended to path since the stored offset.
+// Each line becomes one or more events; the new offset is committed together with the
+// events, so a restart resumes after the last archived line. A file whose inode changed
+// (rotation) or that shrank below the stored offset (truncation) is re-read from the start.
+func (r *Runner) followFile(path string, deadline time.Time, stats *runStats) error {
+	info, err := r.fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	off, err := r.loadIngestOffset(path)
+	if err != nil {
+		return err
+	}
+	dev, ino, hasID := fileIdentity(info)
+	if hasID && off.Inode != 0 && (off.Inode != ino || off.Dev != dev) {
+		r.debugf("follow: rotated path=%q inode=%d->%d offset=%d", path, off.Inode, ino, off.Offset)
+		off.Offset = 0
+	} else if info.Size() < off.Offset {
+		r.debugf("follow: truncated path=%q size=%d offset=%d", path, info.Size(), off.Offset)
+		off.Offset = 0
+	}
+	if info.Size() == off.Offset {
+		return nil
+	}
+
+	f, err := r.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if seeker, ok := f.(io.Seeker); ok {
+		if _, err := seeker.Seek(off.Offset, io.SeekStart); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(io.Discard, f, off.Offset); err != nil {
+		return err
+	}
+	chunk, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	// Only complete lines; a trailing partial line is picked up on a later pass.
+	end := bytes.LastIndexByte(chunk, '\n')
+	if end < 0 {
+		return nil
+	}
+	chunk = chunk[:end+1]
+
+	alertType, alertTypeSrc := inferAlertType(path)
+	sourceType := inferSourceType(path)
+	var events []SpoolEvent
+	pos := off.Offset
+	for _, line := range bytes.SplitAfter(chunk, []byte("\n")) {
+		lineStart := pos
+		pos += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		events = append(events, r.followLineEvents(line, path, sourceType, alertType, lineStart, stats)...)
+	}
+	withAlertTypeSrc(events, alertTypeSrc)
+
+	r.sendNewEvents(path, events, deadline, stats)
+
+	local := events
+	undo := func() {}
+	if r.routeByEventTime() {
+		local, _, undo, err = r.insertOtherMonthEvents(events)
+		if err != nil {
+			return err
+		}
+	}
+	off.Path = path
+	off.Dev, off.Inode = dev, ino
+	off.Offset = pos
+	off.UpdatedAt = time.Now().UTC()
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if len(local) > 0 {
+			if err := tx.Create(&local).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&off).Error
+	})
+	if err != nil {
+		undo()
+		return err
+	}
+	if stats != nil {
+		stats.LinesIngested += len(events)
+	}
+	r.debugf("follow: path=%q events=%d offset=%d", path, len(events), off.Offset)
+	return nil
+}
+
+// followLineEvents builds the events for one NDJSON line starting at byte offset lineStart.
+// EventIndex is the line's byte offset, which stays unique across passes.
+func (r *Runner) followLineEvents(line []byte, path string, sourceType string, alertType string, lineStart int64, stats *runStats) []SpoolEvent {
+	sum := sha256.Sum256(line)
+	lineSHA := hex.EncodeToString(sum[:])
+	raw := string(line)
+
+	var decoded any
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		r.warnDecodeError(fmt.Sprintf("%s@%d", path, lineStart), line, err, stats)
+		ev := newErrorEvent(path, sourceType, alertType, lineSHA, raw, err)
+		ev.EventIndex = int(lineStart)
+		return []SpoolEvent{ev}
+	}
+	events, err := r.toEvents(decoded, raw, path, sourceType, alertType, lineSHA, hashSpec{}, "", stats)
+	if err != nil {
+		ev := newErrorEvent(path, sourceType, alertType, lineSHA, raw, err)
+		ev.EventIndex = int(lineStart)
+		return []SpoolEvent{ev}
+	}
+	for i := range events {
+		events[i].EventIndex = int(lineStart)
+	}
+	return events
+}
+
+// loadIngestOffset returns the stored offset for path. After a month rollover the offset
+// is carried over from the newest older monthly DB that has one.
+func (r *Runner) loadIngestOffset(path string) (IngestOffset, error) {
+	var off IngestOffset
+	err := r.db.Where("path = ?", path).First(&off).Error
+	if err == nil {
+		return off, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return IngestOffset{}, err
+	}
+	if strings.TrimSpace(r.cfg.DBFolder) == "" {
+		return IngestOffset{Path: path}, nil
+	}
+	paths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, time.Time{}, time.Now().UTC())
+	if err != nil {
+		return IngestOffset{}, err
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		if month, ok := parseMonthlyDBKey(filepath.Base(paths[i]), r.cfg.DBPrefix); ok && monthKey(month) == r.dbKey {
+			continue
+		}
+		db, err := OpenQueryDB(paths[i])
+		if err != nil {
+			continue
+		}
+		var prev IngestOffset
+		found := db.Where("path = ?", path).First(&prev).Error == nil
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+		if found {
+			return IngestOffset{Path: path, Dev: prev.Dev, Inode: prev.Inode, Offset: prev.Offset}, nil
+		}
+	}
+	return IngestOffset{Path: path}, nil
+}
@@ -0,0 +1,103 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, l := range lines {
+		if _, err := f.WriteString(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newFollowRunner(t *testing.T, tmp string, path string) (*Runner, *mockSyslogSender) {
+	t.Helper()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		FollowPath:   path,
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	return runner, sender
+}
+
+func TestRunner_FollowIngestsEachLineOnceAcrossRuns(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "general", "alerts.ndjson")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, `{"detail":"line one"}`+"\n", `{"detail":"line two"}`+"\n", `{"detail":"partial`)
+
+	runner, sender := newFollowRunner(t, tmp, path)
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sender.Calls()); got != 2 {
+		t.Fatalf("expected 2 sends for complete lines, got %d", got)
+	}
+	// Simulate a restart: a fresh runner must resume from the stored offset.
+	runner.Close()
+
+	appendLines(t, path, ` three"}`+"\n", `{"detail":"line four"}`+"\n")
+	runner2, sender2 := newFollowRunner(t, tmp, path)
+	defer runner2.Close()
+	if err := runner2.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner2.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender2.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 sends after restart, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].message, "partial three") || !strings.Contains(calls[1].message, "line four") {
+		t.Fatalf("unexpected lines after restart: %q / %q", calls[0].message, calls[1].message)
+	}
+
+	var events []SpoolEvent
+	if err := runner2.db.Order("id asc").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"line one", "line two", "partial three", "line four"}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, w := range want {
+		if events[i].Normalized != w || !events[i].SentSyslog {
+			t.Fatalf("event %d: expected sent %q, got %q sent=%v", i, w, events[i].Normalized, events[i].SentSyslog)
+		}
+	}
+
+	// Truncation resets the offset and re-reads from the start.
+	if err := os.WriteFile(path, []byte(`{"detail":"after truncate"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner2.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls = sender2.Calls()
+	if len(calls) != 3 || !strings.Contains(calls[2].message, "after truncate") {
+		t.Fatalf("expected truncated file re-read from start, got %d calls", len(calls))
+	}
+}
@@ -0,0 +1,67 @@
+//go:build unix
+
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunner_FollowRotationNoDuplicatesNoSkips(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "general", "alerts.ndjson")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, `{"detail":"a"}`+"\n", `{"detail":"b"}`+"\n")
+
+	runner, sender := newFollowRunner(t, tmp, path)
+	defer runner.Close()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: move the old file away and start a new one at the same path that is
+	// already larger than the stored offset, so only the inode reveals the rotation.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, `{"detail":"rotated c"}`+"\n", `{"detail":"rotated d"}`+"\n", `{"detail":"rotated e"}`+"\n")
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	// A further pass with no new data must not re-ship anything.
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(sender.Calls()); got != 5 {
+		t.Fatalf("expected 5 sends total, got %d", got)
+	}
+	var events []SpoolEvent
+	if err := runner.db.Order("id asc").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "rotated c", "rotated d", "rotated e"}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, w := range want {
+		if events[i].Normalized != w {
+			t.Fatalf("event %d: expected %q, got %q", i, w, events[i].Normalized)
+		}
+	}
+
+	var off IngestOffset
+	if err := runner.db.Where("path = ?", path).First(&off).Error; err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ino, _ := fileIdentity(info); off.Inode != ino || off.Offset != info.Size() {
+		t.Fatalf("expected stored offset for new inode %d at %d, got %+v", ino, info.Size(), off)
+	}
+}
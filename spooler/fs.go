@@ -0,0 +1,84 @@
+package spooler
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem is the subset of filesystem operations the runner uses on input files.
+// It lets tests inject faults (permission errors, failed renames, races).
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	WalkDir(root string, fn fs.WalkDirFunc) error
+	Glob(pattern string) ([]string, error)
+}
+
+// OSFS is the os-backed FileSystem used by default.
+type OSFS struct{}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) ReadFile(name string) ([]byte, error)         { return os.ReadFile(name) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+func (OSFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Open(name string) (io.ReadCloser, error)      { return os.Open(name) }
+func (OSFS) Create(name string) (io.WriteCloser, error)   { return os.Create(name) }
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (OSFS) WalkDir(root string, fn fs.WalkDirFunc) error { return filepath.WalkDir(root, fn) }
+func (OSFS) Glob(pattern string) ([]string, error)        { return filepath.Glob(pattern) }
+
+// fileBudget is a counting semaphore over the short-lived file handles a run opens (see
+// RunnerConfig.MaxOpenFiles). A nil budget is unlimited.
+type fileBudget chan struct{}
+
+// newFileBudget returns a budget of max handles, or nil when max <= 0.
+func newFileBudget(max int) fileBudget {
+	if max <= 0 {
+		return nil
+	}
+	return make(fileBudget, max)
+}
+
+func (b fileBudget) acquire() {
+	if b != nil {
+		b <- struct{}{}
+	}
+}
+
+func (b fileBudget) release() {
+	if b != nil {
+		<-b
+	}
+}
+
+// budgetFS bounds how many input files are read at once across ingest workers: ReadFile
+// waits for a slot of budget. Moves to error_dir are not counted, since a copy holds
+// several handles at once and could otherwise wait on itself.
+type budgetFS struct {
+	FileSystem
+	budget fileBudget
+}
+
+// newBudgetFS wraps fsys so its reads share budget, or returns fsys unchanged when budget
+// is nil.
+func newBudgetFS(fsys FileSystem, budget fileBudget) FileSystem {
+	if budget == nil {
+		return fsys
+	}
+	return budgetFS{FileSystem: fsys, budget: budget}
+}
+
+func (b budgetFS) ReadFile(name string) ([]byte, error) {
+	b.budget.acquire()
+	defer b.budget.release()
+	return b.FileSystem.ReadFile(name)
+}
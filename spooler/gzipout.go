@@ -0,0 +1,29 @@
+package spooler
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// gzipFile is a file written through gzip; Close flushes the gzip stream, then closes the file.
+type gzipFile struct {
+	*gzip.Writer
+	f io.Closer
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Writer.Close()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// gzipIfSuffix wraps f in gzip when path ends in ".gz".
+func gzipIfSuffix(path string, f io.WriteCloser) io.WriteCloser {
+	if !strings.HasSuffix(path, ".gz") {
+		return f
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}
+}
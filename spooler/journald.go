@@ -0,0 +1,135 @@
+package spooler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultJournaldSocket is systemd-journald's native protocol socket.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldSender writes events to the local journal via the native datagram protocol.
+// Structured-data labels become journal fields (e.g. alert_level -> ALERT_LEVEL).
+type JournaldSender struct {
+	socket string
+}
+
+// NewJournaldSender checks that the journald socket exists; it fails on hosts without systemd.
+func NewJournaldSender(socket string) (*JournaldSender, error) {
+	if strings.TrimSpace(socket) == "" {
+		socket = DefaultJournaldSocket
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return nil, fmt.Errorf("journald socket unavailable (not a systemd host?): %w", err)
+	}
+	return &JournaldSender{socket: socket}, nil
+}
+
+// SendRFC5424Timeout writes one journal entry; msgID has no journal field (MESSAGE_ID
+// must be a 128-bit id) and is dropped.
+func (j *JournaldSender) SendRFC5424Timeout(appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
+	if appName == "" {
+		appName = "alert-spooler"
+	}
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", strings.TrimSpace(message))
+	writeJournalField(&b, "PRIORITY", "6") // info, matching local0.info for syslog
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", appName)
+	_, params := parseStructuredData(structuredData)
+	for _, p := range params {
+		writeJournalField(&b, journalFieldName(p[0]), p[1])
+	}
+
+	conn, err := net.DialTimeout("unixgram", j.socket, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+	_, err = conn.Write(b.Bytes())
+	return err
+}
+
+// writeJournalField encodes one field; values containing newlines use the
+// length-prefixed binary form of the native protocol.
+func writeJournalField(b *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName maps a label to a valid journal field name: uppercase A-Z, 0-9, '_',
+// not starting with '_' (reserved for trusted fields).
+func journalFieldName(label string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(label) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+	return name
+}
+
+// parseStructuredData parses "[id k="v" ...]" elements as built by buildStructuredData
+// (or several, as built by buildStructuredDataElements), returning the first SD-ID and
+// the params of all elements in order.
+func parseStructuredData(sd string) (string, [][2]string) {
+	sd = strings.TrimSpace(sd)
+	if !strings.HasPrefix(sd, "[") {
+		return "", nil
+	}
+	sd = strings.TrimSuffix(sd[1:], "]")
+	id, rest, _ := strings.Cut(sd, " ")
+	var params [][2]string
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		key, after, ok := strings.Cut(rest, "=\"")
+		if !ok {
+			return id, params
+		}
+		var val strings.Builder
+		i := 0
+		for ; i < len(after); i++ {
+			c := after[i]
+			if c == '\\' && i+1 < len(after) {
+				i++
+				val.WriteByte(after[i])
+				continue
+			}
+			if c == '"' {
+				break
+			}
+			val.WriteByte(c)
+		}
+		params = append(params, [2]string{key, val.String()})
+		if i >= len(after) {
+			return id, params
+		}
+		rest = after[i+1:]
+		if strings.HasPrefix(rest, "][") {
+			_, rest, _ = strings.Cut(rest[2:], " ")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package spooler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournaldSender_WritesLabelsAsFields(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sender, err := NewJournaldSender(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := buildStructuredData("cndp", map[string]string{"job": "mhdbs", "alert_level": "warning", "filename": `a "b".warn`})
+	if err := sender.SendRFC5424Timeout("alert-spooler", msgIDAlert, sd, "line1\nline2", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	_ = ln.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := ln.ReadFromUnix(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournalDatagram(t, buf[:n])
+	want := map[string]string{
+		"MESSAGE":           "line1\nline2",
+		"PRIORITY":          "6",
+		"SYSLOG_IDENTIFIER": "alert-spooler",
+		"JOB":               "mhdbs",
+		"ALERT_LEVEL":       "warning",
+		"FILENAME":          `a "b".warn`,
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Fatalf("expected %s=%q, got %q (all: %v)", k, v, fields[k], fields)
+		}
+	}
+}
+
+func TestNewJournaldSender_MissingSocketErrors(t *testing.T) {
+	if _, err := NewJournaldSender(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Fatalf("expected error when journald socket is missing")
+	}
+}
+
+func parseJournalDatagram(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			t.Fatalf("truncated datagram: %q", b)
+		}
+		line := b[:nl]
+		b = b[nl+1:]
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			out[string(line[:eq])] = string(line[eq+1:])
+			continue
+		}
+		size := binary.LittleEndian.Uint64(b[:8])
+		out[string(line)] = string(b[8 : 8+size])
+		b = b[8+size+1:]
+	}
+	return out
+}
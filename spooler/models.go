@@ -13,6 +13,13 @@ type ProcessedFile struct {
 	Deleted     bool      `gorm:"index"`
 	DeletedAt   *time.Time
 	LastError   string `gorm:"type:text"`
+	// DecodeAttempts counts failed decodes while DecodePending is set: the row only tracks
+	// a file left in place for a later run (DecodeRetries), nothing has been archived yet.
+	DecodeAttempts int
+	DecodePending  bool `gorm:"index"`
+	// InputTag records which input matched the file (see inputTag); with overlapping globs
+	// it is the first input, the one whose settings were applied.
+	InputTag string `gorm:"index;size:64"`
 }
 
 type SpoolEvent struct {
@@ -21,9 +28,11 @@ type SpoolEvent struct {
 	SourcePath string    `gorm:"index;size:1024"`
 	SourceType string    `gorm:"index;size:32"` // warn, alarm, other
 	AlertType  string    `gorm:"index;size:32"` // dev, iec, business, general, unknown
-	AlertLevel string    `gorm:"index;size:16"` // warning, critical, unknown
-	CCCC       string    `gorm:"index;size:16"` // 4-char code tag (e.g. ZBBB)
-	EventIndex int       `gorm:"index"`
+	// AlertTypeSrc records how AlertType was determined: forced, path, ext, default.
+	AlertTypeSrc string `gorm:"size:16"`
+	AlertLevel   string `gorm:"index;size:16"` // warning, critical, unknown
+	CCCC         string `gorm:"index;size:16"` // 4-char code tag (e.g. ZBBB)
+	EventIndex   int    `gorm:"index"`
 	// FileDigestSHA256 is the SHA-256 digest of the whole file content.
 	// It is used to associate events with their source file record (ProcessedFile) and to ensure idempotency.
 	// For ZYC-like de-duplication, use ContentHash (normalized key-text hash) instead.
@@ -34,8 +43,54 @@ type SpoolEvent struct {
 	Normalized       string `gorm:"type:text"`
 	// ContentHash is the ZYC-like hash: hash(normalize(extractKeyText(detail/description/...))).
 	ContentHash string `gorm:"index;size:64"`
+	// DecodeError is set for events synthesized from unparseable input (see newErrorEvent).
+	// Such events are still shipped, tagged with error="decode".
+	DecodeError string `gorm:"type:text"`
 	SentSyslog  bool   `gorm:"index"`
-	SendError   string `gorm:"type:text"`
-	SentAt      *time.Time
-	ArchivedAt  time.Time `gorm:"index"`
+	// Seeded marks events archived by a seed run (RunnerConfig.Seed): recorded as sent
+	// without being shipped, and skipped by replay.
+	Seeded bool `gorm:"index"`
+	// Suppressed marks events held back by QuietHours: sent_syslog is true when they were
+	// dropped, false while they wait to be re-emitted after the window (labeled quiet="true").
+	Suppressed bool   `gorm:"index"`
+	SendError  string `gorm:"type:text"`
+	// SentTo lists (comma-separated) the targets that received the event: "primary" and
+	// SyslogDestinations names (or addrs). A resend after a partial failure skips them.
+	SentTo     string `gorm:"type:text"`
+	SentAt     *time.Time
+	ArchivedAt time.Time `gorm:"index"`
+	// SourceMTime is the source file's mtime, recorded when EventTimeFromMTime is enabled.
+	SourceMTime *time.Time
+	// EventTime and TraceID are the event's own time (see extractEventTime) and
+	// TraceIDField value, read from the decoded item before KeepFields/DropFields project
+	// it, so they survive the projection. Rows archived without them fall back to EventJSON.
+	EventTime *time.Time
+	TraceID   string `gorm:"size:256"`
+	// InputTag is the ProcessedFile.InputTag of the event's file, or the queue for
+	// QueueInputs messages; empty for followed lines.
+	InputTag string `gorm:"index;size:64"`
+}
+
+// IngestOffset tracks how far a followed (tailed) NDJSON file has been ingested.
+// Dev/Inode identify the file the offset belongs to (0 where unsupported), so a
+// rotated file (same path, new inode) is read from the start.
+type IngestOffset struct {
+	ID        uint   `gorm:"primaryKey"`
+	Path      string `gorm:"uniqueIndex;size:1024"`
+	Dev       uint64
+	Inode     uint64
+	Offset    int64
+	UpdatedAt time.Time
+}
+
+// ReplayLog records an event replayed to a destination, so replaying the same window again
+// skips it (see RunnerConfig.ReplayForce). Rows live in the replayed event's own monthly
+// DB, one per destination key (see destination.key) that received the event; DBMonth and
+// EventID identify the event's DB and row.
+type ReplayLog struct {
+	ID          uint      `gorm:"primaryKey"`
+	DBMonth     string    `gorm:"uniqueIndex:uniq_replay;size:8"`
+	EventID     uint      `gorm:"uniqueIndex:uniq_replay"`
+	Destination string    `gorm:"uniqueIndex:uniq_replay;size:256"`
+	ReplayedAt  time.Time `gorm:"index"`
 }
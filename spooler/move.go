@@ -1,57 +1,125 @@
 package spooler
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
 func MoveFileToDir(srcPath string, dstDir string) (string, error) {
+	return MoveFileToDirFS(OSFS{}, srcPath, dstDir)
+}
+
+// MoveFileToDirFS is MoveFileToDir on an arbitrary FileSystem.
+func MoveFileToDirFS(fsys FileSystem, srcPath string, dstDir string) (string, error) {
+	return MoveFileToDirFSVerify(fsys, srcPath, dstDir, "")
+}
+
+// MoveFileToDirFSVerify is MoveFileToDirFS whose copy+remove fallback checks the copy
+// before removing the source: verify "size" compares sizes, "sha256" also compares
+// content digests, "" checks nothing. On a mismatch the copy is removed, the source is
+// kept and an error is returned.
+func MoveFileToDirFSVerify(fsys FileSystem, srcPath string, dstDir string, verify string) (string, error) {
 	if strings.TrimSpace(dstDir) == "" {
 		return "", fmt.Errorf("dstDir is empty")
 	}
-	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+	if err := fsys.MkdirAll(dstDir, 0o755); err != nil {
 		return "", err
 	}
 	base := filepath.Base(srcPath)
 	dstPath := filepath.Join(dstDir, base)
-	if _, err := os.Stat(dstPath); err == nil {
+	if _, err := fsys.Stat(dstPath); err == nil {
 		ext := filepath.Ext(base)
 		name := strings.TrimSuffix(base, ext)
 		dstPath = filepath.Join(dstDir, fmt.Sprintf("%s-%d%s", name, time.Now().UnixNano(), ext))
 	}
 
 	// Try fast rename first.
-	if err := os.Rename(srcPath, dstPath); err == nil {
+	if err := fsys.Rename(srcPath, dstPath); err == nil {
 		return dstPath, nil
 	}
 
-	// Fallback: copy + remove (handles cross-device moves).
-	in, err := os.Open(srcPath)
+	// Fallback: copy + remove (handles cross-device moves). Only files are copied.
+	if info, err := fsys.Stat(srcPath); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		return "", fmt.Errorf("move %s: cannot copy a directory to %s", srcPath, dstDir)
+	}
+	in, err := fsys.Open(srcPath)
 	if err != nil {
 		return "", err
 	}
 	defer in.Close()
 
-	out, err := os.Create(dstPath)
+	out, err := fsys.Create(dstPath)
 	if err != nil {
 		return "", err
 	}
 	_, copyErr := io.Copy(out, in)
 	closeErr := out.Close()
 	if copyErr != nil {
-		_ = os.Remove(dstPath)
+		_ = fsys.Remove(dstPath)
 		return "", copyErr
 	}
 	if closeErr != nil {
-		_ = os.Remove(dstPath)
+		_ = fsys.Remove(dstPath)
 		return "", closeErr
 	}
-	if err := os.Remove(srcPath); err != nil {
+	if err := verifyCopy(fsys, srcPath, dstPath, verify); err != nil {
+		_ = fsys.Remove(dstPath)
+		return "", err
+	}
+	if err := fsys.Remove(srcPath); err != nil {
 		return "", err
 	}
 	return dstPath, nil
 }
+
+func verifyCopy(fsys FileSystem, srcPath string, dstPath string, verify string) error {
+	if verify == "" {
+		return nil
+	}
+	src, err := fsys.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := fsys.Stat(dstPath)
+	if err != nil {
+		return err
+	}
+	if src.Size() != dst.Size() {
+		return fmt.Errorf("move %s: copy size %d != source size %d", srcPath, dst.Size(), src.Size())
+	}
+	if verify != "sha256" {
+		return nil
+	}
+	srcSum, err := fileSHA256(fsys, srcPath)
+	if err != nil {
+		return err
+	}
+	dstSum, err := fileSHA256(fsys, dstPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcSum, dstSum) {
+		return fmt.Errorf("move %s: copy sha256 does not match source", srcPath)
+	}
+	return nil
+}
+
+func fileSHA256(fsys FileSystem, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
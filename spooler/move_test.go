@@ -1,6 +1,8 @@
 package spooler
 
 import (
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -58,3 +60,81 @@ func TestMoveFileToDir_AvoidsNameCollision(t *testing.T) {
 		t.Fatalf("unexpected content: %q", string(b))
 	}
 }
+
+// shortCopyFS is an OSFS that cannot rename (as across devices) and whose created files
+// silently drop the last byte written.
+type shortCopyFS struct {
+	OSFS
+}
+
+func (shortCopyFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrInvalid}
+}
+
+func (f shortCopyFS) Create(name string) (io.WriteCloser, error) {
+	w, err := f.OSFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return shortWriter{w}, nil
+}
+
+type shortWriter struct {
+	io.WriteCloser
+}
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := w.WriteCloser.Write(p[:len(p)-1]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestMoveFileToDirFSVerify_ShortCopyKeepsSource(t *testing.T) {
+	tmp := t.TempDir()
+	srcPath := filepath.Join(tmp, "a.warn")
+	if err := os.WriteFile(srcPath, []byte("payload"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dstDir := filepath.Join(tmp, "err")
+
+	for _, verify := range []string{"size", "sha256"} {
+		if _, err := MoveFileToDirFSVerify(shortCopyFS{}, srcPath, dstDir, verify); err == nil {
+			t.Fatalf("%s: expected error for a short copy", verify)
+		}
+		if _, err := os.Stat(srcPath); err != nil {
+			t.Fatalf("%s: expected source kept: %v", verify, err)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dstDir, "*")); len(left) != 0 {
+			t.Fatalf("%s: expected short copy removed, got %v", verify, left)
+		}
+	}
+
+	// Without verification the short copy goes unnoticed.
+	if _, err := MoveFileToDirFS(shortCopyFS{}, srcPath, dstDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(srcPath); !os.IsNotExist(err) {
+		t.Fatalf("expected source removed without verification, stat err=%v", err)
+	}
+}
+
+func TestMoveFileToDirFS_RefusesToCopyDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	srcDir := filepath.Join(tmp, "shards.warn")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "part-0000.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MoveFileToDirFS(shortCopyFS{}, srcDir, filepath.Join(tmp, "err")); err == nil {
+		t.Fatalf("expected a cross-device directory move to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "part-0000.json")); err != nil {
+		t.Fatalf("expected the directory left intact: %v", err)
+	}
+}
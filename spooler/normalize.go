@@ -3,8 +3,10 @@ package spooler
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 var timestampPatterns = []*regexp.Regexp{
@@ -18,19 +20,65 @@ var timestampPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`\d{4}-\d{1,2}-\d{1,2} \d{1,2}:\d{1,2}:\d{1,2}`),
 }
 
+// NormalizeOptions tunes NormalizeText beyond the built-in timestamp stripping.
+type NormalizeOptions struct {
+	// StripPrefixes are removed from the start of the text (after timestamps are stripped).
+	// Use CompileStripPrefixes to build them from config patterns.
+	StripPrefixes []*regexp.Regexp
+	// MaxBytes truncates the input to at most this many bytes (on a UTF-8 boundary)
+	// before it is normalized, so pathological inputs cost bounded regex work, hashing and
+	// storage. Texts that differ only past the cap hash the same. <= 0 means no cap.
+	MaxBytes int
+}
+
 func NormalizeText(input string) string {
+	return NormalizeTextWithOptions(input, NormalizeOptions{})
+}
+
+func NormalizeTextWithOptions(input string, opts NormalizeOptions) string {
 	s := input
+	if opts.MaxBytes > 0 && len(s) > opts.MaxBytes {
+		n := opts.MaxBytes
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
 	for _, re := range timestampPatterns {
 		s = re.ReplaceAllString(s, "")
 	}
 	s = strings.TrimSpace(s)
-	s = strings.Join(strings.Fields(s), " ")
-	return s
+	for _, re := range opts.StripPrefixes {
+		s = strings.TrimSpace(re.ReplaceAllString(s, ""))
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// CompileStripPrefixes compiles leading-token patterns (e.g. `\[(INFO|WARN)\]`).
+// Each pattern is anchored to the start of the text.
+func CompileStripPrefixes(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + p + ")")
+		if err != nil {
+			return nil, fmt.Errorf("invalid normalize strip prefix %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
 }
 
 func HashNormalized(normalized string, hexLen int) string {
 	sum := sha256.Sum256([]byte(normalized))
-	full := hex.EncodeToString(sum[:])
+	return truncateHash(hex.EncodeToString(sum[:]), hexLen)
+}
+
+// truncateHash cuts a hex digest to hexLen characters (<= 0 keeps it whole).
+func truncateHash(full string, hexLen int) string {
 	if hexLen <= 0 || hexLen >= len(full) {
 		return full
 	}
@@ -1,6 +1,9 @@
 package spooler
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestNormalizeHash(t *testing.T) {
 	text1 := "2025-06-01 15:30:00 foo error"
@@ -14,3 +17,52 @@ func TestNormalizeHash(t *testing.T) {
 		t.Fatalf("hash should match for normalized equivalent")
 	}
 }
+
+func TestNormalizeStripPrefixes(t *testing.T) {
+	prefixes, err := CompileStripPrefixes([]string{`\[(INFO|WARN|ERROR)\]`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NormalizeOptions{StripPrefixes: prefixes}
+	n1 := NormalizeTextWithOptions("[INFO] disk full", opts)
+	n2 := NormalizeTextWithOptions("2025-06-01 15:30:00 [WARN]  disk full", opts)
+	if n1 != "disk full" || n2 != "disk full" {
+		t.Fatalf("unexpected normalize: %q %q", n1, n2)
+	}
+	if HashNormalized(n1, 24) != HashNormalized(n2, 24) {
+		t.Fatalf("hash should match when prefixes are stripped")
+	}
+
+	// Off by default.
+	if got := NormalizeText("[INFO] disk full"); got != "[INFO] disk full" {
+		t.Fatalf("expected prefix kept by default, got %q", got)
+	}
+	// Only leading tokens are stripped.
+	if got := NormalizeTextWithOptions("disk [INFO] full", opts); got != "disk [INFO] full" {
+		t.Fatalf("expected non-leading token kept, got %q", got)
+	}
+}
+
+func TestNormalizeMaxBytes(t *testing.T) {
+	// The cap applies to the input: the timestamp (20 bytes) plus 16.
+	opts := NormalizeOptions{MaxBytes: 36}
+	long1 := "2025-06-01 15:30:00 disk full on volume A " + strings.Repeat("x", 1000)
+	long2 := "2025-06-02 11:22:33 disk full on volume A " + strings.Repeat("y", 5000)
+	n1 := NormalizeTextWithOptions(long1, opts)
+	n2 := NormalizeTextWithOptions(long2, opts)
+	if n1 != "disk full on vol" || n2 != n1 {
+		t.Fatalf("expected capped normalize, got %q %q", n1, n2)
+	}
+	if HashNormalized(n1, 24) != HashNormalized(n2, 24) {
+		t.Fatalf("hash should match for inputs sharing the capped prefix")
+	}
+
+	// Never splits a multi-byte rune.
+	if got := NormalizeTextWithOptions("abécd", NormalizeOptions{MaxBytes: 3}); got != "ab" {
+		t.Fatalf("expected cut before multi-byte rune, got %q", got)
+	}
+	// Off by default.
+	if got := NormalizeText(long1); len(got) <= 16 {
+		t.Fatalf("expected uncapped by default, got %d bytes", len(got))
+	}
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package spooler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isOpenForWrite reports whether any process (visible to us) holds path open for writing,
+// by scanning /proc/<pid>/fd links and the access mode in /proc/<pid>/fdinfo.
+func isOpenForWrite(path string) (bool, error) {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, err
+	}
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			// Process exited or belongs to another user.
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+			if fdWritable(filepath.Join("/proc", p.Name(), "fdinfo", fd.Name())) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// fdWritable parses the octal "flags:" line of an fdinfo file; O_WRONLY=1, O_RDWR=2.
+func fdWritable(fdinfoPath string) bool {
+	f, err := os.Open(fdinfoPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		v, ok := strings.CutPrefix(sc.Text(), "flags:")
+		if !ok {
+			continue
+		}
+		flags, err := strconv.ParseInt(strings.TrimSpace(v), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & 3
+		return mode == 1 || mode == 2
+	}
+	return false
+}
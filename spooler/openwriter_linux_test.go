@@ -0,0 +1,65 @@
+//go:build linux
+
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunner_SkipOpenFiles_SkipsUntilWriterCloses(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(alertDir, "open.warn")
+	w, err := os.OpenFile(src, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write(mustBuildFixtureJSON(t, "heart beat missing ZBBB")); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		SkipOpenFiles:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 0 {
+		t.Fatalf("expected no sends while file is open for writing, got %d", len(sender.Calls()))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected 1 send after writer closed, got %d", len(sender.Calls()))
+	}
+	if _, err := os.Stat(src); err == nil {
+		t.Fatalf("expected file deleted after send")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package spooler
+
+// isOpenForWrite is a no-op outside Linux: files are never reported as open.
+func isOpenForWrite(path string) (bool, error) {
+	return false, nil
+}
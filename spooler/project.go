@@ -0,0 +1,96 @@
+package spooler
+
+import "strings"
+
+// ProjectFields applies keep/drop lists of dotted paths (e.g. "code", "meta.host") to a
+// decoded JSON object. When keep is non-empty only those paths survive; drop paths are
+// then removed. Non-object items are returned unchanged; the input is never mutated.
+func ProjectFields(item any, keep []string, drop []string) any {
+	m, ok := item.(map[string]any)
+	if !ok || (len(keep) == 0 && len(drop) == 0) {
+		return item
+	}
+	if len(keep) > 0 {
+		kept := make(map[string]any)
+		for _, p := range keep {
+			copyPath(kept, m, splitFieldPath(p))
+		}
+		m = kept
+	}
+	for _, p := range drop {
+		m = dropPath(m, splitFieldPath(p))
+	}
+	return m
+}
+
+func splitFieldPath(p string) []string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, ".")
+}
+
+// copyPath copies src[path] into dst, creating intermediate objects as needed.
+func copyPath(dst map[string]any, src map[string]any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	v, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		dst[path[0]] = v
+		return
+	}
+	child, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	next, ok := dst[path[0]].(map[string]any)
+	if !ok {
+		next = make(map[string]any)
+		dst[path[0]] = next
+	}
+	copyPath(next, child, path[1:])
+}
+
+// lookupPath returns m[path], descending through nested objects.
+func lookupPath(m map[string]any, path []string) (any, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	v, ok := m[path[0]]
+	if !ok || len(path) == 1 {
+		return v, ok
+	}
+	child, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(child, path[1:])
+}
+
+// dropPath returns m without path, cloning the objects along the path.
+func dropPath(m map[string]any, path []string) map[string]any {
+	if len(path) == 0 {
+		return m
+	}
+	v, ok := m[path[0]]
+	if !ok {
+		return m
+	}
+	out := make(map[string]any, len(m))
+	for k, val := range m {
+		out[k] = val
+	}
+	if len(path) == 1 {
+		delete(out, path[0])
+		return out
+	}
+	if child, ok := v.(map[string]any); ok {
+		out[path[0]] = dropPath(child, path[1:])
+	}
+	return out
+}
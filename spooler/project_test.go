@@ -0,0 +1,30 @@
+package spooler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjectFields(t *testing.T) {
+	item := map[string]any{
+		"code":   "NIL_REPORT",
+		"detail": "disk full",
+		"blob":   map[string]any{"huge": "x", "host": "h1"},
+	}
+	got := ProjectFields(item, []string{"code", "blob.host"}, nil)
+	want := map[string]any{"code": "NIL_REPORT", "blob": map[string]any{"host": "h1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("keep: got %v, want %v", got, want)
+	}
+
+	got = ProjectFields(item, nil, []string{"blob.huge", "detail"})
+	want = map[string]any{"code": "NIL_REPORT", "blob": map[string]any{"host": "h1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("drop: got %v, want %v", got, want)
+	}
+
+	// The input is left intact.
+	if _, ok := item["blob"].(map[string]any)["huge"]; !ok || item["detail"] != "disk full" {
+		t.Fatalf("expected input not mutated, got %v", item)
+	}
+}
@@ -0,0 +1,191 @@
+package spooler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// QueueInput is a message queue polled on each run; every message is one JSON document
+// ingested like a file's content. Type selects the adapter: "redis" (a list, see
+// redisQueue).
+type QueueInput struct {
+	Type string `yaml:"type"`
+	Addr string `yaml:"addr"`
+	// Key is the list producers LPUSH onto; messages are consumed oldest first.
+	Key      string `yaml:"key"`
+	Password string `yaml:"password"`
+	// AlertType forces the alert type of the queue's events (default "unknown").
+	AlertType string `yaml:"alert_type"`
+}
+
+// queueSource is the adapter a QueueInput type implements. Peek returns the oldest message
+// without removing it (ok=false when the queue is empty); Ack removes it once it is sent
+// and archived, so a crash or failed send leaves it for the next run.
+type queueSource interface {
+	Peek(timeout time.Duration) (msg []byte, ok bool, err error)
+	Ack(msg []byte, timeout time.Duration) error
+	Close() error
+}
+
+type queue struct {
+	in     QueueInput
+	path   string
+	tag    string
+	source queueSource
+}
+
+func newQueues(inputs []QueueInput) ([]queue, error) {
+	out := make([]queue, 0, len(inputs))
+	for i, in := range inputs {
+		if strings.TrimSpace(in.Addr) == "" || strings.TrimSpace(in.Key) == "" {
+			return nil, fmt.Errorf("queue_inputs[%d]: addr and key are required", i)
+		}
+		switch in.Type {
+		case "", "redis":
+			out = append(out, queue{in: in, path: "redis://" + in.Addr + "/" + in.Key, tag: fmt.Sprintf("queue_inputs[%d]", i), source: newRedisQueue(in.Addr, in.Key, in.Password)})
+		default:
+			return nil, fmt.Errorf("queue_inputs[%d]: unsupported type %q (use redis)", i, in.Type)
+		}
+	}
+	return out, nil
+}
+
+// queuePollLimit caps the messages pollQueue takes from one queue per run, so a queue that
+// producers keep filling cannot hold a run without a Timeout forever; overridable in tests.
+var queuePollLimit = 1000
+
+// pollQueue ingests q's messages until it is empty (or queuePollLimit is reached): each
+// message's events are sent, archived with their own SentSyslog, and only then is the
+// message acknowledged; events whose send failed are left to resendPending. A failed send
+// or ack stops polling q for this run without failing it. A message is keyed by its SHA-256
+// (the events' FileDigestSHA256): one already archived, its ack having failed, is only
+// acknowledged, not archived and sent again.
+func (r *Runner) pollQueue(q queue, deadline time.Time, stats *runStats) error {
+	alertType := q.in.AlertType
+	if alertType == "" {
+		alertType = "unknown"
+	}
+	for seq := 0; seq < queuePollLimit; seq++ {
+		if isDeadlineExceeded(deadline) {
+			return ErrRunTimeout
+		}
+		msg, ok, err := q.source.Peek(remainingTimeout(deadline, 3*time.Second))
+		if err != nil {
+			return fmt.Errorf("queue %s: %w", q.path, err)
+		}
+		if !ok {
+			return nil
+		}
+		sum := sha256.Sum256(msg)
+		msgSHA := hex.EncodeToString(sum[:])
+		archived, err := r.queueMessageArchived(q.path, msgSHA)
+		if err != nil {
+			return err
+		}
+		if archived {
+			r.debugf("queue: message already archived, acking path=%q sha=%s", q.path, msgSHA)
+			if !r.ackQueueMessage(q, msg, deadline) {
+				return nil
+			}
+			continue
+		}
+		events := r.queueMessageEvents(msg, msgSHA, q.path, alertType, seq, stats)
+		for i := range events {
+			events[i].InputTag = q.tag
+		}
+		withAlertTypeSrc(events, "forced")
+		allSent := r.sendNewEvents(q.path, events, deadline, stats)
+		local := events
+		undo := func() {}
+		if r.routeByEventTime() {
+			if local, _, undo, err = r.insertOtherMonthEvents(events); err != nil {
+				return err
+			}
+		}
+		if len(local) > 0 {
+			if err := r.db.CreateInBatches(&local, r.insertBatchSize()).Error; err != nil {
+				undo()
+				return err
+			}
+		}
+		if !r.ackQueueMessage(q, msg, deadline) {
+			return nil
+		}
+		if stats != nil {
+			stats.MessagesIngested++
+		}
+		r.debugf("queue: path=%q events=%d", q.path, len(events))
+		if !allSent {
+			// Quiet-hours events wait in the DB like any archived event; a failed send
+			// means the receiver is likely down, so the rest of the queue waits too.
+			for _, ev := range events {
+				if !ev.SentSyslog && !ev.Suppressed {
+					log.Printf("warn: queue %s: send failed, polling stopped for this run (pending events are resent)", q.path)
+					return nil
+				}
+			}
+		}
+	}
+	r.debugf("queue: poll limit reached path=%q limit=%d", q.path, queuePollLimit)
+	return nil
+}
+
+// ackQueueMessage acknowledges msg on q, reporting whether polling can go on. A failed
+// ack is logged: the message stays on the queue and is only acknowledged by a later run
+// (see queueMessageArchived).
+func (r *Runner) ackQueueMessage(q queue, msg []byte, deadline time.Time) bool {
+	if err := q.source.Ack(msg, remainingTimeout(deadline, 3*time.Second)); err != nil {
+		log.Printf("warn: queue %s: ack failed, polling stopped for this run: %v", q.path, err)
+		return false
+	}
+	return true
+}
+
+// queueMessageArchived reports whether the events of the message with SHA-256 msgSHA from
+// the queue at path are already archived.
+func (r *Runner) queueMessageArchived(path string, msgSHA string) (bool, error) {
+	dbs, err := r.eventDBs()
+	if err != nil {
+		return false, err
+	}
+	for _, db := range dbs {
+		var n int64
+		if err := db.Model(&SpoolEvent{}).Where("source_path = ? AND file_sha256 = ?", path, msgSHA).Count(&n).Error; err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queueMessageEvents builds the events for one queue message, like followLineEvents; seq
+// (the message's position in this poll) is their EventIndex and msgSHA, the message's
+// SHA-256, their FileDigestSHA256.
+func (r *Runner) queueMessageEvents(msg []byte, msgSHA string, path string, alertType string, seq int, stats *runStats) []SpoolEvent {
+	raw := string(msg)
+
+	var decoded any
+	if err := json.Unmarshal(msg, &decoded); err != nil {
+		r.warnDecodeError(fmt.Sprintf("%s#%d", path, seq), msg, err, stats)
+		ev := newErrorEvent(path, "other", alertType, msgSHA, raw, err)
+		ev.EventIndex = seq
+		return []SpoolEvent{ev}
+	}
+	events, err := r.toEvents(decoded, raw, path, "other", alertType, msgSHA, hashSpec{}, "", stats)
+	if err != nil {
+		ev := newErrorEvent(path, "other", alertType, msgSHA, raw, err)
+		ev.EventIndex = seq
+		return []SpoolEvent{ev}
+	}
+	for i := range events {
+		events[i].EventIndex = seq
+	}
+	return events
+}
@@ -0,0 +1,262 @@
+package spooler
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis serves LINDEX/LREM on in-memory lists over RESP, enough for redisQueue.
+type fakeRedis struct {
+	mu    sync.Mutex
+	lists map[string][]string
+	ln    net.Listener
+	// failLREM makes that many LREM calls fail.
+	failLREM int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{lists: map[string][]string{}, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// lpush pushes msgs onto the head of key, like LPUSH.
+func (f *fakeRedis) lpush(key string, msgs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range msgs {
+		f.lists[key] = append([]string{m}, f.lists[key]...)
+	}
+}
+
+func (f *fakeRedis) list(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.lists[key]...)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readRESP(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, it := range items {
+			b, _ := it.([]byte)
+			args[i] = string(b)
+		}
+		if _, err := conn.Write([]byte(f.exec(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "LINDEX":
+		l := f.lists[args[1]]
+		if len(l) == 0 {
+			return "$-1\r\n"
+		}
+		v := l[len(l)-1]
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "LREM":
+		if f.failLREM > 0 {
+			f.failLREM--
+			return "-ERR injected failure\r\n"
+		}
+		l := f.lists[args[1]]
+		for i := len(l) - 1; i >= 0; i-- {
+			if l[i] == args[3] {
+				f.lists[args[1]] = append(l[:i:i], l[i+1:]...)
+				return ":1\r\n"
+			}
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func newQueueRunner(t *testing.T, addr string) *Runner {
+	t.Helper()
+	tmp := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		QueueInputs:  []QueueInput{{Type: "redis", Addr: addr, Key: "alerts", AlertType: "business"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { runner.Close() })
+	return runner
+}
+
+func TestRunner_RedisQueueIngestsAndAcksAfterSend(t *testing.T) {
+	redis := newFakeRedis(t)
+	redis.lpush("alerts", `{"detail":"first ZBBB"}`, `{"detail":"second ZBBB"}`, `not json`)
+	runner := newQueueRunner(t, redis.ln.Addr().String())
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 sends, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].message, "first") || !strings.Contains(calls[1].message, "second") {
+		t.Fatalf("expected messages oldest first, got %q, %q", calls[0].message, calls[1].message)
+	}
+	if !strings.Contains(calls[2].structuredData, `error="decode"`) {
+		t.Fatalf("expected the bad message shipped as a decode error, got %q", calls[2].structuredData)
+	}
+	if got := redis.list("alerts"); len(got) != 0 {
+		t.Fatalf("expected every message acked, left %v", got)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 archived events, got %d", len(events))
+	}
+	for _, ev := range events {
+		if !ev.SentSyslog || ev.AlertType != "business" || ev.SourcePath != "redis://"+redis.ln.Addr().String()+"/alerts" {
+			t.Fatalf("unexpected archived event %+v", ev)
+		}
+	}
+}
+
+func TestRunner_RedisQueueArchivesFailedSendAndStopsPolling(t *testing.T) {
+	redis := newFakeRedis(t)
+	redis.lpush("alerts", `[{"detail":"first ZBBB"},{"detail":"second ZBBB"}]`, `{"detail":"third ZBBB"}`)
+	runner := newQueueRunner(t, redis.ln.Addr().String())
+	sender := &mockSyslogSender{}
+	// The message's first event fails; the in-run resend delivers it.
+	sender.FailNext(1)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatalf("expected a failed send not to fail the run, got %v", err)
+	}
+	if got := redis.list("alerts"); len(got) != 1 || !strings.Contains(got[0], "third") {
+		t.Fatalf("expected the first message acked and polling stopped before the next, got %v", got)
+	}
+	var events []SpoolEvent
+	if err := runner.db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[0].SentSyslog || !events[1].SentSyslog {
+		t.Fatalf("expected both events archived and the failed one resent, got %+v", events)
+	}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var first, second, third int
+	for _, c := range sender.Calls() {
+		switch {
+		case strings.Contains(c.message, "first"):
+			first++
+		case strings.Contains(c.message, "second"):
+			second++
+		case strings.Contains(c.message, "third"):
+			third++
+		}
+	}
+	if first != 2 || second != 1 || third != 1 || len(redis.list("alerts")) != 0 {
+		t.Fatalf("expected only the failed event resent, got first=%d second=%d third=%d, queue %v", first, second, third, redis.list("alerts"))
+	}
+}
+
+func TestRunner_RedisQueueAckFailureDoesNotArchiveTwice(t *testing.T) {
+	redis := newFakeRedis(t)
+	redis.lpush("alerts", `{"detail":"first ZBBB"}`)
+	redis.failLREM = 1
+	runner := newQueueRunner(t, redis.ln.Addr().String())
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatalf("expected a failed ack not to fail the run, got %v", err)
+	}
+	if got := redis.list("alerts"); len(got) != 1 {
+		t.Fatalf("expected the message left on the queue, got %v", got)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := redis.list("alerts"); len(got) != 0 {
+		t.Fatalf("expected the message acked by the next run, got %v", got)
+	}
+	var n int64
+	if err := runner.db.Model(&SpoolEvent{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(sender.Calls()) != 1 {
+		t.Fatalf("expected the message archived and sent once, got %d events, %d sends", n, len(sender.Calls()))
+	}
+}
+
+func TestRunner_RedisQueuePollLimit(t *testing.T) {
+	old := queuePollLimit
+	queuePollLimit = 2
+	defer func() { queuePollLimit = old }()
+	redis := newFakeRedis(t)
+	redis.lpush("alerts", `{"detail":"first ZBBB"}`, `{"detail":"second ZBBB"}`, `{"detail":"third ZBBB"}`)
+	runner := newQueueRunner(t, redis.ln.Addr().String())
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := redis.list("alerts"); len(got) != 1 || !strings.Contains(got[0], "third") {
+		t.Fatalf("expected the run to stop after 2 messages, got %v", got)
+	}
+}
+
+func TestNewRunner_QueueInputValidation(t *testing.T) {
+	tmp := t.TempDir()
+	for _, in := range []QueueInput{{Type: "kafka", Addr: "a:1", Key: "k"}, {Type: "redis", Addr: "a:1"}} {
+		_, err := NewRunner(RunnerConfig{
+			DBFolder:    tmp,
+			JobLabel:    "mhdbs",
+			QueueInputs: []QueueInput{in},
+			SyslogAddr:  "127.0.0.1:1",
+		})
+		if err == nil || !strings.Contains(err.Error(), "queue_inputs[0]") {
+			t.Fatalf("expected a queue_inputs error for %+v, got %v", in, err)
+		}
+	}
+}
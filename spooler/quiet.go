@@ -0,0 +1,121 @@
+package spooler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window during which matching events are archived but not shipped.
+// AlertTypes and Levels narrow the events it applies to (empty matches any). Start and End
+// are "HH:MM" in QuietHoursTZ; an End at or before Start wraps past midnight ("22:00" to
+// "07:00"), and equal times cover the whole day. With Reemit the suppressed events stay
+// pending and are sent by the first run after the window; otherwise they are recorded as
+// sent without being shipped.
+type QuietHours struct {
+	AlertTypes []string `yaml:"alert_types"`
+	Levels     []string `yaml:"levels"`
+	Start      string   `yaml:"start"`
+	End        string   `yaml:"end"`
+	Reemit     bool     `yaml:"reemit"`
+}
+
+// defaultQuietHoursTZ is the QuietHoursTZ default, the zone notifier times are read in
+// (see parseTimeString).
+const defaultQuietHoursTZ = "Asia/Shanghai"
+
+type quietWindow struct {
+	alertTypes map[string]struct{}
+	levels     map[string]struct{}
+	// start and end are minutes after midnight in loc.
+	start, end int
+	loc        *time.Location
+	reemit     bool
+}
+
+func newQuietWindows(cfg []QuietHours, tz string) ([]quietWindow, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(tz) == "" {
+		tz = defaultQuietHoursTZ
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("quiet_hours_tz: %w", err)
+	}
+	out := make([]quietWindow, 0, len(cfg))
+	for i, q := range cfg {
+		start, err := parseClock(q.Start)
+		if err != nil {
+			return nil, fmt.Errorf("quiet_hours[%d]: start: %w", i, err)
+		}
+		end, err := parseClock(q.End)
+		if err != nil {
+			return nil, fmt.Errorf("quiet_hours[%d]: end: %w", i, err)
+		}
+		for _, level := range q.Levels {
+			switch strings.TrimSpace(level) {
+			case "warning", "critical", "unknown":
+			default:
+				return nil, fmt.Errorf("quiet_hours[%d]: unsupported level %q (use warning, critical or unknown)", i, level)
+			}
+		}
+		out = append(out, quietWindow{alertTypes: stringSet(q.AlertTypes), levels: stringSet(q.Levels), start: start, end: end, loc: loc, reemit: q.Reemit})
+	}
+	return out, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func stringSet(items []string) map[string]struct{} {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make(map[string]struct{}, len(items))
+	for _, it := range items {
+		out[strings.TrimSpace(it)] = struct{}{}
+	}
+	return out
+}
+
+// active reports whether t falls inside the window.
+func (w quietWindow) active(t time.Time) bool {
+	lt := t.In(w.loc)
+	m := lt.Hour()*60 + lt.Minute()
+	if w.end > w.start {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+func (w quietWindow) matches(ev SpoolEvent) bool {
+	if w.alertTypes != nil {
+		if _, ok := w.alertTypes[ev.AlertType]; !ok {
+			return false
+		}
+	}
+	if w.levels != nil {
+		if _, ok := w.levels[ev.AlertLevel]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// quietWindow returns the first quiet window that holds ev at t.
+func (r *Runner) quietWindow(ev SpoolEvent, t time.Time) (quietWindow, bool) {
+	for _, w := range r.quiet {
+		if w.matches(ev) && w.active(t) {
+			return w, true
+		}
+	}
+	return quietWindow{}, false
+}
@@ -0,0 +1,175 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietWindow_Active(t *testing.T) {
+	windows, err := newQuietWindows([]QuietHours{{Start: "22:00", End: "07:00"}, {Start: "09:00", End: "17:30"}}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hh, mm int) time.Time { return time.Date(2026, 2, 7, hh, mm, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		w    int
+		t    time.Time
+		want bool
+	}{
+		{0, at(23, 0), true},
+		{0, at(6, 59), true},
+		{0, at(7, 0), false},
+		{0, at(12, 0), false},
+		{1, at(9, 0), true},
+		{1, at(17, 30), false},
+	} {
+		if got := windows[tc.w].active(tc.t); got != tc.want {
+			t.Fatalf("window %d at %s: expected active=%v", tc.w, tc.t.Format("15:04"), tc.want)
+		}
+	}
+	if _, err := newQuietWindows([]QuietHours{{Start: "25:00", End: "07:00"}}, ""); err == nil {
+		t.Fatalf("expected an invalid start to be rejected")
+	}
+	if _, err := newQuietWindows([]QuietHours{{Levels: []string{"warn"}, Start: "22:00", End: "07:00"}}, ""); err == nil {
+		t.Fatalf("expected an invalid level to be rejected")
+	}
+}
+
+func TestRunner_QuietHoursSuppressWarningButShipCritical(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(`{"code":"PUMP","detail":"pump slow quiet ZBBB","status":"1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "b.alarm"), []byte(`{"code":"PUMP","detail":"pump stopped loud ZBBB","status":"2"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}, {Glob: filepath.Join(tmp, "*.alarm")}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		// Equal start and end: quiet all day.
+		QuietHours: []QuietHours{{Levels: []string{"warning"}, Start: "00:00", End: "00:00"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].message, "loud") {
+		t.Fatalf("expected only the critical event shipped, got %+v", calls)
+	}
+
+	var ev SpoolEvent
+	if err := runner.db.Where("source_path = ?", filepath.Join(tmp, "a.warn")).First(&ev).Error; err != nil {
+		t.Fatalf("expected the warning event archived: %v", err)
+	}
+	if !ev.Suppressed || !ev.SentSyslog || ev.SentAt != nil {
+		t.Fatalf("expected a suppressed, not shipped event, got suppressed=%v sent=%v sent_at=%v", ev.Suppressed, ev.SentSyslog, ev.SentAt)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "a.warn")); !os.IsNotExist(err) {
+		t.Fatalf("expected the suppressed file finalized, stat err=%v", err)
+	}
+}
+
+func TestRunner_QuietHoursReemitAfterWindow(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), mustBuildFixtureJSON(t, "detail quiet ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		QuietHours:   []QuietHours{{Start: "00:00", End: "00:00", Reemit: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	for i := 0; i < 2; i++ {
+		if err := runner.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(sender.Calls()); n != 0 {
+		t.Fatalf("expected nothing sent inside the window, got %d", n)
+	}
+
+	// The window is over.
+	runner.quiet = nil
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].structuredData, `quiet="true"`) {
+		t.Fatalf("expected the held event re-emitted with quiet=\"true\", got %+v", calls)
+	}
+}
+
+func TestRunner_QuietHoursHoldFailedResendAndDrain(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), mustBuildFixtureJSON(t, "detail quiet ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	// The send and its in-run resend fail, before the window opens.
+	sender.FailNext(2)
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The window opens: the pending event is held rather than paged, and a drain does not
+	// wait for it.
+	runner.quiet, err = newQuietWindows([]QuietHours{{Start: "00:00", End: "00:00", Reemit: true}}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Drain(3, 0); err != nil {
+		t.Fatalf("expected the drain to end with only held events left: %v", err)
+	}
+	if n := len(sender.Calls()); n != 2 {
+		t.Fatalf("expected no resend inside the window, got %d calls", n)
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Suppressed || ev.SentSyslog {
+		t.Fatalf("expected the event held for re-emission, got suppressed=%v sent=%v", ev.Suppressed, ev.SentSyslog)
+	}
+}
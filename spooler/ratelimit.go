@@ -0,0 +1,46 @@
+package spooler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sendLimiter paces sends to at most one per interval across goroutines (a token bucket
+// holding a single token), so a burst reaches the receiver at a steady rate.
+type sendLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newSendLimiter returns a limiter for perSecond sends a second, or nil (unlimited) when
+// perSecond <= 0.
+func newSendLimiter(perSecond float64) *sendLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &sendLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next send slot. It fails without taking the slot when the slot
+// falls after deadline (zero means none).
+func (l *sendLimiter) wait(deadline time.Time) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if !deadline.IsZero() && slot.After(deadline) {
+		l.mu.Unlock()
+		return fmt.Errorf("%w waiting for send rate limit", ErrRunTimeout)
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(slot.Sub(now))
+	return nil
+}
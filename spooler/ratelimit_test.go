@@ -0,0 +1,60 @@
+package spooler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunner_MaxSendRatePacesSends(t *testing.T) {
+	tmp := t.TempDir()
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(tmp, fmt.Sprintf("f%d.warn", i))
+		if err := os.WriteFile(name, mustBuildFixtureJSON(t, fmt.Sprintf("detail %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:    tmp,
+		DBPrefix:    "spooler_",
+		JobLabel:    "mhdbs",
+		InputGlobs:  []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:  "127.0.0.1:1",
+		MaxSendRate: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	mock := &mockSyslogSender{}
+	runner.syslog = mock
+
+	start := time.Now()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if got := len(mock.Calls()); got != 5 {
+		t.Fatalf("expected 5 sends, got %d", got)
+	}
+	// 5 sends at 50/s: the first is immediate, the other four 20ms apart.
+	if elapsed < 75*time.Millisecond {
+		t.Fatalf("expected sends paced to ~80ms, took %s", elapsed)
+	}
+}
+
+func TestSendLimiter_FailsPastDeadline(t *testing.T) {
+	l := newSendLimiter(1)
+	if err := l.wait(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(time.Now().Add(100 * time.Millisecond)); err == nil {
+		t.Fatalf("expected the next slot (1s away) to miss the deadline")
+	}
+	if newSendLimiter(0) != nil {
+		t.Fatalf("expected a nil limiter for rate 0")
+	}
+}
@@ -0,0 +1,157 @@
+package spooler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReconcileResult counts the processed-file rows Reconcile checked and corrected.
+type ReconcileResult struct {
+	Checked int
+	// MarkedDeleted counts rows whose file is gone (or now has other content) that were not
+	// marked deleted.
+	MarkedDeleted int
+	// Requeued counts rows marked deleted whose file is still there unchanged; they are
+	// finalized (deleted) again by the next run.
+	Requeued int
+	// AllSentFixed counts rows whose all_sent disagreed with their events.
+	AllSentFixed int
+}
+
+// Reconcile brings the processed-file rows of every DB (each monthly DB, or the legacy
+// single DB) back in line with the filesystem after manual intervention: all_sent is
+// recomputed from the file's events, rows of files no longer on disk are marked deleted,
+// and rows marked deleted whose file (same sha256) is still present are re-queued for
+// finalization. Nothing is sent or deleted here.
+func (r *Runner) Reconcile() (ReconcileResult, error) {
+	var res ReconcileResult
+	if err := r.ensureDBForNow(time.Time{}); err != nil {
+		return res, err
+	}
+	defer r.closeMonthDBs()
+	eventDBs, err := r.eventDBs()
+	if err != nil {
+		return res, err
+	}
+	dbs := []*gorm.DB{r.db}
+	if strings.TrimSpace(r.cfg.DBFolder) != "" {
+		paths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			return res, err
+		}
+		for _, p := range paths {
+			month, ok := parseMonthlyDBKey(filepath.Base(p), r.cfg.DBPrefix)
+			if !ok || monthKey(month) == r.dbKey {
+				continue
+			}
+			db, err := r.dbForMonth(month)
+			if err != nil {
+				return res, err
+			}
+			dbs = append(dbs, db)
+		}
+	}
+	for _, db := range dbs {
+		// A file's events are in its own DB, or with DBByEventTime in any of eventDBs.
+		counted := []*gorm.DB{db}
+		for _, edb := range eventDBs {
+			if edb != db {
+				counted = append(counted, edb)
+			}
+		}
+		if err := r.reconcileDB(db, counted, &res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// reconcileDB is Reconcile for the processed-file rows of db, counting their events in
+// eventDBs.
+func (r *Runner) reconcileDB(db *gorm.DB, eventDBs []*gorm.DB, res *ReconcileResult) error {
+	batchSize := r.cfg.FinalizeBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultFinalizeBatchSize
+	}
+	var lastID uint
+	for {
+		var pfs []ProcessedFile
+		if err := db.Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&pfs).Error; err != nil {
+			return err
+		}
+		if len(pfs) == 0 {
+			break
+		}
+		lastID = pfs[len(pfs)-1].ID
+
+		counts, err := countFileEvents(eventDBs, pfs)
+		if err != nil {
+			return err
+		}
+		for _, pf := range pfs {
+			res.Checked++
+			updates := map[string]any{}
+			if c := counts[fileEventKey{Path: pf.Path, SHA256: pf.SHA256}]; c.Total > 0 && (c.Sent == c.Total) != pf.AllSent {
+				updates["all_sent"] = c.Sent == c.Total
+				res.AllSentFixed++
+			}
+			present, err := r.fileHasSHA(pf.Path, pf.SHA256)
+			if err != nil {
+				log.Printf("warn: reconcile: skip %s: %v", pf.Path, err)
+				continue
+			}
+			switch {
+			case present && pf.Deleted:
+				updates["deleted"] = false
+				updates["deleted_at"] = nil
+				updates["last_error"] = ""
+				res.Requeued++
+			case !present && !pf.Deleted:
+				now := time.Now().UTC()
+				updates["deleted"] = true
+				updates["deleted_at"] = &now
+				updates["last_error"] = "file missing"
+				res.MarkedDeleted++
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			r.debugf("reconcile path=%q updates=%v", pf.Path, updates)
+			if err := db.Model(&ProcessedFile{}).Where("id = ?", pf.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if len(pfs) < batchSize {
+			break
+		}
+	}
+	return nil
+}
+
+// fileHasSHA reports whether path (a file, or a shard directory as merged by readShards)
+// exists with the given content sha256. A missing path is not an error.
+func (r *Runner) fileHasSHA(path string, sha string) (bool, error) {
+	var content []byte
+	var err error
+	if r.isShardDir(path) {
+		content, err = r.readShards(path)
+	} else {
+		content, err = r.fs.ReadFile(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]) == sha, nil
+}
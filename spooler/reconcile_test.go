@@ -0,0 +1,113 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunner_ReconcileFixesDrift(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "one.warn")
+	content := mustBuildFixtureJSON(t, "detail ZBBB")
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		InputGlobs:      []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:      "127.0.0.1:1",
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone restores the deleted file by hand, and another row points at a file that
+	// was removed behind the spooler's back.
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gone := ProcessedFile{Path: filepath.Join(tmp, "gone.warn"), SHA256: "x", AllSent: true}
+	if err := runner.db.Create(&gone).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := runner.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 2 || res.Requeued != 1 || res.MarkedDeleted != 1 {
+		t.Fatalf("unexpected reconcile result: %+v", res)
+	}
+	var pf ProcessedFile
+	if err := runner.db.Where("path = ?", src).First(&pf).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pf.Deleted || pf.DeletedAt != nil {
+		t.Fatalf("expected the restored file re-queued, got %+v", pf)
+	}
+	if err := runner.db.First(&gone, gone.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !gone.Deleted || gone.LastError != "file missing" {
+		t.Fatalf("expected the missing file marked deleted, got %+v", gone)
+	}
+
+	// The next run finalizes the re-queued file without sending it again.
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected the re-queued file deleted, stat err=%v", err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected no resend of the re-queued file, got %d calls", len(sender.Calls()))
+	}
+}
+
+func TestRunner_ReconcileCoversPreviousMonthDBs(t *testing.T) {
+	tmp := t.TempDir()
+	prev, err := OpenDB(monthlyDBPath(tmp, "spooler_", time.Now().AddDate(0, -1, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := ProcessedFile{Path: filepath.Join(tmp, "gone.warn"), SHA256: "x", AllSent: true}
+	if err := prev.Create(&gone).Error; err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	res, err := runner.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 1 || res.MarkedDeleted != 1 {
+		t.Fatalf("expected the previous month's row reconciled, got %+v", res)
+	}
+	if err := prev.First(&gone, gone.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !gone.Deleted || gone.LastError != "file missing" {
+		t.Fatalf("expected the missing file marked deleted, got %+v", gone)
+	}
+}
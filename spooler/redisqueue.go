@@ -0,0 +1,167 @@
+package spooler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisQueue is the "redis" queueSource: a list consumed from its tail (producers LPUSH).
+// It speaks just enough RESP for LINDEX/LREM (and AUTH), so the core has no Redis
+// dependency. One connection is dialed lazily and reused until an error or Close.
+type redisQueue struct {
+	addr     string
+	key      string
+	password string
+
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newRedisQueue(addr string, key string, password string) *redisQueue {
+	return &redisQueue{addr: addr, key: key, password: password}
+}
+
+// Peek returns the list's tail element.
+func (q *redisQueue) Peek(timeout time.Duration) ([]byte, bool, error) {
+	reply, err := q.do(timeout, "LINDEX", q.key, "-1")
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	msg, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis LINDEX: unexpected reply %v", reply)
+	}
+	return msg, true, nil
+}
+
+// Ack removes msg, searching from the tail where Peek found it.
+func (q *redisQueue) Ack(msg []byte, timeout time.Duration) error {
+	reply, err := q.do(timeout, "LREM", q.key, "-1", string(msg))
+	if err != nil {
+		return err
+	}
+	if n, ok := reply.(int64); !ok || n != 1 {
+		return fmt.Errorf("redis LREM: message not found (reply %v)", reply)
+	}
+	return nil
+}
+
+func (q *redisQueue) Close() error {
+	if q.conn == nil {
+		return nil
+	}
+	err := q.conn.Close()
+	q.conn, q.rd = nil, nil
+	return err
+}
+
+// do sends one command and reads its reply: []byte (bulk string, nil when absent), int64,
+// string (status) or []any. Error replies are returned as errors; on I/O errors the
+// connection is dropped and redialed by the next command.
+func (q *redisQueue) do(timeout time.Duration, args ...string) (any, error) {
+	if q.conn == nil {
+		if err := q.connect(timeout); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := q.roundTrip(timeout, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = q.Close()
+	}
+	return reply, err
+}
+
+func (q *redisQueue) connect(timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", q.addr, timeout)
+	if err != nil {
+		return err
+	}
+	q.conn, q.rd = conn, bufio.NewReader(conn)
+	if q.password != "" {
+		if _, err := q.roundTrip(timeout, []string{"AUTH", q.password}); err != nil {
+			_ = q.Close()
+			return fmt.Errorf("redis AUTH: %w", err)
+		}
+	}
+	return nil
+}
+
+func (q *redisQueue) roundTrip(timeout time.Duration, args []string) (any, error) {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = q.conn.SetDeadline(deadline)
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(q.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(q.rd)
+}
+
+// redisError is an error reply ("-ERR ..."); the connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func readRESP(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRESP(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
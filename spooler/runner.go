@@ -1,17 +1,25 @@
 package spooler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"log"
@@ -25,15 +33,116 @@ type RunnerConfig struct {
 	// Monthly rolling DB settings (recommended).
 	DBFolder string
 	DBPrefix string
-	JobLabel string
-	Debug    bool
+	// DBByEventTime routes each event to the monthly DB of its event time
+	// (falling back to ArchivedAt) instead of the current wall-clock month.
+	// Only applies with DBFolder; ProcessedFile rows stay in the current DB.
+	DBByEventTime bool
+	// MaxDBScan bounds resend (DBByEventTime) and replay to the most recent N monthly DBs
+	// (default 24); < 0 scans all of them. Pending events left in older DBs are logged.
+	MaxDBScan int
+	JobLabel  string
+	Debug     bool
 	// Legacy globs. Prefer Inputs.
 	InputGlobs []string
 	// Notifier-style inputs: each input has its own alert type.
-	Inputs       []InputSpec
+	Inputs []InputSpec
+	// DecodeRetries is how many runs an input file that is not valid JSON is left in place
+	// and retried (e.g. still being written) before it is archived as a decode error and
+	// moved to its error dir. 0 archives it on the first failure.
+	DecodeRetries int
+	// MoveVerify checks the copy before the source is removed when a move to an error dir
+	// falls back to copy+remove (cross-device): "" (off), "size" or "sha256".
+	MoveVerify string
+	// FollowPath is a single growing NDJSON file tailed on each run (see followFile).
+	FollowPath string
+	// QueueInputs are message queues (e.g. a Redis list) polled after the files on each run;
+	// a message is acknowledged once its events are sent (or failed) and archived (see pollQueue).
+	QueueInputs []QueueInput
+	// QuietHours are daily windows in which matching new events (and pending resends) are
+	// archived (Suppressed) instead of shipped, optionally re-emitted after the window.
+	// QuietHoursTZ is the zone of their times (default Asia/Shanghai).
+	QuietHours   []QuietHours
+	QuietHoursTZ string
 	SyslogAddr   string
-	ServiceLabel string
-	HashHexLen   int
+	// Output selects the event sink: "syslog" (default, TCP RFC5424) or "journald".
+	Output string
+	// JournaldSocket overrides DefaultJournaldSocket for Output "journald".
+	JournaldSocket string
+	// DryRun builds events for new input files and hands them to a LineWriter instead of
+	// the output, without touching the DB or the files. DryRunOut receives the would-be
+	// RFC5424 lines (empty discards them; only counts are logged), gzipped when it ends
+	// in ".gz".
+	DryRun    bool
+	DryRunOut string
+	// RunSummary prints one summary line per run to stdout (see summaryLine), independent
+	// of Debug, for cron mail and interactive use.
+	RunSummary bool
+	// AuditDir, when set, receives a JSON-lines copy (labels + payload) of every shipped
+	// event in monthly audit_<YYYYMM>.jsonl files. Audit writes are best-effort and never
+	// affect sending or deletion.
+	AuditDir string
+	// AuditGzip writes audit_<YYYYMM>.jsonl.gz instead, one gzip member per run (readers
+	// such as zcat and gzip.Reader see one continuous stream).
+	AuditGzip bool
+	// AuditIndent writes each audit record pretty-printed (payload nested as JSON) for human
+	// review; the files are then a stream of JSON documents rather than JSON lines. Syslog
+	// payloads stay compact.
+	AuditIndent bool
+	// SpillDir, when set, receives the syslog line of every new event whose send failed, one
+	// <db>_<id>.syslog file each, so what is stuck stays visible on the host while the
+	// receiver is down. Each run first drains the directory (see drainSpill); the DB stays
+	// the source of truth. Requires the syslog output.
+	SpillDir string
+	// FlushOnly skips scanning and ingesting inputs: a run only resends pending events and
+	// finalizes (deletes) fully sent files, then sends the deadman. For outage recovery
+	// when the input directories are huge.
+	FlushOnly bool
+	// Seed ingests, archives and finalizes input files like a normal run but never sends:
+	// new events are stored as Seeded (and sent), so a backlog present at first deploy is
+	// recorded as processed without being shipped. No resend or deadman is sent either.
+	Seed bool
+	// SyslogNoDelay sets TCP_NODELAY on syslog connections; nil means true.
+	SyslogNoDelay *bool
+	// SyslogKeepAlive enables TCP keep-alive with this period when > 0.
+	SyslogKeepAlive time.Duration
+	// SyslogFacility (0-23) and SyslogSeverity (0-7) set the PRI of every line (facility*8 +
+	// severity), e.g. to route alerts by facility; nil means local0.info (PRI 134).
+	SyslogFacility *int
+	SyslogSeverity *int
+	// SyslogNetwork is the network for SyslogAddr and SyslogDestinations: "tcp" (default),
+	// "udp", "unix" or "unixgram" (SyslogAddr is then the socket path).
+	SyslogNetwork string
+	// SyslogFormat is the syslog line format: "rfc5424" (default) or "rfc3164" for
+	// legacy BSD receivers (structured data folded into the message as key=value pairs).
+	SyslogFormat string
+	// SyslogFraming is the TCP/unix stream framing: "lf" (default, newline-delimited) or
+	// "octet" (RFC6587 octet counting) for strict receivers.
+	SyslogFraming string
+	// SyslogTLS enables TLS for the tcp syslog connections (SyslogAddr and
+	// SyslogDestinations); a failed handshake is a send error, leaving the event pending.
+	SyslogTLS SyslogTLSConfig
+	// SyslogMaxConns caps concurrently open syslog connections (0 = unlimited).
+	SyslogMaxConns int
+	// SyslogHostname overrides the RFC5424 HOSTNAME (default os.Hostname()), e.g. inside
+	// containers whose hostname is a random id.
+	SyslogHostname string
+	// MaxSendRate caps new and resent events at this many per second across workers
+	// (0 = unlimited); waits count against Timeout. Replay is not paced.
+	MaxSendRate float64
+	// SendRetries is how many more times a failed send is tried within the run before the
+	// event is left pending; SendBackoff is the first wait (default 200ms), doubled after
+	// each failure up to 10s. Waits count against Timeout. Once a receiver's retries run
+	// out, later events of the run try it once each until a send succeeds.
+	SendRetries int
+	SendBackoff time.Duration
+	// SyslogDestinations are extra syslog receivers sent every event after the primary
+	// output, each with an optional structured-data label allowlist. Not used in dry-run.
+	SyslogDestinations []SyslogDestination
+	ServiceLabel       string
+	HashHexLen         int
+	// HashScope salts ContentHash with "alert_type" and/or "cccc" so dedup is scoped per
+	// type/code. Empty (default) hashes the text only.
+	HashScope []string
 	// Deprecated: CCCCEnabled is ignored. CCCC tagging is enabled when CCCCCodes is non-empty.
 	CCCCEnabled     bool
 	CCCCCodes       []string
@@ -41,22 +150,200 @@ type RunnerConfig struct {
 	Timeout         time.Duration
 	DeadmanToken    string
 	ReplayFrom      time.Time
+	// ReplayDest limits replay to one destination: "primary" (SyslogAddr/Output) or the
+	// name (or addr) of a SyslogDestinations entry. Empty replays to all of them.
+	ReplayDest string
+	// ReplayForce resends events already replayed to the same destination (ReplayLog);
+	// by default a repeated replay over the same window skips them.
+	ReplayForce bool
+	// SyslogTimestampFromEvent sets the RFC5424 TIMESTAMP from the event's own time
+	// (see eventTime) instead of the send time, falling back to now when unknown.
+	SyslogTimestampFromEvent bool
+	// Version is reported in lifecycle events (SendLifecycle).
+	Version string
 	// FixedLabels are constant labels added to structured-data.
 	// Currently supported keys: env, site, cluster.
 	FixedLabels map[string]string
+	// HostnameLabels derive fixed labels from os.Hostname(): label -> regex, using capture
+	// group 1 (or the whole match). Evaluated once in NewRunner; explicit FixedLabels win.
+	HostnameLabels map[string]string
+	// NormalizeStripPrefixes are regexes for leading tokens (e.g. `\[(INFO|WARN)\]`)
+	// removed before hashing. Empty disables prefix stripping.
+	NormalizeStripPrefixes []string
+	// NormalizeMaxBytes caps the key text before it is normalized and hashed. Enabling it
+	// changes hashes of longer texts versus uncapped. <= 0 means no cap.
+	NormalizeMaxBytes int
+	// TraceIDField is a dotted path (e.g. "ctx.trace_id") whose value, when an event has
+	// one, is sent as the trace_id label and payload field for cross-system correlation.
+	// It is read before KeepFields/DropFields projection.
+	TraceIDField string
+	// PayloadIncludeNormalized adds the normalized key text (the hash input) to the payload
+	// to help debug dedup misses. Off by default to limit message size.
+	PayloadIncludeNormalized bool
+	// PayloadGzipMinBytes gzips + base64-encodes payloads of at least this many bytes
+	// (tagged ct="gzip") to keep giant events under line limits. 0 disables.
+	PayloadGzipMinBytes int
+	// PayloadShape is "flat" (default: {source, event_index, event, flat, ...}) or
+	// "envelope" ({"meta": <labels>, "body": <flat payload>}).
+	PayloadShape string
+	// FlattenEnabled computes the flattened view of each event (FlatJSON, the payload's
+	// "flat"); nil means true. When false, FlatJSON is stored as "{}" and "flat" is omitted,
+	// saving the flattening cost on feeds that do not use it.
+	FlattenEnabled *bool
+	// SDOrder replaces the built-in structured-data param order (for positional parsers);
+	// params not listed follow, sorted by key.
+	SDOrder []string
+	// SDID is the SD-ID of the main structured-data element (default "cndp"), for Alloy
+	// pipelines keyed off another enterprise ID, e.g. "acme@32473".
+	SDID string
+	// SDGroups moves labels out of the main (SDID) element into extra SD elements: SD-ID ->
+	// label keys, e.g. {"meta@32473": ["env", "site"]}. Extra elements follow the main one,
+	// sorted by SD-ID, and are omitted when none of their labels is set.
+	SDGroups map[string][]string
+	// MinFileAge skips input files modified less than this long ago; they are picked up
+	// by a later run once untouched for MinFileAge (0 disables).
+	MinFileAge time.Duration
+	// MTimeSkew tolerates input file mtimes up to this far ahead of the local clock (e.g.
+	// networked filesystems): a file's age for MinFileAge is measured from now+MTimeSkew.
+	MTimeSkew time.Duration
+	// MaxOpenFiles caps the short-lived file handles open at once across ingest workers:
+	// input file reads and SpillDir writes; 0 = unlimited. Long-lived handles
+	// are not counted: the open DBs (the current one and the monthly DBs a run touches,
+	// closed when it ends), one AuditDir file, and syslog connections (SyslogMaxConns).
+	MaxOpenFiles int
+	// SkipOpenFiles skips input files another process still holds open for writing
+	// (Linux /proc scan; no-op elsewhere), so half-written files are never read.
+	SkipOpenFiles bool
+	// EmptyFiles handles zero-byte input files: "skip" (default) leaves them in place
+	// unrecorded; "record" records them as processed (no events) and deletes them like any
+	// processed file; "error_dir" records them and moves them to the input's error_dir
+	// (falling back to "record" for inputs without one). MinFileAge and SkipOpenFiles still
+	// apply, since a file may be empty only because its producer has not written it yet.
+	EmptyFiles string
+	// Reappear handles a file that shows up again, with identical content, at a path whose
+	// copy was already sent and deleted: "skip" (default) deletes it again (DeleteAfterSend)
+	// without sending; "resend" drops the old bookkeeping row, its archived events kept,
+	// and ingests the file as new. Copies recorded in earlier monthly DBs (MaxDBScan) count.
+	Reappear string
+	// TimeLayouts are extra Go time layouts (e.g. "20060102150405") tried after the
+	// built-in ones when parsing event times. Zone-less layouts use Asia/Shanghai.
+	TimeLayouts []string
+	// EventTimeKeys are fields holding the event time, dotted paths into nested objects
+	// (e.g. "header.timestamp"), tried before the built-in top-level keys ("time",
+	// "timestamp", "occur_time", ...).
+	EventTimeKeys []string
+	// FailOnNoInputs makes a run fail (after its other work) when InputGlobs and Inputs
+	// together match no files; by default only a warning is logged.
+	FailOnNoInputs bool
+	// RequireSyslog probes the syslog receiver at the start of each run and fails the
+	// run (skipping ingest/send; the deadman is still attempted) when it is unreachable.
+	RequireSyslog bool
+	// KeepFields / DropFields project decoded objects (dotted paths) before they are
+	// stored in EventJSON/FlatJSON and shipped. The hash always uses the full item.
+	KeepFields []string
+	DropFields []string
+	// ProcessedFileRetention prunes ProcessedFile rows of files that were sent and deleted
+	// longer ago than this (0 keeps them forever). Rows of undeleted files are always kept.
+	ProcessedFileRetention time.Duration
+	// SourceTypeSniff rules derive the source type from a leading marker line when the
+	// file extension is not a known type (warn, alarm).
+	SourceTypeSniff []SourceTypeSniffRule
+	// DiskFreeMinBytes enables a pre-run check warning (and reporting disk_free_bytes in the
+	// deadman) when the DB folder (archived contents included), an error dir, SpillDir or
+	// AuditDir has less free space than this. 0 disables.
+	DiskFreeMinBytes int64
+	// FinalizeBatchSize is how many processed-file rows finalizeFiles loads per page
+	// (default 500).
+	FinalizeBatchSize int
+	// InsertBatchSize is how many events one INSERT archives (default 500), so a file that
+	// expands to tens of thousands of events stays under SQLite's bound-variable limit.
+	InsertBatchSize int
+	// EventTimeFromMTime uses the source file's mtime as the event time for lag
+	// when the event has no time field of its own.
+	EventTimeFromMTime bool
 }
 
+const defaultFinalizeBatchSize = 500
+
+const defaultInsertBatchSize = 500
+
+const defaultMaxDBScan = 24
+
 type InputSpec struct {
 	Glob      string
 	AlertType string
 	ErrorDir  string
+	// Ordered ingests the input's files one at a time, oldest mtime first.
+	Ordered bool
+	// Workers ingests up to this many of the input's files concurrently when not Ordered.
+	// <= 1 keeps the default sequential glob-order ingest.
+	Workers int
+	// HashMode selects what ContentHash covers: "keytext" (default, the detail/description
+	// text), "event" (the whole event JSON) or "fields" (only HashFields, dotted paths).
+	// Timestamps are stripped via normalization in every mode.
+	HashMode   string
+	HashFields []string
+	// Dedup "file" makes the whole file the unit of dedup: every event's ContentHash is the
+	// file's FileDigestSHA256 (cut to HashHexLen), so a re-delivered identical file is one
+	// logical duplicate whatever its events. Default "event" hashes each event (HashMode).
+	Dedup string
+	// Shards treats each directory the glob matches as one logical file whose *.json shards,
+	// in name order, form a single event array hashed as a unit (see ingestShardDir). The
+	// directory is moved or deleted as a whole; plain files matched by the glob are skipped.
+	Shards bool
+	// DefaultLevel ("warning" or "critical") replaces "unknown" as the alert level of events
+	// with no recognized status/level/severity in files without a .warn/.alarm extension.
+	DefaultLevel string
+}
+
+// hashSpec is an input's HashMode/HashFields.
+type hashSpec struct {
+	Mode   string
+	Fields []string
+	Dedup  string
 }
 
 type Runner struct {
-	cfg    RunnerConfig
-	db     *gorm.DB
-	dbKey  string
-	syslog SyslogSender
+	cfg   RunnerConfig
+	db    *gorm.DB
+	dbKey string
+	// monthDBs caches monthly DBs other than the current one (DBByEventTime), keyed by YYYYMM.
+	monthDBs   map[string]*gorm.DB
+	monthDBsMu sync.Mutex
+	syslog     SyslogSender
+	// destinations are the SyslogDestinations receivers, sent after the primary output.
+	destinations []destination
+	// queues are the QueueInputs sources, polled by ingestAll.
+	queues []queue
+	// quiet are the parsed QuietHours windows.
+	quiet         []quietWindow
+	fs            FileSystem
+	normalizeOpts NormalizeOptions
+	sniffers      []sourceTypeSniffer
+	// diskFree is diskFreeBytes; overridable in tests.
+	diskFree func(path string) (uint64, error)
+	// configHash is configHash of the resolved config, reported in the deadman.
+	configHash string
+	// stdout receives RunSummary lines; overridable in tests.
+	stdout io.Writer
+	// dryRunOut is the DryRunOut file, closed by Close.
+	dryRunOut io.Closer
+	// auditOut is the open AuditDir file at auditPath, shared by workers under auditMu.
+	auditMu   sync.Mutex
+	auditPath string
+	auditOut  io.WriteCloser
+	// limiter paces new and resent events (MaxSendRate); replay is not paced.
+	limiter *sendLimiter
+	// budget is the MaxOpenFiles budget, shared by fs reads and the SpillDir files.
+	budget fileBudget
+	// runID identifies the current run (a ULID set by runOnce); runSeq numbers its sends and
+	// runErrs counts its failed event sends so far (stats.EventsSentErr across workers).
+	runID   string
+	runSeq  atomic.Int64
+	runErrs atomic.Int64
+	// noRetry holds the senders that ran out of SendRetries in the current run.
+	noRetryMu sync.Mutex
+	noRetry   map[SyslogSender]bool
 }
 
 func (r *Runner) debugf(format string, args ...any) {
@@ -73,10 +360,153 @@ type runStats struct {
 	EventsSentErr   int
 	EventsReplayOK  int
 	EventsReplayErr int
-	FilesDeleted    int
-	MaxLag          time.Duration
+	// EventsConnLimited counts failed sends that timed out waiting for a SyslogMaxConns
+	// slot; they are left out of EventsSentErr since the receiver was not tried.
+	EventsConnLimited int
+	// EventsSuppressed counts new events held back by QuietHours.
+	EventsSuppressed int
+	// EventsReplaySkipped counts events skipped as already replayed (ReplayLog).
+	EventsReplaySkipped int
+	FilesDeleted        int
+	// LinesIngested counts events from followed NDJSON lines (FollowPath).
+	LinesIngested int
+	// MessagesIngested counts queue messages sent, archived and acknowledged (QueueInputs).
+	MessagesIngested int
+	// DecodeErrors counts inputs (files or followed lines) that were not valid JSON.
+	DecodeErrors int
+	// FlattenTruncated counts events whose FlatJSON hit FlattenOptions.MaxKeys.
+	FlattenTruncated int
+	// FilesStuck counts files that were fully sent but could not be deleted
+	// (all_sent=true, deleted=false, last_error set) as of the end of the run.
+	FilesStuck int
+	// DistinctHashes counts distinct ContentHash values among new events this run;
+	// few distinct hashes with many events indicates an alert storm.
+	DistinctHashes int
+	MaxLag         time.Duration
+	// LagByType breaks lag down by alert type (see noteLag).
+	LagByType map[string]*lagStat
+	// DiskLow is set when a checked dir is below DiskFreeMinBytes; DiskFreeBytes is then
+	// the lowest free space seen.
+	DiskLow       bool
+	DiskFreeBytes uint64
+
+	// hashes counts new events per ContentHash (see topHashes).
+	hashes map[string]int
+}
+
+// lagStat aggregates event lag for one alert type.
+type lagStat struct {
+	Max   time.Duration
+	Sum   time.Duration
+	Count int
+}
+
+func (l *lagStat) add(o lagStat) {
+	if o.Max > l.Max {
+		l.Max = o.Max
+	}
+	l.Sum += o.Sum
+	l.Count += o.Count
+}
+
+// noteLag records one event's lag in MaxLag and LagByType.
+func (s *runStats) noteLag(alertType string, lag time.Duration) {
+	if lag > s.MaxLag {
+		s.MaxLag = lag
+	}
+	s.addLag(alertType, lagStat{Max: lag, Sum: lag, Count: 1})
+}
+
+func (s *runStats) addLag(alertType string, l lagStat) {
+	if s.LagByType == nil {
+		s.LagByType = make(map[string]*lagStat)
+	}
+	cur, ok := s.LagByType[alertType]
+	if !ok {
+		cur = &lagStat{}
+		s.LagByType[alertType] = cur
+	}
+	cur.add(l)
+}
+
+func (s *runStats) noteHash(hash string) {
+	s.noteHashN(hash, 1)
+}
+
+func (s *runStats) noteHashN(hash string, n int) {
+	if hash == "" {
+		return
+	}
+	if s.hashes == nil {
+		s.hashes = make(map[string]int)
+	}
+	if _, ok := s.hashes[hash]; !ok {
+		s.DistinctHashes++
+	}
+	s.hashes[hash] += n
+}
+
+// topHashesInDeadman bounds the deadman's top_hashes.
+const topHashesInDeadman = 5
+
+// hashCount is one top_hashes entry.
+type hashCount struct {
+	Hash  string `json:"hash"`
+	Count int    `json:"count"`
+}
+
+// topHashes returns up to n hashes with the most new events this run, most frequent
+// first (ties by hash), so a flood names its pattern.
+func (s *runStats) topHashes(n int) []hashCount {
+	out := make([]hashCount, 0, len(s.hashes))
+	for h, c := range s.hashes {
+		out = append(out, hashCount{Hash: h, Count: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Hash < out[j].Hash
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// merge adds a worker's stats into s.
+func (s *runStats) merge(o *runStats) {
+	s.FilesIngested += o.FilesIngested
+	s.EventsNew += o.EventsNew
+	s.EventsSentOK += o.EventsSentOK
+	s.EventsSentErr += o.EventsSentErr
+	s.EventsConnLimited += o.EventsConnLimited
+	s.EventsReplayOK += o.EventsReplayOK
+	s.EventsReplayErr += o.EventsReplayErr
+	s.EventsReplaySkipped += o.EventsReplaySkipped
+	s.EventsSuppressed += o.EventsSuppressed
+	s.FilesDeleted += o.FilesDeleted
+	s.LinesIngested += o.LinesIngested
+	s.MessagesIngested += o.MessagesIngested
+	s.DecodeErrors += o.DecodeErrors
+	s.FlattenTruncated += o.FlattenTruncated
+	s.FilesStuck += o.FilesStuck
+	for h, n := range o.hashes {
+		s.noteHashN(h, n)
+	}
+	if o.MaxLag > s.MaxLag {
+		s.MaxLag = o.MaxLag
+	}
+	for t, l := range o.LagByType {
+		s.addLag(t, *l)
+	}
 }
 
+// ErrRunTimeout is returned when a run hits its Timeout deadline. The run made partial
+// progress: what was not reached stays pending for the next run, so callers can treat it
+// as "continue" rather than a failure (errors.Is).
+var ErrRunTimeout = errors.New("timeout exceeded")
+
 func (r *Runner) replayFrom(from time.Time, deadline time.Time, stats *runStats) error {
 	if strings.TrimSpace(r.cfg.DBFolder) == "" {
 		return fmt.Errorf("replay requires DBFolder (monthly rolling DB)")
@@ -85,20 +515,30 @@ func (r *Runner) replayFrom(from time.Time, deadline time.Time, stats *runStats)
 		return fmt.Errorf("replay requires DBPrefix (monthly rolling DB)")
 	}
 	to := time.Now().UTC()
-	dbPaths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, from.UTC(), to)
+	dbPaths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, archivedSearchFrom(from), to)
 	if err != nil {
 		return err
 	}
+	dbPaths = r.limitDBScan(dbPaths)
 	if len(dbPaths) == 0 {
 		r.debugf("replay: no db files matched folder=%q prefix=%q", r.cfg.DBFolder, r.cfg.DBPrefix)
 		return nil
 	}
+	targets, err := r.replayTargets()
+	if err != nil {
+		return err
+	}
 
 	for _, dbPath := range dbPaths {
 		if isDeadlineExceeded(deadline) {
-			return fmt.Errorf("timeout exceeded")
+			return ErrRunTimeout
 		}
 		r.debugf("replay: open db=%q", dbPath)
+		// Replayed events carry the month of the DB they were read from.
+		dbMonth := ""
+		if month, ok := parseMonthlyDBKey(filepath.Base(dbPath), r.cfg.DBPrefix); ok {
+			dbMonth = monthKey(month)
+		}
 		db, err := OpenQueryDB(dbPath)
 		if err != nil {
 			return err
@@ -107,6 +547,11 @@ func (r *Runner) replayFrom(from time.Time, deadline time.Time, stats *runStats)
 		if err != nil {
 			return err
 		}
+		// The replay log lives next to the events it covers, so it survives a month rollover.
+		if err := db.AutoMigrate(&ReplayLog{}); err != nil {
+			_ = sqlDB.Close()
+			return err
+		}
 
 		var events []SpoolEvent
 		if err := db.Where("archived_at >= ?", from.UTC()).Order("id asc").Find(&events).Error; err != nil {
@@ -117,42 +562,33 @@ func (r *Runner) replayFrom(from time.Time, deadline time.Time, stats *runStats)
 		for _, ev := range events {
 			if isDeadlineExceeded(deadline) {
 				_ = sqlDB.Close()
-				return fmt.Errorf("timeout exceeded")
+				return ErrRunTimeout
 			}
-			if stats != nil {
-				if lag, ok := computeLag(time.Now().UTC(), jsonAnyFromString(ev.EventJSON)); ok {
-					if lag > stats.MaxLag {
-						stats.MaxLag = lag
+			if ev.Seeded {
+				continue
+			}
+			var done map[string]bool
+			if !r.cfg.ReplayForce {
+				done = r.replayedTo(db, dbMonth, ev.ID)
+				if replayedToAll(targets, done) {
+					r.debugf("replay skip already replayed path=%q id=%d", ev.SourcePath, ev.ID)
+					if stats != nil {
+						stats.EventsReplaySkipped++
 					}
+					continue
 				}
 			}
-			structured := buildStructuredData("cndp", map[string]string{
-				"job":        r.cfg.JobLabel,
-				"service":    r.cfg.ServiceLabel,
-				"env":        r.cfg.FixedLabels["env"],
-				"site":       r.cfg.FixedLabels["site"],
-				"cluster":    r.cfg.FixedLabels["cluster"],
-				"filename":   filepath.Base(ev.SourcePath),
-				"alert_type": ev.AlertType,
-				"alert_level": func() string {
-					if strings.TrimSpace(ev.AlertLevel) == "" {
-						return "unknown"
-					}
-					return ev.AlertLevel
-				}(),
-				"hash":   ev.ContentHash,
-				"cccc":   ev.CCCC,
-				"replay": "true",
-			})
-
-			payload := map[string]any{
-				"source":      ev.SourcePath,
-				"event_index": ev.EventIndex,
-				"event":       json.RawMessage(ev.EventJSON),
-				"flat":        json.RawMessage(ev.FlatJSON),
+			if stats != nil {
+				if lag, ok := r.eventLag(time.Now().UTC(), ev); ok {
+					stats.noteLag(ev.AlertType, lag)
+				}
+			}
+			labels := r.eventLabels(ev, dbMonth)
+			labels["replay"] = "true"
+			sent, err := r.sendTo(targets, ev, msgIDReplay, labels, done, deadline)
+			for _, key := range sent {
+				r.noteReplayed(db, dbMonth, ev.ID, key)
 			}
-			payloadBytes, _ := json.Marshal(payload)
-			err := r.syslog.SendRFC5424Timeout("alert-spooler", structured, string(payloadBytes), remainingTimeout(deadline, 3*time.Second))
 			if err != nil {
 				r.debugf("replay send failed path=%q id=%d err=%v", ev.SourcePath, ev.ID, err)
 				if stats != nil {
@@ -170,28 +606,60 @@ func (r *Runner) replayFrom(from time.Time, deadline time.Time, stats *runStats)
 	return nil
 }
 
+// replayedTo returns the destination keys the event was already replayed to, from the
+// replay log in db, the event's own DB.
+func (r *Runner) replayedTo(db *gorm.DB, dbMonth string, id uint) map[string]bool {
+	var keys []string
+	err := db.Model(&ReplayLog{}).
+		Where("db_month = ? AND event_id = ?", dbMonth, id).
+		Pluck("destination", &keys).Error
+	if err != nil {
+		log.Printf("warn: replay log lookup failed id=%d: %v", id, err)
+		return nil
+	}
+	done := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		done[k] = true
+	}
+	return done
+}
+
+// replayedToAll reports whether every replay target is in done.
+func replayedToAll(targets []sendTarget, done map[string]bool) bool {
+	for _, t := range targets {
+		if !done[t.key] {
+			return false
+		}
+	}
+	return true
+}
+
+// noteReplayed records a successful replay of the event to the destination key in db, the
+// event's own DB. Best-effort: a failure only means the event is sent to that destination
+// again by the next replay over the same window.
+func (r *Runner) noteReplayed(db *gorm.DB, dbMonth string, id uint, key string) {
+	var entry ReplayLog
+	err := db.Where(ReplayLog{DBMonth: dbMonth, EventID: id, Destination: key}).
+		Assign(ReplayLog{ReplayedAt: time.Now().UTC()}).
+		FirstOrCreate(&entry).Error
+	if err != nil {
+		log.Printf("warn: replay log write failed id=%d: %v", id, err)
+	}
+}
+
 func listMonthlyDBs(folder string, prefix string, from time.Time, to time.Time) ([]string, error) {
 	pattern := filepath.Join(folder, prefix+"*.db")
 	candidates, err := filepath.Glob(pattern)
 	if err != nil {
 		return nil, err
 	}
-	// Parse month from filename: <prefix><YYYYMM>.db
 	fromKey := from.Year()*100 + int(from.Month())
 	toKey := to.Year()*100 + int(to.Month())
 
 	filtered := make([]string, 0, len(candidates))
 	for _, p := range candidates {
-		base := filepath.Base(p)
-		if !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, ".db") {
-			continue
-		}
-		yyyymm := strings.TrimSuffix(strings.TrimPrefix(base, prefix), ".db")
-		if len(yyyymm) != 6 {
-			continue
-		}
-		tm, err := time.Parse("200601", yyyymm)
-		if err != nil {
+		tm, ok := parseMonthlyDBKey(filepath.Base(p), prefix)
+		if !ok {
 			continue
 		}
 		key := tm.Year()*100 + int(tm.Month())
@@ -211,11 +679,112 @@ func NewRunner(cfg RunnerConfig) (*Runner, error) {
 	if strings.TrimSpace(cfg.JobLabel) == "" {
 		return nil, fmt.Errorf("JobLabel is required")
 	}
-	if len(cfg.InputGlobs) == 0 && len(cfg.Inputs) == 0 {
-		return nil, fmt.Errorf("Inputs or InputGlobs is required")
+	if len(cfg.InputGlobs) == 0 && len(cfg.Inputs) == 0 && strings.TrimSpace(cfg.FollowPath) == "" && len(cfg.QueueInputs) == 0 {
+		return nil, fmt.Errorf("Inputs, InputGlobs, FollowPath or QueueInputs is required")
+	}
+	switch cfg.Output {
+	case "", "syslog":
+		if cfg.SyslogAddr == "" {
+			return nil, fmt.Errorf("SyslogAddr is required")
+		}
+	case "journald":
+	default:
+		return nil, fmt.Errorf("unsupported output %q (use syslog or journald)", cfg.Output)
+	}
+	if strings.TrimSpace(cfg.SpillDir) != "" {
+		if cfg.Output == "journald" {
+			return nil, fmt.Errorf("spill_dir requires output syslog")
+		}
+	}
+	for _, in := range cfg.Inputs {
+		switch in.HashMode {
+		case "", "keytext", "event":
+		case "fields":
+			if len(in.HashFields) == 0 {
+				return nil, fmt.Errorf("input %q: hash_mode fields requires hash_fields", in.Glob)
+			}
+		default:
+			return nil, fmt.Errorf("input %q: unsupported hash_mode %q (use keytext, event or fields)", in.Glob, in.HashMode)
+		}
+		switch in.Dedup {
+		case "", "event", "file":
+		default:
+			return nil, fmt.Errorf("input %q: unsupported dedup %q (use event or file)", in.Glob, in.Dedup)
+		}
+	}
+	for _, in := range cfg.Inputs {
+		switch in.DefaultLevel {
+		case "", "warning", "critical":
+		default:
+			return nil, fmt.Errorf("input %q: unsupported default_level %q (use warning or critical)", in.Glob, in.DefaultLevel)
+		}
+		if in.Shards && strings.Contains(in.Glob, "**") {
+			return nil, fmt.Errorf("input %q: shards does not support ** globs", in.Glob)
+		}
+	}
+	if cfg.SDID != "" && sanitizeSDName(cfg.SDID) != cfg.SDID {
+		return nil, fmt.Errorf("invalid sd_id %q", cfg.SDID)
+	}
+	for id := range cfg.SDGroups {
+		if id == "" || id == cfg.sdID() || sanitizeSDName(id) != id {
+			return nil, fmt.Errorf("invalid sd_groups SD-ID %q", id)
+		}
+	}
+	for _, f := range cfg.HashScope {
+		if f != "alert_type" && f != "cccc" {
+			return nil, fmt.Errorf("unsupported hash_scope %q (use alert_type or cccc)", f)
+		}
+	}
+	if cfg.FlushOnly && (cfg.Seed || cfg.DryRun || !cfg.ReplayFrom.IsZero()) {
+		return nil, fmt.Errorf("flush-only cannot be combined with seed, dry-run or replay")
+	}
+	if cfg.Seed && (cfg.DryRun || !cfg.ReplayFrom.IsZero()) {
+		return nil, fmt.Errorf("seed cannot be combined with dry-run or replay")
+	}
+	switch cfg.SyslogNetwork {
+	case "", "tcp", "udp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q (use tcp, udp, unix or unixgram)", cfg.SyslogNetwork)
+	}
+	switch cfg.SyslogFormat {
+	case "", "rfc5424", "rfc3164":
+	default:
+		return nil, fmt.Errorf("unsupported syslog format %q (use rfc5424 or rfc3164)", cfg.SyslogFormat)
+	}
+	if err := ValidateSyslogPriority(cfg.SyslogFacility, cfg.SyslogSeverity); err != nil {
+		return nil, err
+	}
+	switch cfg.SyslogFraming {
+	case "", "lf":
+	case "octet":
+		if cfg.SyslogNetwork == "udp" || cfg.SyslogNetwork == "unixgram" {
+			return nil, fmt.Errorf("syslog framing octet requires a stream syslog network, got %q", cfg.SyslogNetwork)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog framing %q (use lf or octet)", cfg.SyslogFraming)
+	}
+	if cfg.SyslogTLS.Enabled && cfg.SyslogNetwork != "" && cfg.SyslogNetwork != "tcp" {
+		return nil, fmt.Errorf("syslog tls requires syslog network tcp, got %q", cfg.SyslogNetwork)
+	}
+	switch cfg.MoveVerify {
+	case "", "size", "sha256":
+	default:
+		return nil, fmt.Errorf("unsupported move_verify %q (use size or sha256)", cfg.MoveVerify)
+	}
+	switch cfg.EmptyFiles {
+	case "", "skip", "record", "error_dir":
+	default:
+		return nil, fmt.Errorf("unsupported empty_files %q (use skip, record or error_dir)", cfg.EmptyFiles)
+	}
+	switch cfg.Reappear {
+	case "", "skip", "resend":
+	default:
+		return nil, fmt.Errorf("unsupported reappear %q (use skip or resend)", cfg.Reappear)
 	}
-	if cfg.SyslogAddr == "" {
-		return nil, fmt.Errorf("SyslogAddr is required")
+	switch cfg.PayloadShape {
+	case "", "flat", "envelope":
+	default:
+		return nil, fmt.Errorf("unsupported payload shape %q (use flat or envelope)", cfg.PayloadShape)
 	}
 	if cfg.ServiceLabel == "" {
 		cfg.ServiceLabel = "alerts"
@@ -228,19 +797,184 @@ func NewRunner(cfg RunnerConfig) (*Runner, error) {
 		cfg.DeleteAfterSend = true
 	}
 
+	stripPrefixes, err := CompileStripPrefixes(cfg.NormalizeStripPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	sniffers, err := compileSourceTypeSniff(cfg.SourceTypeSniff)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hashed before hostname labels are derived, so hosts sharing a config file agree.
+	cfgHash := configHash(cfg)
+
+	if len(cfg.HostnameLabels) > 0 {
+		host, err := hostname()
+		if err != nil {
+			return nil, fmt.Errorf("hostname labels: %w", err)
+		}
+		derived, err := DeriveHostnameLabels(host, cfg.HostnameLabels)
+		if err != nil {
+			return nil, err
+		}
+		merged := make(map[string]string, len(derived)+len(cfg.FixedLabels))
+		for k, v := range derived {
+			merged[k] = v
+		}
+		for k, v := range cfg.FixedLabels {
+			if strings.TrimSpace(v) != "" {
+				merged[k] = v
+			}
+		}
+		cfg.FixedLabels = merged
+	}
+
+	syslogOpts := DefaultSyslogOptions()
+	if cfg.SyslogNoDelay != nil {
+		syslogOpts.NoDelay = *cfg.SyslogNoDelay
+	}
+	syslogOpts.KeepAlive = cfg.SyslogKeepAlive
+	syslogOpts.Network = cfg.SyslogNetwork
+	syslogOpts.Limiter = NewConnLimiter(cfg.SyslogMaxConns)
+	syslogOpts.Hostname = cfg.SyslogHostname
+	syslogOpts.Format = cfg.SyslogFormat
+	syslogOpts.Framing = cfg.SyslogFraming
+	syslogOpts.Facility = cfg.SyslogFacility
+	syslogOpts.Severity = cfg.SyslogSeverity
+	tlsCfg, err := cfg.SyslogTLS.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	syslogOpts.TLSConfig = tlsCfg
+
+	var sender SyslogSender = NewSyslogClientWithOptions(cfg.SyslogAddr, syslogOpts)
+	if cfg.Output == "journald" {
+		js, err := NewJournaldSender(cfg.JournaldSocket)
+		if err != nil {
+			return nil, err
+		}
+		sender = js
+	}
+	var dests []destination
+	if !cfg.DryRun {
+		var err error
+		if dests, err = newDestinations(cfg.SyslogDestinations, syslogOpts); err != nil {
+			return nil, err
+		}
+		if cfg.ReplayDest != "" && cfg.ReplayDest != primaryDestination {
+			if _, ok := findDestination(dests, cfg.ReplayDest); !ok {
+				return nil, fmt.Errorf("unknown replay destination %q", cfg.ReplayDest)
+			}
+		}
+	}
+	queues, err := newQueues(cfg.QueueInputs)
+	if err != nil {
+		return nil, err
+	}
+	quiet, err := newQuietWindows(cfg.QuietHours, cfg.QuietHoursTZ)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := newFileBudget(cfg.MaxOpenFiles)
 	r := &Runner{
-		cfg:    cfg,
-		syslog: NewSyslogClient(cfg.SyslogAddr),
+		cfg:           cfg,
+		syslog:        sender,
+		destinations:  dests,
+		queues:        queues,
+		quiet:         quiet,
+		configHash:    cfgHash,
+		fs:            newBudgetFS(OSFS{}, budget),
+		budget:        budget,
+		normalizeOpts: NormalizeOptions{StripPrefixes: stripPrefixes, MaxBytes: cfg.NormalizeMaxBytes},
+		sniffers:      sniffers,
+		diskFree:      diskFreeBytes,
+		limiter:       newSendLimiter(cfg.MaxSendRate),
+		stdout:        os.Stdout,
+	}
+	if cfg.DryRun {
+		var out io.Writer = io.Discard
+		if strings.TrimSpace(cfg.DryRunOut) != "" {
+			f, err := os.Create(cfg.DryRunOut)
+			if err != nil {
+				return nil, fmt.Errorf("dry-run out: %w", err)
+			}
+			w := gzipIfSuffix(cfg.DryRunOut, f)
+			r.dryRunOut = w
+			out = w
+		}
+		lw := NewLineWriter(out)
+		lw.host = cfg.SyslogHostname
+		lw.format = cfg.SyslogFormat
+		lw.pri = syslogPriority(cfg.SyslogFacility, cfg.SyslogSeverity)
+		r.syslog = lw
 	}
-	if err := r.ensureDBForNow(); err != nil {
+	if err := r.ensureDBForNow(time.Time{}); err != nil {
 		_ = r.Close()
 		return nil, err
 	}
 	return r, nil
 }
 
+// hostname is os.Hostname; overridable in tests.
+var hostname = os.Hostname
+
+// DeriveHostnameLabels evaluates label -> regex patterns against host. A pattern's value is
+// its first capture group, or the whole match when it has none; non-matching labels are omitted.
+func DeriveHostnameLabels(host string, patterns map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(patterns))
+	for label, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostname label pattern %s=%q: %w", label, pattern, err)
+		}
+		m := re.FindStringSubmatch(host)
+		if m == nil {
+			continue
+		}
+		v := m[0]
+		if len(m) > 1 {
+			v = m[1]
+		}
+		if v != "" {
+			out[label] = v
+		}
+	}
+	return out, nil
+}
+
 func (r *Runner) Close() error {
-	if r == nil || r.db == nil {
+	if r == nil {
+		return nil
+	}
+	if r.dryRunOut != nil {
+		_ = r.dryRunOut.Close()
+		r.dryRunOut = nil
+	}
+	r.closeAudit()
+	for _, q := range r.queues {
+		_ = q.source.Close()
+	}
+	return r.closeDBs()
+}
+
+// closeMonthDBs closes the cached monthly DBs (see dbForMonth). Runs close them when they
+// end, so a long-lived poller holds no handles between sweeps.
+func (r *Runner) closeMonthDBs() {
+	r.monthDBsMu.Lock()
+	defer r.monthDBsMu.Unlock()
+	for key, db := range r.monthDBs {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+		delete(r.monthDBs, key)
+	}
+}
+
+func (r *Runner) closeDBs() error {
+	r.closeMonthDBs()
+	if r.db == nil {
 		return nil
 	}
 	sqlDB, err := r.db.DB()
@@ -254,94 +988,398 @@ func (r *Runner) Close() error {
 }
 
 func (r *Runner) RunOnce() error {
+	_, err := r.runOnce()
+	return err
+}
+
+// Drain runs sweeps until one ingests no new files or lines and leaves no pending events,
+// sleeping interval between sweeps. A sweep cut short by ErrRunTimeout never counts as
+// drained, since it may not have reached all input. Drain fails if the queue is still not
+// empty after maxIterations sweeps (<=0 means no cap).
+func (r *Runner) Drain(maxIterations int, interval time.Duration) error {
+	for i := 1; maxIterations <= 0 || i <= maxIterations; i++ {
+		stats, runErr := r.runOnce()
+		if runErr != nil && !errors.Is(runErr, ErrRunTimeout) {
+			return runErr
+		}
+		pending, err := r.countPending()
+		if err != nil {
+			return err
+		}
+		r.debugf("drain sweep=%d filesIngested=%d pending=%d timedOut=%v", i, stats.FilesIngested, pending, runErr != nil)
+		if runErr == nil && stats.FilesIngested == 0 && stats.LinesIngested == 0 && stats.MessagesIngested == 0 && pending == 0 {
+			return nil
+		}
+		if maxIterations > 0 && i == maxIterations {
+			return fmt.Errorf("drain: queue not empty after %d sweeps (pending=%d)", i, pending)
+		}
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+	return nil
+}
+
+// Poll runs a sweep every interval until stop is closed or, when maxIterations > 0,
+// that many sweeps have run. Sweep errors are logged and do not end the loop.
+// It returns the number of sweeps run.
+func (r *Runner) Poll(interval time.Duration, maxIterations int, stop <-chan struct{}) int {
+	i := 0
+	for maxIterations <= 0 || i < maxIterations {
+		i++
+		if err := r.RunOnce(); errors.Is(err, ErrRunTimeout) {
+			log.Printf("run once timed out; continuing next sweep")
+		} else if err != nil {
+			log.Printf("run once error: %v", err)
+		}
+		if maxIterations > 0 && i == maxIterations {
+			break
+		}
+		select {
+		case <-stop:
+			return i
+		case <-time.After(interval):
+		}
+	}
+	return i
+}
+
+// countPending counts the events a resend would send now: pending events held by an
+// active quiet window are not counted, they wait for the window to end.
+func (r *Runner) countPending() (int64, error) {
+	dbs, err := r.eventDBs()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var total int64
+	for _, db := range dbs {
+		if len(r.quiet) == 0 {
+			var n int64
+			if err := db.Model(&SpoolEvent{}).Where("sent_syslog = ?", false).Count(&n).Error; err != nil {
+				return 0, err
+			}
+			total += n
+			continue
+		}
+		var pending []SpoolEvent
+		if err := db.Select("alert_type", "alert_level").Where("sent_syslog = ?", false).Find(&pending).Error; err != nil {
+			return 0, err
+		}
+		for _, ev := range pending {
+			if _, held := r.quietWindow(ev, now); !held {
+				total++
+			}
+		}
+	}
+	return total, nil
+}
+
+func (r *Runner) runOnce() (*runStats, error) {
 	start := time.Now()
+	r.runID = newULID(start)
+	r.runSeq.Store(0)
+	r.runErrs.Store(0)
+	r.noRetryMu.Lock()
+	r.noRetry = nil
+	r.noRetryMu.Unlock()
 	stats := &runStats{}
 	var runErr error
 	deadline := time.Time{}
 	if r.cfg.Timeout > 0 {
 		deadline = time.Now().Add(r.cfg.Timeout)
 	}
+	defer r.closeMonthDBs()
+	defer r.closeAudit()
+	// One connection per receiver for the whole run (deadman included), not one per event.
+	defer r.openSessions()()
 	defer func() {
-		if strings.TrimSpace(r.cfg.DeadmanToken) == "" {
+		if r.cfg.RunSummary {
+			fmt.Fprintln(r.stdout, summaryLine(stats))
+		}
+		if strings.TrimSpace(r.cfg.DeadmanToken) == "" || r.cfg.Seed {
 			return
 		}
 		// Best-effort: deadman should still be sent even on failures.
 		_ = r.sendDeadman(deadline, start, time.Now(), stats, runErr)
 	}()
 
-	if err := r.ensureDBForNow(); err != nil {
+	if err := r.ensureDBForNow(deadline); err != nil {
 		runErr = err
-		return err
+		return stats, err
+	}
+	r.checkDiskSpace(stats)
+	if r.cfg.RequireSyslog && !r.cfg.Seed {
+		if p, ok := r.syslog.(SyslogProber); ok {
+			if err := p.Probe(remainingTimeout(deadline, 2*time.Second)); err != nil {
+				runErr = fmt.Errorf("syslog unreachable: %w", err)
+				return stats, runErr
+			}
+		}
 	}
 	r.debugf("run_once start: dbFolder=%q dbPrefix=%q inputs=%d globs=%d deleteAfterSend=%v timeout=%s", r.cfg.DBFolder, r.cfg.DBPrefix, len(r.cfg.Inputs), len(r.cfg.InputGlobs), r.cfg.DeleteAfterSend, r.cfg.Timeout)
 
+	if r.cfg.DryRun {
+		if err := r.dryRun(deadline, stats); err != nil {
+			runErr = err
+			return stats, err
+		}
+		return stats, nil
+	}
+
 	if !r.cfg.ReplayFrom.IsZero() {
 		r.debugf("replay mode: from=%s", r.cfg.ReplayFrom.UTC().Format(time.RFC3339Nano))
 		err := r.replayFrom(r.cfg.ReplayFrom, deadline, stats)
 		if err != nil {
 			runErr = err
-			return err
+			return stats, err
 		}
-		return nil
+		return stats, nil
 	}
 
-	paths, err := r.expandGlobs(r.cfg.InputGlobs)
-	if err != nil {
-		runErr = err
-		return err
-	}
-	for _, p := range paths {
-		if isDeadlineExceeded(deadline) {
-			runErr = fmt.Errorf("timeout exceeded")
-			return runErr
+	if !r.cfg.Seed {
+		if err := r.drainSpill(deadline, stats); err != nil {
+			runErr = err
+			return stats, err
 		}
-		r.debugf("ingest legacy glob path=%q", p)
-		_ = r.ingestFile(p, "", "", deadline, stats)
 	}
 
-	items, err := r.expandInputs(r.cfg.Inputs)
-	if err != nil {
-		runErr = err
-		return err
-	}
-	for _, it := range items {
-		if isDeadlineExceeded(deadline) {
-			runErr = fmt.Errorf("timeout exceeded")
-			return runErr
+	noInputs := false
+	if r.cfg.FlushOnly {
+		r.debugf("flush-only: skipping input scan")
+	} else {
+		var err error
+		if noInputs, err = r.ingestAll(deadline, stats); err != nil {
+			runErr = err
+			return stats, err
 		}
-		r.debugf("ingest path=%q alertType=%q", it.Path, it.AlertType)
-		_ = r.ingestFile(it.Path, it.AlertType, it.ErrorDir, deadline, stats)
 	}
 
 	if isDeadlineExceeded(deadline) {
-		runErr = fmt.Errorf("timeout exceeded")
-		return runErr
+		runErr = ErrRunTimeout
+		return stats, runErr
 	}
-	if err := r.resendPending(deadline, stats); err != nil {
-		runErr = err
-		return err
+	if !r.cfg.Seed {
+		if err := r.resendPending(deadline, stats); err != nil {
+			runErr = err
+			return stats, err
+		}
 	}
 	if isDeadlineExceeded(deadline) {
-		runErr = fmt.Errorf("timeout exceeded")
-		return runErr
+		runErr = ErrRunTimeout
+		return stats, runErr
 	}
-	if err := r.finalizeFiles(stats); err != nil {
+	if err := r.finalizeFiles(deadline, stats); err != nil {
 		runErr = err
-		return err
+		return stats, err
 	}
-	r.debugf("run_once done: filesIngested=%d eventsNew=%d sentOK=%d sentErr=%d filesDeleted=%d maxLag=%s elapsed=%s", stats.FilesIngested, stats.EventsNew, stats.EventsSentOK, stats.EventsSentErr, stats.FilesDeleted, stats.MaxLag, time.Since(start))
-	return nil
+	if noInputs && r.cfg.FailOnNoInputs {
+		runErr = fmt.Errorf("no input files matched")
+		return stats, runErr
+	}
+	r.debugf("run_once done: filesIngested=%d eventsNew=%d sentOK=%d sentErr=%d filesDeleted=%d filesStuck=%d distinctHashes=%d maxLag=%s elapsed=%s", stats.FilesIngested, stats.EventsNew, stats.EventsSentOK, stats.EventsSentErr, stats.FilesDeleted, stats.FilesStuck, stats.DistinctHashes, stats.MaxLag, time.Since(start))
+	return stats, nil
 }
 
-func isDeadlineExceeded(deadline time.Time) bool {
-	return !deadline.IsZero() && time.Now().After(deadline)
+// openSessions opens a SyslogSession on every sender that supports one and returns the
+// func closing them.
+func (r *Runner) openSessions() func() {
+	senders := []SyslogSender{r.syslog}
+	for _, d := range r.destinations {
+		senders = append(senders, d.sender)
+	}
+	var opened []SyslogSession
+	// A session holds its connection slot for the whole run, so with fewer slots than
+	// receivers the others could never dial; keep per-send connections then.
+	if r.cfg.SyslogMaxConns > 0 && r.cfg.SyslogMaxConns < len(senders) {
+		return func() {}
+	}
+	for _, s := range senders {
+		if ss, ok := s.(SyslogSession); ok {
+			ss.OpenSession()
+			opened = append(opened, ss)
+		}
+	}
+	return func() {
+		for _, ss := range opened {
+			if err := ss.CloseSession(); err != nil {
+				r.debugf("close syslog session: %v", err)
+			}
+		}
+	}
 }
 
-func remainingTimeout(deadline time.Time, fallback time.Duration) time.Duration {
-	if deadline.IsZero() {
-		return fallback
+// summaryLine is the RunSummary line, e.g.
+// "ingested=3 new=3 sent=3 err=0 deleted=3 maxlag=1.2s".
+func summaryLine(stats *runStats) string {
+	return fmt.Sprintf("ingested=%d new=%d sent=%d err=%d deleted=%d maxlag=%s",
+		stats.FilesIngested, stats.EventsNew, stats.EventsSentOK, stats.EventsSentErr, stats.FilesDeleted, stats.MaxLag.Round(100*time.Millisecond))
+}
+
+// checkDiskSpace warns when a dir the run writes to (the DB folder, which also holds the
+// archived file contents, the error dirs, SpillDir and AuditDir) has less than
+// DiskFreeMinBytes free, so a filling disk shows up before writes start failing.
+func (r *Runner) checkDiskSpace(stats *runStats) {
+	if r.cfg.DiskFreeMinBytes <= 0 {
+		return
 	}
-	rem := time.Until(deadline)
+	dbDir := r.cfg.DBFolder
+	if strings.TrimSpace(dbDir) == "" {
+		dbDir = filepath.Dir(r.cfg.DBPath)
+	}
+	dirs := []string{dbDir}
+	for _, in := range r.cfg.Inputs {
+		if strings.TrimSpace(in.ErrorDir) != "" {
+			dirs = append(dirs, in.ErrorDir)
+		}
+	}
+	for _, dir := range []string{r.cfg.SpillDir, r.cfg.AuditDir} {
+		if strings.TrimSpace(dir) != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	seen := make(map[string]struct{}, len(dirs))
+	for _, dir := range dirs {
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		free, err := r.diskFree(dir)
+		if err != nil {
+			r.debugf("disk space check skipped dir=%q err=%v", dir, err)
+			continue
+		}
+		if free >= uint64(r.cfg.DiskFreeMinBytes) {
+			continue
+		}
+		log.Printf("warn: low disk space dir=%q free_bytes=%d min_bytes=%d", dir, free, r.cfg.DiskFreeMinBytes)
+		if !stats.DiskLow || free < stats.DiskFreeBytes {
+			stats.DiskLow = true
+			stats.DiskFreeBytes = free
+		}
+	}
+}
+
+// dryRun builds and "sends" (to the LineWriter) events for every not-yet-processed input
+// file, leaving the DB and the files untouched.
+func (r *Runner) dryRun(deadline time.Time, stats *runStats) error {
+	legacy, err := r.expandGlobs(r.cfg.InputGlobs)
+	if err != nil {
+		return err
+	}
+	items := make([]inputItem, 0, len(legacy))
+	for _, p := range legacy {
+		items = append(items, inputItem{Path: p})
+	}
+	inputs, err := r.expandInputs(r.cfg.Inputs)
+	if err != nil {
+		return err
+	}
+	items = append(items, inputs...)
+
+	files := 0
+	for _, it := range items {
+		if isDeadlineExceeded(deadline) {
+			return ErrRunTimeout
+		}
+		info, err := r.fs.Stat(it.Path)
+		if err != nil || info.IsDir() || info.Size() <= 0 {
+			continue
+		}
+		content, err := r.fs.ReadFile(it.Path)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(content)
+		sha := hex.EncodeToString(sum[:])
+		if already, err := r.isAlreadyProcessed(it.Path, sha, info); err != nil || already {
+			continue
+		}
+		alertType, alertTypeSrc := strings.TrimSpace(it.AlertType), "forced"
+		if alertType == "" {
+			alertType, alertTypeSrc = inferAlertType(it.Path)
+		}
+		sourceType, body := r.sourceTypeFor(it.Path, content)
+		raw := string(content)
+		var events []SpoolEvent
+		if decoded, _, err := decodeContent(body); err != nil {
+			events = []SpoolEvent{newErrorEvent(it.Path, sourceType, alertType, sha, raw, err)}
+		} else if events, err = r.toEvents(decoded, raw, it.Path, sourceType, alertType, sha, it.Hash, it.DefaultLevel, stats); err != nil {
+			events = []SpoolEvent{newErrorEvent(it.Path, sourceType, alertType, sha, raw, err)}
+		}
+		r.sendNewEvents(it.Path, withAlertTypeSrc(events, alertTypeSrc), deadline, stats)
+		files++
+	}
+	log.Printf("dry-run: %d file(s), %d event(s) would be sent", files, stats.EventsNew)
+	return nil
+}
+
+// ReprocessErrors re-ingests files from each input's error_dir through the normal pipeline.
+// Files that now parse are archived, sent and (with DeleteAfterSend) deleted; files that
+// still fail to decode are left in place untouched. Nothing is moved back to error_dir here,
+// so files cannot bounce between the alert and error dirs.
+func (r *Runner) ReprocessErrors() error {
+	deadline := time.Time{}
+	if r.cfg.Timeout > 0 {
+		deadline = time.Now().Add(r.cfg.Timeout)
+	}
+	if err := r.ensureDBForNow(deadline); err != nil {
+		return err
+	}
+	defer r.closeMonthDBs()
+	defer r.closeAudit()
+	defer r.openSessions()()
+	stats := &runStats{}
+	seen := make(map[string]struct{})
+	for i, in := range r.cfg.Inputs {
+		if strings.TrimSpace(in.ErrorDir) == "" {
+			continue
+		}
+		if _, ok := seen[in.ErrorDir]; ok {
+			continue
+		}
+		seen[in.ErrorDir] = struct{}{}
+		paths, err := r.fs.Glob(filepath.Join(in.ErrorDir, "*"))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if isDeadlineExceeded(deadline) {
+				return ErrRunTimeout
+			}
+			content, err := r.fs.ReadFile(p)
+			if err != nil {
+				// Directories and unreadable files are skipped.
+				continue
+			}
+			_, body := r.sourceTypeFor(p, content)
+			if _, _, err := decodeContent(body); err != nil {
+				r.debugf("reprocess: still bad path=%q err=%v", p, err)
+				continue
+			}
+			r.debugf("reprocess path=%q alertType=%q", p, in.AlertType)
+			_ = r.ingestFile(inputItem{Path: p, AlertType: in.AlertType, Input: i, Hash: hashSpec{Mode: in.HashMode, Fields: in.HashFields, Dedup: in.Dedup}, DefaultLevel: in.DefaultLevel, Tag: inputTag(i, in)}, deadline, stats)
+		}
+	}
+	if err := r.resendPending(deadline, stats); err != nil {
+		return err
+	}
+	if err := r.finalizeFiles(deadline, stats); err != nil {
+		return err
+	}
+	r.debugf("reprocess done: filesIngested=%d sentOK=%d sentErr=%d filesDeleted=%d", stats.FilesIngested, stats.EventsSentOK, stats.EventsSentErr, stats.FilesDeleted)
+	return nil
+}
+
+func isDeadlineExceeded(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+func remainingTimeout(deadline time.Time, fallback time.Duration) time.Duration {
+	if deadline.IsZero() {
+		return fallback
+	}
+	rem := time.Until(deadline)
 	if rem <= 0 {
 		return 1 * time.Millisecond
 	}
@@ -351,12 +1389,56 @@ func remainingTimeout(deadline time.Time, fallback time.Duration) time.Duration
 	return fallback
 }
 
-func (r *Runner) ensureDBForNow() error {
+// ingestAll ingests the InputGlobs and Inputs files, the FollowPath lines and the
+// QueueInputs messages. It reports whether configured globs matched no files at all.
+func (r *Runner) ingestAll(deadline time.Time, stats *runStats) (bool, error) {
+	paths, err := r.expandGlobs(r.cfg.InputGlobs)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range paths {
+		if isDeadlineExceeded(deadline) {
+			return false, ErrRunTimeout
+		}
+		r.debugf("ingest legacy glob path=%q", p)
+		_ = r.ingestFile(inputItem{Path: p, Tag: legacyInputTag}, deadline, stats)
+	}
+
+	items, err := r.expandInputs(r.cfg.Inputs)
+	if err != nil {
+		return false, err
+	}
+	if err := r.ingestInputs(items, deadline, stats); err != nil {
+		return false, err
+	}
+	noInputs := len(paths) == 0 && len(items) == 0 && len(r.cfg.InputGlobs)+len(r.cfg.Inputs) > 0
+	if noInputs {
+		log.Printf("warn: no input files matched globs=%d inputs=%d", len(r.cfg.InputGlobs), len(r.cfg.Inputs))
+	}
+
+	if strings.TrimSpace(r.cfg.FollowPath) != "" {
+		if err := r.followFile(r.cfg.FollowPath, deadline, stats); err != nil {
+			return noInputs, err
+		}
+	}
+	for _, q := range r.queues {
+		if err := r.pollQueue(q, deadline, stats); err != nil {
+			return noInputs, err
+		}
+	}
+	return noInputs, nil
+}
+
+// ensureDBForNow opens the current month's DB at the start of a run. The DB stays pinned
+// for the whole run: a run that crosses a month boundary keeps inserting into the month it
+// started in, with ArchivedAt already in the new month (see archivedSearchFrom). Open
+// retries stop at deadline (zero: no deadline).
+func (r *Runner) ensureDBForNow(deadline time.Time) error {
 	if strings.TrimSpace(r.cfg.DBFolder) == "" {
 		if r.db != nil {
 			return nil
 		}
-		db, err := OpenDB(r.cfg.DBPath)
+		db, err := r.openDBWithRetry(r.cfg.DBPath, "", deadline)
 		if err != nil {
 			return err
 		}
@@ -366,20 +1448,16 @@ func (r *Runner) ensureDBForNow() error {
 	}
 
 	now := time.Now()
-	key := fmt.Sprintf("%04d%02d", now.Year(), int(now.Month()))
+	key := monthKey(now)
 	if r.db != nil && r.dbKey == key {
 		return nil
 	}
 	// switch DB per natural month
-	_ = r.Close()
+	_ = r.closeDBs()
 	if strings.TrimSpace(r.cfg.DBPrefix) == "" {
 		r.cfg.DBPrefix = "alerts_"
 	}
-	if err := os.MkdirAll(r.cfg.DBFolder, 0o755); err != nil {
-		return err
-	}
-	dbPath := filepath.Join(r.cfg.DBFolder, r.cfg.DBPrefix+key+".db")
-	db, err := OpenDB(dbPath)
+	db, err := r.openDBWithRetry(monthlyDBPath(r.cfg.DBFolder, r.cfg.DBPrefix, now), r.cfg.DBFolder, deadline)
 	if err != nil {
 		return err
 	}
@@ -388,11 +1466,266 @@ func (r *Runner) ensureDBForNow() error {
 	return nil
 }
 
+// dbOpenAttempts bounds how often openDBWithRetry tries; dbOpenBackoff is its first wait,
+// doubled after each failure. openDB opens the DB. Overridable in tests.
+var (
+	dbOpenAttempts = 4
+	dbOpenBackoff  = time.Second
+	openDB         = OpenDB
+)
+
+// openDBWithRetry creates dir (when set) and opens the DB at path, retrying with backoff
+// so a briefly unavailable mount (e.g. NFS at boot) does not fail the run outright. It
+// gives up early rather than wait past deadline (zero: no deadline).
+func (r *Runner) openDBWithRetry(path string, dir string, deadline time.Time) (*gorm.DB, error) {
+	wait := dbOpenBackoff
+	for attempt := 1; ; attempt++ {
+		var db *gorm.DB
+		var err error
+		if dir != "" {
+			err = r.fs.MkdirAll(dir, 0o755)
+		}
+		if err == nil {
+			if db, err = openDB(path); err == nil {
+				return db, nil
+			}
+		}
+		if attempt >= dbOpenAttempts || (!deadline.IsZero() && time.Now().Add(wait).After(deadline)) {
+			return nil, err
+		}
+		log.Printf("warn: open db failed path=%q attempt=%d/%d err=%v; retrying in %s", path, attempt, dbOpenAttempts, err, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// monthKeyLayout is the YYYYMM month key in monthly DB file names: <prefix><YYYYMM>.db.
+const monthKeyLayout = "200601"
+
+// archivedSearchFrom is the first month whose DB may hold events archived at or after from.
+// Runs pin their DB, so events archived just after a month boundary can sit in the previous
+// month's DB; queries by archived_at therefore also scan the month before from.
+func archivedSearchFrom(from time.Time) time.Time {
+	from = from.Local()
+	return time.Date(from.Year(), from.Month()-1, 1, 0, 0, 0, 0, time.Local)
+}
+
+func monthKey(t time.Time) string {
+	return t.Local().Format(monthKeyLayout)
+}
+
+// monthlyDBPath returns the monthly DB path for t's (local) month.
+func monthlyDBPath(folder, prefix string, t time.Time) string {
+	return filepath.Join(folder, prefix+monthKey(t)+".db")
+}
+
+// monthlyDBKeyRe matches what follows the prefix in a monthly DB file name.
+var monthlyDBKeyRe = regexp.MustCompile(`^(\d{6})\.db$`)
+
+// parseMonthlyDBKey returns the month of a monthly DB file name built by monthlyDBPath.
+// The name is matched as <prefix>(\d{6})\.db with the prefix taken literally, so digits
+// in the prefix are never read as the key; the key must be a real month (01-12).
+func parseMonthlyDBKey(base, prefix string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(base, prefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	m := monthlyDBKeyRe.FindStringSubmatch(rest)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(monthKeyLayout, m[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (r *Runner) routeByEventTime() bool {
+	return r.cfg.DBByEventTime && strings.TrimSpace(r.cfg.DBFolder) != ""
+}
+
+// dbForMonth returns the monthly DB for t's month, opening and caching it if it is not
+// the current one.
+func (r *Runner) dbForMonth(t time.Time) (*gorm.DB, error) {
+	key := monthKey(t)
+	if key == r.dbKey && r.db != nil {
+		return r.db, nil
+	}
+	r.monthDBsMu.Lock()
+	defer r.monthDBsMu.Unlock()
+	if db, ok := r.monthDBs[key]; ok {
+		return db, nil
+	}
+	db, err := OpenDB(monthlyDBPath(r.cfg.DBFolder, r.cfg.DBPrefix, t))
+	if err != nil {
+		return nil, err
+	}
+	if r.monthDBs == nil {
+		r.monthDBs = make(map[string]*gorm.DB)
+	}
+	r.monthDBs[key] = db
+	return db, nil
+}
+
+// eventDBs returns every DB that may hold events for files tracked in the current DB.
+// With DBByEventTime that is all monthly DBs on disk; otherwise just the current one.
+func (r *Runner) eventDBs() ([]*gorm.DB, error) {
+	if !r.routeByEventTime() {
+		return []*gorm.DB{r.db}, nil
+	}
+	others, err := r.otherMonthDBs()
+	if err != nil {
+		return nil, err
+	}
+	return append([]*gorm.DB{r.db}, others...), nil
+}
+
+// otherMonthDBs opens the monthly DBs on disk other than the current one, oldest first and
+// bounded by MaxDBScan; none without DBFolder.
+func (r *Runner) otherMonthDBs() ([]*gorm.DB, error) {
+	if strings.TrimSpace(r.cfg.DBFolder) == "" {
+		return nil, nil
+	}
+	paths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+	paths = r.limitDBScan(paths)
+	var dbs []*gorm.DB
+	for _, p := range paths {
+		month, ok := parseMonthlyDBKey(filepath.Base(p), r.cfg.DBPrefix)
+		if !ok || monthKey(month) == r.dbKey {
+			continue
+		}
+		db, err := r.dbForMonth(month)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// limitDBScan keeps the MaxDBScan most recent of paths (sorted oldest first, as returned
+// by listMonthlyDBs), so a site with years of DBs does not open them all.
+func (r *Runner) limitDBScan(paths []string) []string {
+	n := r.cfg.MaxDBScan
+	if n == 0 {
+		n = defaultMaxDBScan
+	}
+	if n < 0 || len(paths) <= n {
+		return paths
+	}
+	r.debugf("db scan: skipping %d monthly DB(s) older than %q (max_db_scan=%d)", len(paths)-n, paths[len(paths)-n], n)
+	return paths[len(paths)-n:]
+}
+
+// warnStrandedPending logs the pending events of the monthly DBs MaxDBScan leaves out of
+// resend (DBByEventTime), which are never resent unless the bound is raised. Each skipped
+// DB is opened read-only just for the count.
+func (r *Runner) warnStrandedPending() {
+	if !r.routeByEventTime() {
+		return
+	}
+	paths, err := listMonthlyDBs(r.cfg.DBFolder, r.cfg.DBPrefix, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return
+	}
+	kept := len(r.limitDBScan(paths))
+	var stranded int64
+	for _, p := range paths[:len(paths)-kept] {
+		db, err := OpenQueryDB(p)
+		if err != nil {
+			log.Printf("warn: resend: count pending in skipped DB %q: %v", p, err)
+			continue
+		}
+		var n int64
+		if err := db.Model(&SpoolEvent{}).Where("sent_syslog = ?", false).Count(&n).Error; err != nil {
+			log.Printf("warn: resend: count pending in skipped DB %q: %v", p, err)
+		}
+		stranded += n
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}
+	if stranded > 0 {
+		log.Printf("warn: resend: %d pending event(s) in %d monthly DB(s) older than the %d scanned (max_db_scan) are not resent", stranded, len(paths)-kept, kept)
+	}
+}
+
+// eventMonthTime is the time used to pick an event's monthly DB under DBByEventTime.
+func (r *Runner) eventMonthTime(ev SpoolEvent) time.Time {
+	if ts, ok := r.ownEventTime(ev); ok {
+		return ts
+	}
+	return ev.ArchivedAt
+}
+
+// insertOtherMonthEvents inserts events whose month differs from the current DB into
+// their own monthly DB and returns the events that belong in the current DB, the inserted
+// ones (IDs set) and undo, which deletes the inserted events again. A SQLite transaction cannot span DB files, so
+// the caller runs undo when its own transaction for the local events fails; on error,
+// whatever was inserted is already undone.
+func (r *Runner) insertOtherMonthEvents(events []SpoolEvent) ([]SpoolEvent, []SpoolEvent, func(), error) {
+	local := make([]SpoolEvent, 0, len(events))
+	byKey := make(map[string][]SpoolEvent)
+	months := make(map[string]time.Time)
+	for _, ev := range events {
+		month := r.eventMonthTime(ev)
+		key := monthKey(month)
+		if key == r.dbKey {
+			local = append(local, ev)
+			continue
+		}
+		byKey[key] = append(byKey[key], ev)
+		months[key] = month
+	}
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type inserted struct {
+		db  *gorm.DB
+		ids []uint
+	}
+	var done []inserted
+	var routed []SpoolEvent
+	undo := func() {
+		for _, in := range done {
+			if err := in.db.Delete(&SpoolEvent{}, in.ids).Error; err != nil {
+				log.Printf("warn: undo of routed events failed ids=%v: %v", in.ids, err)
+			}
+		}
+	}
+	for _, key := range keys {
+		db, err := r.dbForMonth(months[key])
+		if err != nil {
+			undo()
+			return nil, nil, nil, err
+		}
+		evs := byKey[key]
+		if err := db.CreateInBatches(&evs, r.insertBatchSize()).Error; err != nil {
+			undo()
+			return nil, nil, nil, err
+		}
+		ids := make([]uint, len(evs))
+		for i := range evs {
+			ids[i] = evs[i].ID
+		}
+		done = append(done, inserted{db: db, ids: ids})
+		routed = append(routed, evs...)
+		r.debugf("routed %d event(s) to month db=%s", len(evs), key)
+	}
+	return local, routed, undo, nil
+}
+
 func (r *Runner) expandGlobs(globs []string) ([]string, error) {
 	seen := make(map[string]struct{})
 	var out []string
 	for _, g := range globs {
-		matches, err := expandGlobWithDoubleStar(g)
+		matches, err := expandGlobWithDoubleStar(r.fs, g)
 		if err != nil {
 			return nil, err
 		}
@@ -411,16 +1744,36 @@ type inputItem struct {
 	Path      string
 	AlertType string
 	ErrorDir  string
+	// Input is the index of the InputSpec the path was matched by.
+	Input        int
+	Hash         hashSpec
+	DefaultLevel string
+	Shards       bool
+	// Tag is inputTag of the matching InputSpec, recorded on the file and its events.
+	Tag string
+}
+
+// legacyInputTag is the InputTag of files matched by InputGlobs.
+const legacyInputTag = "input_globs"
+
+// inputTag identifies Inputs[i] on the ProcessedFile and SpoolEvent rows of the files it
+// matched: "inputs[<i>]", plus ":<alert_type>" when the input forces one.
+func inputTag(i int, in InputSpec) string {
+	tag := fmt.Sprintf("inputs[%d]", i)
+	if at := strings.TrimSpace(in.AlertType); at != "" {
+		tag += ":" + at
+	}
+	return tag
 }
 
 func (r *Runner) expandInputs(inputs []InputSpec) ([]inputItem, error) {
 	seen := make(map[string]struct{})
 	var out []inputItem
-	for _, in := range inputs {
+	for i, in := range inputs {
 		if strings.TrimSpace(in.Glob) == "" {
 			continue
 		}
-		matches, err := expandGlobWithDoubleStar(in.Glob)
+		matches, err := expandGlobWithDoubleStar(r.fs, in.Glob)
 		if err != nil {
 			return nil, err
 		}
@@ -429,16 +1782,111 @@ func (r *Runner) expandInputs(inputs []InputSpec) ([]inputItem, error) {
 				continue
 			}
 			seen[m] = struct{}{}
-			out = append(out, inputItem{Path: m, AlertType: in.AlertType, ErrorDir: in.ErrorDir})
+			out = append(out, inputItem{Path: m, AlertType: in.AlertType, ErrorDir: in.ErrorDir, Input: i, Hash: hashSpec{Mode: in.HashMode, Fields: in.HashFields, Dedup: in.Dedup}, DefaultLevel: in.DefaultLevel, Shards: in.Shards, Tag: inputTag(i, in)})
 		}
 	}
 	return out, nil
 }
 
-func expandGlobWithDoubleStar(pattern string) ([]string, error) {
+// ingestInputs ingests expanded items input by input: Ordered inputs one file at a time
+// by mtime, the others with up to InputSpec.Workers files in flight.
+func (r *Runner) ingestInputs(items []inputItem, deadline time.Time, stats *runStats) error {
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && items[end].Input == items[start].Input {
+			end++
+		}
+		group := items[start:end]
+		start = end
+
+		spec := r.cfg.Inputs[group[0].Input]
+		workers := spec.Workers
+		if spec.Ordered {
+			r.sortByMTime(group)
+			workers = 1
+		}
+		if err := r.ingestItems(group, workers, deadline, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortByMTime orders items oldest first; ties (and unstat-able files) keep path order.
+func (r *Runner) sortByMTime(items []inputItem) {
+	mtimes := make(map[string]time.Time, len(items))
+	for _, it := range items {
+		if info, err := r.fs.Stat(it.Path); err == nil {
+			mtimes[it.Path] = info.ModTime()
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := mtimes[items[i].Path], mtimes[items[j].Path]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return items[i].Path < items[j].Path
+	})
+}
+
+// ingestItems ingests items sequentially, or with a pool of workers when workers > 1.
+// Each worker keeps its own stats, merged into stats once all are done.
+func (r *Runner) ingestItems(items []inputItem, workers int, deadline time.Time, stats *runStats) error {
+	if workers <= 1 {
+		for _, it := range items {
+			if isDeadlineExceeded(deadline) {
+				return ErrRunTimeout
+			}
+			_ = r.ingestItem(it, deadline, stats)
+		}
+		return nil
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	work := make(chan inputItem)
+	workerStats := make([]*runStats, workers)
+	var wg sync.WaitGroup
+	for w := range workerStats {
+		ws := &runStats{}
+		workerStats[w] = ws
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range work {
+				_ = r.ingestItem(it, deadline, ws)
+			}
+		}()
+	}
+	var err error
+	for _, it := range items {
+		if isDeadlineExceeded(deadline) {
+			err = ErrRunTimeout
+			break
+		}
+		work <- it
+	}
+	close(work)
+	wg.Wait()
+	for _, ws := range workerStats {
+		stats.merge(ws)
+	}
+	return err
+}
+
+func (r *Runner) ingestItem(it inputItem, deadline time.Time, stats *runStats) error {
+	r.debugf("ingest path=%q alertType=%q", it.Path, it.AlertType)
+	if it.Shards {
+		return r.ingestShardDir(it, deadline, stats)
+	}
+	return r.ingestFile(it, deadline, stats)
+}
+
+func expandGlobWithDoubleStar(fsys FileSystem, pattern string) ([]string, error) {
 	// Go's filepath.Glob doesn't support **; implement a minimal recursive matcher.
 	if !strings.Contains(pattern, "**") {
-		return filepath.Glob(pattern)
+		return fsys.Glob(pattern)
 	}
 
 	// Split at the first ** occurrence.
@@ -460,7 +1908,7 @@ func expandGlobWithDoubleStar(pattern string) ([]string, error) {
 	matchBasenameOnly := !strings.Contains(suffixSlash, "/")
 
 	var matches []string
-	err := filepath.WalkDir(basePart, func(p string, d fs.DirEntry, err error) error {
+	err := fsys.WalkDir(basePart, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -489,31 +1937,81 @@ func expandGlobWithDoubleStar(pattern string) ([]string, error) {
 	return matches, nil
 }
 
-func (r *Runner) ingestFile(path string, forcedAlertType string, errorDir string, deadline time.Time, stats *runStats) error {
-	info, err := os.Stat(path)
+func (r *Runner) ingestFile(it inputItem, deadline time.Time, stats *runStats) error {
+	path := it.Path
+	info, err := r.fs.Stat(path)
 	if err != nil {
 		return err
 	}
 	if info.IsDir() {
 		return nil
 	}
-	if info.Size() <= 0 {
+	if info.Size() <= 0 && (r.cfg.EmptyFiles == "" || r.cfg.EmptyFiles == "skip") {
+		return nil
+	}
+	if r.tooYoung(path, info) {
 		return nil
 	}
+	if r.cfg.SkipOpenFiles {
+		if open, err := isOpenForWrite(path); err == nil && open {
+			r.debugf("skip file open for writing path=%q", path)
+			return nil
+		}
+	}
+	if info.Size() <= 0 {
+		return r.ingestEmptyFile(it, info, deadline, stats)
+	}
 
-	content, err := os.ReadFile(path)
+	content, err := r.fs.ReadFile(path)
 	if err != nil {
 		// Best-effort: move unreadable files out of the input directory.
-		if strings.TrimSpace(errorDir) != "" {
-			_, _ = MoveFileToDir(path, errorDir)
+		if strings.TrimSpace(it.ErrorDir) != "" {
+			if _, mvErr := MoveFileToDirFSVerify(r.fs, path, it.ErrorDir, r.cfg.MoveVerify); mvErr == nil {
+				_ = r.clearDecodeRetry(path)
+			}
 		}
 		return err
 	}
+	return r.ingestContent(it, info, content, deadline, stats)
+}
+
+// ingestEmptyFile records a zero-byte file as processed with no events, then moves it to
+// the input's error dir (EmptyFiles "error_dir") or deletes it. A file whose delete or
+// move failed is already recorded and is skipped by later runs; one that reappears after
+// it was removed is handled by Reappear like any other file.
+func (r *Runner) ingestEmptyFile(it inputItem, info fs.FileInfo, deadline time.Time, stats *runStats) error {
+	path := it.Path
+	sum := sha256.Sum256(nil)
+	sha := hex.EncodeToString(sum[:])
+	already, err := r.alreadyIngested(path, sha, stats)
+	if err != nil || already {
+		return err
+	}
+	r.debugf("empty file path=%q handling=%s", path, r.cfg.EmptyFiles)
+	return r.archiveAndMarkFile(path, sha, info, nil, it.Tag, deadline, stats, it.ErrorDir, r.cfg.EmptyFiles == "error_dir")
+}
+
+// tooYoung reports whether path was modified less than MinFileAge ago, allowing for
+// mtimes up to MTimeSkew ahead of the local clock.
+func (r *Runner) tooYoung(path string, info fs.FileInfo) bool {
+	if r.cfg.MinFileAge <= 0 {
+		return false
+	}
+	if age := time.Now().Add(r.cfg.MTimeSkew).Sub(info.ModTime()); age < r.cfg.MinFileAge {
+		r.debugf("skip file younger than min_file_age path=%q age=%s", path, age)
+		return true
+	}
+	return false
+}
 
+// ingestContent archives, sends and finalizes the content read from it.Path (a file, or a
+// shard directory merged by readShards).
+func (r *Runner) ingestContent(it inputItem, info fs.FileInfo, content []byte, deadline time.Time, stats *runStats) error {
+	path := it.Path
 	fileSHA := sha256.Sum256(content)
 	fileSHAHex := hex.EncodeToString(fileSHA[:])
 
-	already, err := r.isAlreadyProcessed(path, fileSHAHex, info)
+	already, err := r.alreadyIngested(path, fileSHAHex, stats)
 	if err != nil {
 		return err
 	}
@@ -522,36 +2020,151 @@ func (r *Runner) ingestFile(path string, forcedAlertType string, errorDir string
 		return nil
 	}
 
-	alertType := strings.TrimSpace(forcedAlertType)
+	alertType, alertTypeSrc := strings.TrimSpace(it.AlertType), "forced"
 	if alertType == "" {
-		alertType = inferAlertType(path)
+		alertType, alertTypeSrc = inferAlertType(path)
 	}
-	sourceType := inferSourceType(path)
+	sourceType, body := r.sourceTypeFor(path, content)
 	raw := string(content)
 
-	var decoded any
-	if err := json.Unmarshal(content, &decoded); err != nil {
+	decoded, format, err := decodeContent(body)
+	if err != nil {
+		r.warnDecodeError(path, content, err, stats)
+		if retry, err := r.deferDecodeError(path, fileSHAHex, info, err); err != nil || retry {
+			return err
+		}
 		// archive decode error as a single event
-		r.debugf("decode error path=%q err=%v", path, err)
-		return r.archiveAndMarkFile(path, fileSHAHex, info, []SpoolEvent{newErrorEvent(path, sourceType, alertType, fileSHAHex, raw, err)}, deadline, stats, errorDir, true)
+		events := withAlertTypeSrc([]SpoolEvent{newErrorEvent(path, sourceType, alertType, fileSHAHex, raw, err)}, alertTypeSrc)
+		return r.archiveAndMarkFile(path, fileSHAHex, info, events, it.Tag, deadline, stats, it.ErrorDir, true)
 	}
 
-	events, err := r.toEvents(decoded, raw, path, sourceType, alertType, fileSHAHex)
+	if format != "json" {
+		r.debugf("decoded path=%q as %s", path, format)
+	}
+	events, err := r.toEvents(decoded, raw, path, sourceType, alertType, fileSHAHex, it.Hash, it.DefaultLevel, stats)
 	if err != nil {
 		r.debugf("toEvents error path=%q err=%v", path, err)
-		return r.archiveAndMarkFile(path, fileSHAHex, info, []SpoolEvent{newErrorEvent(path, sourceType, alertType, fileSHAHex, raw, err)}, deadline, stats, errorDir, true)
+		if err := r.clearDecodeRetry(path); err != nil {
+			return err
+		}
+		events := withAlertTypeSrc([]SpoolEvent{newErrorEvent(path, sourceType, alertType, fileSHAHex, raw, err)}, alertTypeSrc)
+		return r.archiveAndMarkFile(path, fileSHAHex, info, events, it.Tag, deadline, stats, it.ErrorDir, true)
+	}
+
+	if err := r.clearDecodeRetry(path); err != nil {
+		return err
+	}
+	return r.archiveAndMarkFile(path, fileSHAHex, info, withAlertTypeSrc(events, alertTypeSrc), it.Tag, deadline, stats, "", false)
+}
+
+// deferDecodeError records a failed decode of path on its DecodePending row and reports
+// whether the file should be left in place for a later run. Once DecodeRetries attempts are
+// used up the row is dropped and the file is archived as a decode error as before.
+func (r *Runner) deferDecodeError(path string, sha string, info fs.FileInfo, decodeErr error) (bool, error) {
+	if r.cfg.DecodeRetries <= 0 {
+		return false, nil
+	}
+	var pf ProcessedFile
+	err := r.db.Where("path = ? AND decode_pending = ?", path, true).First(&pf).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if pf.DecodeAttempts >= r.cfg.DecodeRetries {
+		return false, r.clearDecodeRetry(path)
+	}
+	pf.Path = path
+	pf.SHA256 = sha
+	pf.SizeBytes = info.Size()
+	pf.ModUnixNano = info.ModTime().UnixNano()
+	pf.ProcessedAt = time.Now().UTC()
+	pf.DecodeAttempts++
+	pf.DecodePending = true
+	pf.LastError = fmt.Sprintf("decode attempt %d/%d: %v", pf.DecodeAttempts, r.cfg.DecodeRetries, decodeErr)
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.dropReappearedRow(tx, path, sha); err != nil {
+			return err
+		}
+		return tx.Save(&pf).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	r.debugf("decode error, retry next run path=%q attempt=%d/%d", path, pf.DecodeAttempts, r.cfg.DecodeRetries)
+	return true, nil
+}
+
+// pruneDecodePending drops the DecodePending rows of files no longer on disk (removed or
+// moved away before a retry decoded them), which no later ingest would clear.
+func (r *Runner) pruneDecodePending() error {
+	var pfs []ProcessedFile
+	if err := r.db.Where("decode_pending = ?", true).Find(&pfs).Error; err != nil {
+		return err
+	}
+	for _, pf := range pfs {
+		if _, err := r.fs.Stat(pf.Path); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		r.debugf("dropping decode retry of missing file path=%q", pf.Path)
+		if err := r.db.Delete(&ProcessedFile{}, pf.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearDecodeRetry drops the DecodePending row of path, if any.
+func (r *Runner) clearDecodeRetry(path string) error {
+	if r.cfg.DecodeRetries <= 0 {
+		return nil
 	}
+	return r.db.Where("path = ? AND decode_pending = ?", path, true).Delete(&ProcessedFile{}).Error
+}
+
+// maxDecodeWarningsPerRun bounds decode-error warnings per run so a broken producer
+// cannot flood the log; stats.DecodeErrors still counts them all.
+const maxDecodeWarningsPerRun = 10
+
+// decodeSampleBytes is how much of a bad input is quoted in a decode-error warning.
+const decodeSampleBytes = 200
+
+// warnDecodeError logs (regardless of Debug) that content from path is not valid JSON,
+// with a leading sample, and counts it in stats.
+func (r *Runner) warnDecodeError(path string, content []byte, err error, stats *runStats) {
+	n := 1
+	if stats != nil {
+		stats.DecodeErrors++
+		n = stats.DecodeErrors
+	}
+	if n > maxDecodeWarningsPerRun {
+		return
+	}
+	sample := content
+	if len(sample) > decodeSampleBytes {
+		sample = sample[:decodeSampleBytes]
+	}
+	log.Printf("warn: decode error path=%q err=%v sample=%q", path, err, sample)
+	if n == maxDecodeWarningsPerRun {
+		log.Printf("warn: %d decode errors this run; further ones are not logged", n)
+	}
+}
 
-	return r.archiveAndMarkFile(path, fileSHAHex, info, events, deadline, stats, "", false)
+// withAlertTypeSrc records how the file's alert type was determined (see inferAlertType).
+func withAlertTypeSrc(events []SpoolEvent, src string) []SpoolEvent {
+	for i := range events {
+		events[i].AlertTypeSrc = src
+	}
+	return events
 }
 
-func (r *Runner) toEvents(decoded any, raw string, sourcePath string, sourceType string, alertType string, fileSHA string) ([]SpoolEvent, error) {
+// toEvents builds the events of a decoded document; stats (may be nil) counts flatten
+// truncation. Lag is noted when the events are sent (see sendNewEvents).
+func (r *Runner) toEvents(decoded any, raw string, sourcePath string, sourceType string, alertType string, fileSHA string, hash hashSpec, defaultLevel string, stats *runStats) ([]SpoolEvent, error) {
 	now := time.Now().UTC()
 	switch v := decoded.(type) {
 	case []any:
 		out := make([]SpoolEvent, 0, len(v))
 		for i, item := range v {
-			ev, err := r.buildEvent(item, raw, sourcePath, sourceType, alertType, fileSHA, i, now, nil)
+			ev, err := r.buildEvent(item, raw, sourcePath, sourceType, alertType, fileSHA, hash, defaultLevel, i, now, stats)
 			if err != nil {
 				out = append(out, newErrorEvent(sourcePath, sourceType, alertType, fileSHA, raw, err))
 				continue
@@ -560,7 +2173,7 @@ func (r *Runner) toEvents(decoded any, raw string, sourcePath string, sourceType
 		}
 		return out, nil
 	default:
-		ev, err := r.buildEvent(v, raw, sourcePath, sourceType, alertType, fileSHA, 0, now, nil)
+		ev, err := r.buildEvent(v, raw, sourcePath, sourceType, alertType, fileSHA, hash, defaultLevel, 0, now, stats)
 		if err != nil {
 			return nil, err
 		}
@@ -568,36 +2181,43 @@ func (r *Runner) toEvents(decoded any, raw string, sourcePath string, sourceType
 	}
 }
 
-func (r *Runner) buildEvent(item any, raw string, sourcePath string, sourceType string, alertType string, fileSHA string, idx int, now time.Time, stats *runStats) (SpoolEvent, error) {
-	eventBytes, err := json.Marshal(item)
+func (r *Runner) buildEvent(item any, raw string, sourcePath string, sourceType string, alertType string, fileSHA string, hash hashSpec, defaultLevel string, idx int, now time.Time, stats *runStats) (SpoolEvent, error) {
+	projected := ProjectFields(item, r.cfg.KeepFields, r.cfg.DropFields)
+	eventBytes, err := json.Marshal(projected)
 	if err != nil {
 		return SpoolEvent{}, err
 	}
 	eventJSON := string(eventBytes)
 
-	flat := FlattenJSON(item, FlattenOptions{})
-	flatBytes, err := json.Marshal(flat)
-	if err != nil {
-		return SpoolEvent{}, err
+	flatJSON := "{}"
+	if r.flattenEnabled() {
+		flat := FlattenJSON(projected, FlattenOptions{})
+		if flat[flattenTruncatedKey] == true && stats != nil {
+			stats.FlattenTruncated++
+		}
+		flatBytes, err := json.Marshal(flat)
+		if err != nil {
+			return SpoolEvent{}, err
+		}
+		flatJSON = string(flatBytes)
 	}
-	flatJSON := string(flatBytes)
 
 	keyText := extractKeyText(item)
-	normalized := NormalizeText(keyText)
-	hash := HashNormalized(normalized, r.cfg.HashHexLen)
+	normalized := NormalizeTextWithOptions(hashInput(item, keyText, hash), r.normalizeOpts)
 	cccc := "none"
 	if len(r.cfg.CCCCCodes) > 0 {
 		cccc = ExtractCCCC(keyText, r.cfg.CCCCCodes)
 	}
-	alertLevel := ExtractAlertLevel(item, sourcePath)
-	if stats != nil {
-		if lag, ok := computeLag(now, item); ok {
-			if lag > stats.MaxLag {
-				stats.MaxLag = lag
-			}
-		}
+	contentHash := HashNormalized(r.hashScopePrefix(alertType, cccc)+normalized, r.cfg.HashHexLen)
+	if hash.Dedup == "file" && fileSHA != "" {
+		contentHash = truncateHash(fileSHA, r.cfg.HashHexLen)
+	}
+	alertLevel := ExtractAlertLevelOr(item, sourcePath, defaultLevel)
+	// Read from the unprojected item: KeepFields/DropFields may drop these fields.
+	var eventTime *time.Time
+	if ts, ok := extractEventTime(item, r.cfg.EventTimeKeys, r.cfg.TimeLayouts); ok && !ts.IsZero() {
+		eventTime = &ts
 	}
-
 	ev := SpoolEvent{
 		IngestedAt:       now,
 		SourcePath:       sourcePath,
@@ -611,15 +2231,91 @@ func (r *Runner) buildEvent(item any, raw string, sourcePath string, sourceType
 		EventJSON:        eventJSON,
 		FlatJSON:         flatJSON,
 		Normalized:       normalized,
-		ContentHash:      hash,
+		ContentHash:      contentHash,
 		ArchivedAt:       now,
+		EventTime:        eventTime,
+		TraceID:          r.itemTraceID(item),
 	}
 
 	return ev, nil
 }
 
-func computeLag(now time.Time, item any) (time.Duration, bool) {
-	ts, ok := extractEventTime(item)
+// hashScopePrefix salts ContentHash with the HashScope fields, so equal text under a
+// different alert type or code hashes differently. It is empty by default (text only).
+func (r *Runner) hashScopePrefix(alertType string, cccc string) string {
+	var b strings.Builder
+	for _, f := range r.cfg.HashScope {
+		switch f {
+		case "alert_type":
+			b.WriteString("alert_type=" + alertType + "\x00")
+		case "cccc":
+			b.WriteString("cccc=" + cccc + "\x00")
+		}
+	}
+	return b.String()
+}
+
+// hashInput is the text ContentHash is computed over (after normalization) for hash's mode.
+// JSON object keys are sorted by encoding/json, so equal events yield equal text.
+func hashInput(item any, keyText string, hash hashSpec) string {
+	var v any
+	switch hash.Mode {
+	case "event":
+		v = item
+	case "fields":
+		v = ProjectFields(item, hash.Fields, nil)
+	default:
+		return keyText
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return keyText
+	}
+	return string(b)
+}
+
+// ownEventTime is the time the event carries: SpoolEvent.EventTime, or for rows archived
+// without it, the time found in EventJSON.
+func (r *Runner) ownEventTime(ev SpoolEvent) (time.Time, bool) {
+	if ev.EventTime != nil && !ev.EventTime.IsZero() {
+		return *ev.EventTime, true
+	}
+	if ts, ok := extractEventTime(jsonAnyFromString(ev.EventJSON), r.cfg.EventTimeKeys, r.cfg.TimeLayouts); ok && !ts.IsZero() {
+		return ts, true
+	}
+	return time.Time{}, false
+}
+
+// eventTime is an archived event's own time, falling back to the source file's
+// mtime when EventTimeFromMTime is set (as eventLag does).
+func (r *Runner) eventTime(ev SpoolEvent) (time.Time, bool) {
+	if ts, ok := r.ownEventTime(ev); ok {
+		return ts, true
+	}
+	if !r.cfg.EventTimeFromMTime || ev.SourceMTime == nil || ev.SourceMTime.IsZero() {
+		return time.Time{}, false
+	}
+	return *ev.SourceMTime, true
+}
+
+// eventLag is computeLag for an archived event, falling back to the source file's
+// mtime (EventTimeFromMTime) when the event carries no time of its own.
+func (r *Runner) eventLag(now time.Time, ev SpoolEvent) (time.Duration, bool) {
+	if ts, ok := r.ownEventTime(ev); ok && !now.Before(ts) {
+		return now.Sub(ts), true
+	}
+	if !r.cfg.EventTimeFromMTime || ev.SourceMTime == nil || ev.SourceMTime.IsZero() {
+		return 0, false
+	}
+	lag := now.Sub(*ev.SourceMTime)
+	if lag < 0 {
+		return 0, false
+	}
+	return lag, true
+}
+
+func computeLag(now time.Time, item any, keys []string, layouts []string) (time.Duration, bool) {
+	ts, ok := extractEventTime(item, keys, layouts)
 	if !ok {
 		return 0, false
 	}
@@ -633,28 +2329,42 @@ func computeLag(now time.Time, item any) (time.Duration, bool) {
 	return lag, true
 }
 
-func extractEventTime(item any) (time.Time, bool) {
+// defaultEventTimeKeys are the time fields extractEventTime looks for after EventTimeKeys.
+var defaultEventTimeKeys = []string{"time", "timestamp", "ts", "occur_time", "occurTime", "created_at", "createdAt", "alert_time", "alertTime"}
+
+// extractEventTime looks for a time field: keys (dotted paths such as "header.timestamp")
+// first, then the built-in top-level ones. layouts are extra Go layouts tried after the
+// built-in ones (see parseTimeString).
+func extractEventTime(item any, keys []string, layouts []string) (time.Time, bool) {
 	m, ok := item.(map[string]any)
 	if !ok {
 		return time.Time{}, false
 	}
-	keys := []string{"time", "timestamp", "ts", "occur_time", "occurTime", "created_at", "createdAt", "alert_time", "alertTime"}
 	for _, k := range keys {
+		v, ok := lookupPath(m, splitFieldPath(k))
+		if !ok {
+			continue
+		}
+		if ts, ok := parseAnyTime(v, layouts); ok {
+			return ts, true
+		}
+	}
+	for _, k := range defaultEventTimeKeys {
 		v, ok := m[k]
 		if !ok {
 			continue
 		}
-		if ts, ok := parseAnyTime(v); ok {
+		if ts, ok := parseAnyTime(v, layouts); ok {
 			return ts, true
 		}
 	}
 	return time.Time{}, false
 }
 
-func parseAnyTime(v any) (time.Time, bool) {
+func parseAnyTime(v any, layouts []string) (time.Time, bool) {
 	switch t := v.(type) {
 	case string:
-		return parseTimeString(t)
+		return parseTimeString(t, layouts)
 	case float64:
 		// could be unix seconds
 		sec := int64(t)
@@ -677,7 +2387,7 @@ func parseAnyTime(v any) (time.Time, bool) {
 	}
 }
 
-func parseTimeString(s string) (time.Time, bool) {
+func parseTimeString(s string, extraLayouts []string) (time.Time, bool) {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return time.Time{}, false
@@ -699,15 +2409,33 @@ func parseTimeString(s string) (time.Time, bool) {
 		"2006/01/02 15:04:05",
 		"2006/01/02 15:04:05.000",
 	}
+	layouts = append(layouts, extraLayouts...)
 	for _, layout := range layouts {
 		if ts, err := time.ParseInLocation(layout, s, loc); err == nil {
+			if ts.Year() == 0 {
+				// Year-less layouts (e.g. syslog "Jan 2 15:04:05"): assume the current year,
+				// or last year if that would put the event in the future.
+				now := time.Now().In(loc)
+				ts = ts.AddDate(now.Year(), 0, 0)
+				if ts.After(now.Add(24 * time.Hour)) {
+					ts = ts.AddDate(-1, 0, 0)
+				}
+			}
 			return ts.UTC(), true
 		}
 	}
 	return time.Time{}, false
 }
 
+// extractKeyText returns the text hashed for dedup. Objects use detail/description;
+// scalars (e.g. elements of ["a","b"]) are their own key text; anything else is its JSON.
 func extractKeyText(item any) string {
+	switch v := item.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
 	m, ok := item.(map[string]any)
 	if ok {
 		if v, ok := m["detail"]; ok {
@@ -737,129 +2465,187 @@ func inferSourceType(path string) string {
 	}
 }
 
-func inferAlertType(path string) string {
+// inferAlertType guesses the alert type for inputs without a forced type.
+// The second result is its source: "path" (directory name), "ext" (extension) or "default".
+func inferAlertType(path string) (string, string) {
 	p := strings.ToLower(filepath.ToSlash(path))
 	switch {
 	case strings.Contains(p, "/dev/"):
-		return "dev"
+		return "dev", "path"
 	case strings.Contains(p, "/iec/"):
-		return "iec"
+		return "iec", "path"
 	case strings.Contains(p, "/business/"):
-		return "business"
+		return "business", "path"
 	case strings.Contains(p, "/general/"):
-		return "general"
+		return "general", "path"
 	default:
 		// best-effort by extension
 		ext := strings.ToLower(filepath.Ext(path))
 		if ext == ".alarm" {
-			return "dev"
+			return "dev", "ext"
 		}
-		return "unknown"
+		return "unknown", "default"
 	}
 }
 
 func (r *Runner) isAlreadyProcessed(path string, sha string, info fs.FileInfo) (bool, error) {
-	var pf ProcessedFile
-	err := r.db.Where("path = ? AND sha256 = ?", path, sha).First(&pf).Error
-	if err == nil {
+	pf, err := r.processedFile(path, sha)
+	return pf != nil, err
+}
+
+// processedFile returns the processed row of path with this content, or nil when there is
+// none. The current DB is checked first, then the other monthly DBs (MaxDBScan) newest
+// first, so a file recorded before a month rollover is still found.
+func (r *Runner) processedFile(path string, sha string) (*ProcessedFile, error) {
+	dbs := []*gorm.DB{r.db}
+	others, err := r.otherMonthDBs()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(others) - 1; i >= 0; i-- {
+		dbs = append(dbs, others[i])
+	}
+	for _, db := range dbs {
+		var pf ProcessedFile
+		err := db.Where("path = ? AND sha256 = ? AND decode_pending = ?", path, sha, false).First(&pf).Error
+		if err == nil {
+			return &pf, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// alreadyIngested is isAlreadyProcessed for ingest, applying Reappear to a file whose
+// previous copy was deleted: "skip" deletes it again (DeleteAfterSend), "resend" has the
+// caller ingest it as new, the old row being dropped when the new one is written (see
+// dropReappearedRow).
+func (r *Runner) alreadyIngested(path string, sha string, stats *runStats) (bool, error) {
+	pf, err := r.processedFile(path, sha)
+	if err != nil || pf == nil {
+		return false, err
+	}
+	if !pf.Deleted {
 		return true, nil
 	}
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if r.cfg.Reappear == "resend" {
+		r.debugf("reappeared file, resending path=%q sha=%s", path, sha)
 		return false, nil
 	}
-	return false, err
+	if r.cfg.DeleteAfterSend {
+		if err := r.tryDeleteProcessedFile(path, sha); err == nil {
+			r.debugf("reappeared file deleted without sending path=%q sha=%s", path, sha)
+			if stats != nil {
+				stats.FilesDeleted++
+			}
+		}
+	}
+	return true, nil
 }
 
-func (r *Runner) archiveAndMarkFile(path string, sha string, info fs.FileInfo, events []SpoolEvent, deadline time.Time, stats *runStats, errorDir string, moveToErrorDir bool) error {
-	// send syslog + persist
-	allSent := true
-	for i := range events {
-		if stats != nil {
-			stats.EventsNew++
-			if lag, ok := computeLag(time.Now().UTC(), jsonAnyFromString(events[i].EventJSON)); ok {
-				if lag > stats.MaxLag {
-					stats.MaxLag = lag
-				}
-			}
+// dropReappearedRow deletes, in tx, the deleted row of path with this content that Reappear
+// "resend" left for the row about to be written in its place.
+func (r *Runner) dropReappearedRow(tx *gorm.DB, path string, sha string) error {
+	if r.cfg.Reappear != "resend" {
+		return nil
+	}
+	return tx.Where("path = ? AND sha256 = ? AND deleted = ?", path, sha, true).Delete(&ProcessedFile{}).Error
+}
+
+// dropOtherMonthReappearedRows is dropReappearedRow for the other monthly DBs, run once the
+// new row is committed since a SQLite transaction cannot span DB files. Best-effort: a
+// leftover row is deleted and only makes the file look reappeared again.
+func (r *Runner) dropOtherMonthReappearedRows(path string, sha string) {
+	if r.cfg.Reappear != "resend" {
+		return
+	}
+	others, err := r.otherMonthDBs()
+	if err != nil {
+		r.debugf("reappear: list monthly DBs failed path=%q err=%v", path, err)
+		return
+	}
+	for _, db := range others {
+		if err := r.dropReappearedRow(db, path, sha); err != nil {
+			r.debugf("reappear: drop old row failed path=%q err=%v", path, err)
 		}
-		structured := buildStructuredData("cndp", map[string]string{
-			"job":        r.cfg.JobLabel,
-			"service":    r.cfg.ServiceLabel,
-			"env":        r.cfg.FixedLabels["env"],
-			"site":       r.cfg.FixedLabels["site"],
-			"cluster":    r.cfg.FixedLabels["cluster"],
-			"filename":   filepath.Base(path),
-			"alert_type": events[i].AlertType,
-			"alert_level": func() string {
-				if strings.TrimSpace(events[i].AlertLevel) == "" {
-					return "unknown"
-				}
-				return events[i].AlertLevel
-			}(),
-			"hash": events[i].ContentHash,
-			"cccc": events[i].CCCC,
-		})
+	}
+}
 
-		payload := map[string]any{
-			"source":      events[i].SourcePath,
-			"event_index": events[i].EventIndex,
-			"event":       json.RawMessage(events[i].EventJSON),
-			"flat":        json.RawMessage(events[i].FlatJSON),
+func (r *Runner) insertBatchSize() int {
+	if r.cfg.InsertBatchSize <= 0 {
+		return defaultInsertBatchSize
+	}
+	return r.cfg.InsertBatchSize
+}
+
+func (r *Runner) archiveAndMarkFile(path string, sha string, info fs.FileInfo, events []SpoolEvent, inputTag string, deadline time.Time, stats *runStats, errorDir string, moveToErrorDir bool) error {
+	for i := range events {
+		events[i].InputTag = inputTag
+	}
+	if r.cfg.EventTimeFromMTime {
+		mtime := info.ModTime().UTC()
+		for i := range events {
+			events[i].SourceMTime = &mtime
 		}
-		payloadBytes, _ := json.Marshal(payload)
-		err := r.syslog.SendRFC5424Timeout("alert-spooler", structured, string(payloadBytes), remainingTimeout(deadline, 3*time.Second))
-		if err != nil {
-			r.debugf("syslog send failed path=%q idx=%d err=%v", path, events[i].EventIndex, err)
-			events[i].SentSyslog = false
-			events[i].SendError = err.Error()
-			allSent = false
-			if stats != nil {
-				stats.EventsSentErr++
+	}
+
+	// send syslog + persist
+	allSent := r.sendNewEvents(path, events, deadline, stats)
+
+	local := events
+	var routed []SpoolEvent
+	undo := func() {}
+	var err error
+	if r.routeByEventTime() {
+		local, routed, undo, err = r.insertOtherMonthEvents(events)
+	}
+	if err == nil {
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			if len(local) > 0 {
+				if err := tx.CreateInBatches(&local, r.insertBatchSize()).Error; err != nil {
+					return err
+				}
 			}
-		} else {
-			r.debugf("syslog send ok path=%q idx=%d", path, events[i].EventIndex)
-			t := time.Now().UTC()
-			events[i].SentSyslog = true
-			events[i].SentAt = &t
-			if stats != nil {
-				stats.EventsSentOK++
+			if err := r.dropReappearedRow(tx, path, sha); err != nil {
+				return err
 			}
+			pf := ProcessedFile{
+				Path:        path,
+				SHA256:      sha,
+				SizeBytes:   info.Size(),
+				ModUnixNano: info.ModTime().UnixNano(),
+				ProcessedAt: time.Now().UTC(),
+				AllSent:     allSent,
+				Deleted:     false,
+				InputTag:    inputTag,
+			}
+			return tx.Create(&pf).Error
+		})
+		if err != nil {
+			undo()
 		}
 	}
-
-	err := r.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&events).Error; err != nil {
-			return err
-		}
-		pf := ProcessedFile{
-			Path:        path,
-			SHA256:      sha,
-			SizeBytes:   info.Size(),
-			ModUnixNano: info.ModTime().UnixNano(),
-			ProcessedAt: time.Now().UTC(),
-			AllSent:     allSent,
-			Deleted:     false,
-		}
-		if err := tx.Create(&pf).Error; err != nil {
-			return err
-		}
-		return nil
-	})
 	if err != nil {
 		r.debugf("db transaction failed path=%q err=%v", path, err)
 		// Best-effort: move files that failed DB archive out of the input directory.
 		if moveToErrorDir && strings.TrimSpace(errorDir) != "" {
-			_, _ = MoveFileToDir(path, errorDir)
+			_, _ = MoveFileToDirFSVerify(r.fs, path, errorDir, r.cfg.MoveVerify)
 		}
 		return err
 	}
+	r.dropOtherMonthReappearedRows(path, sha)
+	if !allSent {
+		r.spill(append(local, routed...))
+	}
 	if stats != nil {
 		stats.FilesIngested++
 	}
 
 	// For broken/unparseable inputs: move to error_dir after DB insert (independent of syslog send success).
 	if moveToErrorDir && strings.TrimSpace(errorDir) != "" {
-		dst, mvErr := MoveFileToDir(path, errorDir)
+		dst, mvErr := MoveFileToDirFSVerify(r.fs, path, errorDir, r.cfg.MoveVerify)
 		now := time.Now().UTC()
 		if mvErr != nil {
 			_ = r.db.Model(&ProcessedFile{}).
@@ -890,14 +2676,417 @@ func (r *Runner) archiveAndMarkFile(path string, sha string, info fs.FileInfo, e
 	return nil
 }
 
+// sendNewEvents ships freshly built events, recording the send result on each one.
+// It reports whether every event was sent. In Seed mode nothing is sent and every event
+// is marked Seeded; events in a QuietHours window are marked Suppressed instead of sent.
+func (r *Runner) sendNewEvents(path string, events []SpoolEvent, deadline time.Time, stats *runStats) bool {
+	allSent := true
+	for i := range events {
+		if stats != nil {
+			stats.EventsNew++
+			stats.noteHash(events[i].ContentHash)
+			if lag, ok := r.eventLag(time.Now().UTC(), events[i]); ok {
+				stats.noteLag(events[i].AlertType, lag)
+			}
+		}
+		if r.cfg.Seed {
+			r.debugf("seeded path=%q idx=%d", path, events[i].EventIndex)
+			events[i].SentSyslog = true
+			events[i].Seeded = true
+			continue
+		}
+		if w, ok := r.quietWindow(events[i], time.Now()); ok {
+			r.debugf("quiet hours: suppressed path=%q idx=%d reemit=%v", path, events[i].EventIndex, w.reemit)
+			events[i].Suppressed = true
+			// Without reemit the event counts as done; with it, resendPending sends it after the window.
+			events[i].SentSyslog = !w.reemit
+			if w.reemit {
+				allSent = false
+			}
+			if stats != nil {
+				stats.EventsSuppressed++
+			}
+			continue
+		}
+		sent, err := r.sendPaced(events[i], r.eventLabels(events[i], r.eventDBMonth(events[i])), parseSentTo(events[i].SentTo), deadline)
+		events[i].SentTo = addSentTo(events[i].SentTo, sent)
+		if err != nil {
+			r.debugf("syslog send failed path=%q idx=%d err=%v", path, events[i].EventIndex, err)
+			events[i].SentSyslog = false
+			events[i].SendError = err.Error()
+			allSent = false
+			r.countSendError(err, stats)
+		} else {
+			r.debugf("syslog send ok path=%q idx=%d", path, events[i].EventIndex)
+			t := time.Now().UTC()
+			events[i].SentSyslog = true
+			events[i].SentAt = &t
+			if stats != nil {
+				stats.EventsSentOK++
+			}
+		}
+	}
+	return allSent
+}
+
+// sendEvent sends one event's line to the primary output and then to each SyslogDestinations
+// entry (see sendTo).
+func (r *Runner) sendEvent(ev SpoolEvent, msgID string, labels map[string]string, done map[string]bool, deadline time.Time) ([]string, error) {
+	return r.sendTo(r.sendTargets(), ev, msgID, labels, done, deadline)
+}
+
+// sendTo sends ev to each target not in done (delivered by an earlier attempt, see
+// SpoolEvent.SentTo), each with its label subset in the structured data and, for the
+// envelope payload shape, in the meta. The RFC5424 header carries the event time when
+// SyslogTimestampFromEvent is set, the time is known and the sender supports it. A failed
+// target does not stop the others: the keys of the targets delivered are returned with
+// the first error, so a retry only goes to those still owed. The first delivery is copied
+// to AuditDir.
+func (r *Runner) sendTo(targets []sendTarget, ev SpoolEvent, msgID string, labels map[string]string, done map[string]bool, deadline time.Time) ([]string, error) {
+	labels = r.withRunSeq(labels)
+	ts := r.sendTimestamp(ev)
+	var sent []string
+	var firstErr error
+	for _, t := range targets {
+		if done[t.key] {
+			continue
+		}
+		tl, payload := r.targetPayload(ev, t.labels(labels))
+		if err := r.sendWithRetry(t.sender, ts, msgID, r.structuredData(tl), payload, deadline); err != nil {
+			if t.dest != nil {
+				err = fmt.Errorf("destination %s: %w", t.dest.addr, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(sent) == 0 {
+			r.audit(tl, payload)
+		}
+		sent = append(sent, t.key)
+	}
+	return sent, firstErr
+}
+
+// targetPayload encodes ev's payload for a target's labels, returning a copy of them with
+// ct set when the payload is gzipped.
+func (r *Runner) targetPayload(ev SpoolEvent, labels map[string]string) (map[string]string, string) {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out, r.encodePayload(out, r.eventPayload(ev, out))
+}
+
+// withRunSeq returns a copy of labels with the run's run_id and the next seq, so
+// downstream can spot gaps or duplicates among a run's sends, and run_errs, the run's
+// failed event sends so far, to spot events emitted during a degraded run.
+func (r *Runner) withRunSeq(labels map[string]string) map[string]string {
+	if r.runID == "" {
+		return labels
+	}
+	out := make(map[string]string, len(labels)+3)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out["run_id"] = r.runID
+	out["seq"] = strconv.FormatInt(r.runSeq.Add(1), 10)
+	out["run_errs"] = strconv.FormatInt(r.runErrs.Load(), 10)
+	return out
+}
+
+// countSendError counts a failed event send in stats and runErrs, or in
+// EventsConnLimited alone when it never reached the receiver (ErrConnLimit).
+func (r *Runner) countSendError(err error, stats *runStats) {
+	if errors.Is(err, ErrConnLimit) {
+		if stats != nil {
+			stats.EventsConnLimited++
+		}
+		return
+	}
+	r.runErrs.Add(1)
+	if stats != nil {
+		stats.EventsSentErr++
+	}
+}
+
+// sendPaced is sendEvent after waiting for a MaxSendRate slot within the run deadline.
+func (r *Runner) sendPaced(ev SpoolEvent, labels map[string]string, done map[string]bool, deadline time.Time) ([]string, error) {
+	if err := r.limiter.wait(deadline); err != nil {
+		return nil, err
+	}
+	return r.sendEvent(ev, msgIDAlert, labels, done, deadline)
+}
+
+// replayTargets are the destinations a replay sends to: with ReplayDest set, only that
+// destination ("primary" or a SyslogDestinations name/addr), otherwise all of them.
+func (r *Runner) replayTargets() ([]sendTarget, error) {
+	targets := r.sendTargets()
+	switch r.cfg.ReplayDest {
+	case "":
+	case primaryDestination:
+		targets = targets[:1]
+	default:
+		d, ok := r.destination(r.cfg.ReplayDest)
+		if !ok {
+			return nil, fmt.Errorf("unknown replay destination %q", r.cfg.ReplayDest)
+		}
+		targets = []sendTarget{{key: d.key(), sender: d.sender, dest: &d}}
+	}
+	return targets, nil
+}
+
+// defaultSendBackoff is the SendBackoff default; maxSendBackoff caps the doubled wait.
+const (
+	defaultSendBackoff = 200 * time.Millisecond
+	maxSendBackoff     = 10 * time.Second
+)
+
+// sendWithRetry is sendAt, tried up to SendRetries more times with exponential backoff
+// while the deadline allows: a wait that would reach the deadline is not slept, the error
+// is returned instead. The last error is returned once retries run out, and the sender
+// then gets a single attempt per event until one succeeds, so a receiver that is down
+// does not cost every remaining event of the run its full backoff.
+func (r *Runner) sendWithRetry(s SyslogSender, ts time.Time, msgID string, structured string, payload string, deadline time.Time) error {
+	return r.retrySend(s, deadline, func(timeout time.Duration) error {
+		return sendAt(s, ts, msgID, structured, payload, timeout)
+	})
+}
+
+// retrySend runs send, a send through s given its timeout, with sendWithRetry's retries.
+func (r *Runner) retrySend(s SyslogSender, deadline time.Time, send func(timeout time.Duration) error) error {
+	wait := r.cfg.SendBackoff
+	if wait <= 0 {
+		wait = defaultSendBackoff
+	}
+	retries := r.cfg.SendRetries
+	if r.retriesExhausted(s) {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		err := send(remainingTimeout(deadline, 3*time.Second))
+		if err == nil {
+			r.setRetriesExhausted(s, false)
+			return nil
+		}
+		if attempt >= retries {
+			if r.cfg.SendRetries > 0 {
+				r.setRetriesExhausted(s, true)
+			}
+			return err
+		}
+		wait = min(wait, maxSendBackoff)
+		if !deadline.IsZero() && time.Until(deadline) <= wait {
+			return err
+		}
+		r.debugf("send failed, retrying in %s attempt=%d/%d err=%v", wait, attempt+1, retries, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// retriesExhausted reports whether a send to s ran out of retries earlier in this run
+// (see sendWithRetry).
+func (r *Runner) retriesExhausted(s SyslogSender) bool {
+	r.noRetryMu.Lock()
+	defer r.noRetryMu.Unlock()
+	return r.noRetry[s]
+}
+
+func (r *Runner) setRetriesExhausted(s SyslogSender, exhausted bool) {
+	r.noRetryMu.Lock()
+	defer r.noRetryMu.Unlock()
+	if !exhausted {
+		delete(r.noRetry, s)
+		return
+	}
+	if r.noRetry == nil {
+		r.noRetry = make(map[SyslogSender]bool)
+	}
+	r.noRetry[s] = true
+}
+
+// sendTimestamp is the RFC5424 TIMESTAMP for ev: its event time with
+// SyslogTimestampFromEvent, otherwise zero (send time).
+func (r *Runner) sendTimestamp(ev SpoolEvent) time.Time {
+	if r.cfg.SyslogTimestampFromEvent {
+		if t, ok := r.eventTime(ev); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// eventLabels returns the structured-data labels shared by every event send path. dbMonth
+// is the YYYYMM key of the DB ev is stored in (db_month), empty for the legacy single DB.
+func (r *Runner) eventLabels(ev SpoolEvent, dbMonth string) map[string]string {
+	level := ev.AlertLevel
+	if strings.TrimSpace(level) == "" {
+		level = "unknown"
+	}
+	labels := map[string]string{
+		"job":         r.cfg.JobLabel,
+		"service":     r.cfg.ServiceLabel,
+		"env":         r.cfg.FixedLabels["env"],
+		"site":        r.cfg.FixedLabels["site"],
+		"cluster":     r.cfg.FixedLabels["cluster"],
+		"filename":    filepath.Base(ev.SourcePath),
+		"alert_type":  ev.AlertType,
+		"alert_level": level,
+		"hash":        ev.ContentHash,
+		"cccc":        ev.CCCC,
+	}
+	if ev.DecodeError != "" {
+		// Make parse failures filterable downstream; they carry no hash.
+		labels["error"] = "decode"
+	}
+	if dbMonth != "" {
+		labels["db_month"] = dbMonth
+	}
+	if id := r.traceID(ev); id != "" {
+		labels["trace_id"] = id
+	}
+	return labels
+}
+
+func (r *Runner) flattenEnabled() bool {
+	return r.cfg.FlattenEnabled == nil || *r.cfg.FlattenEnabled
+}
+
+// itemTraceID is the TraceIDField value of a decoded item as a string, or "" when unset
+// or missing. A key containing the whole dotted path is matched too.
+func (r *Runner) itemTraceID(item any) string {
+	m, ok := item.(map[string]any)
+	if r.cfg.TraceIDField == "" || !ok {
+		return ""
+	}
+	v, ok := lookupPath(m, splitFieldPath(r.cfg.TraceIDField))
+	if !ok {
+		v = m[r.cfg.TraceIDField]
+	}
+	return traceIDString(v)
+}
+
+// traceID is the TraceIDField value of ev as a string, or "" when unset or missing:
+// SpoolEvent.TraceID, or for rows archived without it, the value in the stored event.
+func (r *Runner) traceID(ev SpoolEvent) string {
+	if ev.TraceID != "" {
+		return ev.TraceID
+	}
+	if r.cfg.TraceIDField == "" {
+		return ""
+	}
+	if !r.flattenEnabled() {
+		return r.itemTraceID(jsonAnyFromString(ev.EventJSON))
+	}
+	var flat map[string]any
+	if err := json.Unmarshal([]byte(ev.FlatJSON), &flat); err != nil {
+		return ""
+	}
+	return traceIDString(flat[r.cfg.TraceIDField])
+}
+
+// traceIDString formats a trace id value as sent in the trace_id label.
+func traceIDString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// eventDBMonth is the YYYYMM key of the monthly DB a new event is stored in: its event
+// month with DBByEventTime, otherwise the run's DB. It is empty for the legacy single DB.
+func (r *Runner) eventDBMonth(ev SpoolEvent) string {
+	if strings.TrimSpace(r.cfg.DBFolder) == "" {
+		return ""
+	}
+	if r.routeByEventTime() {
+		return monthKey(r.eventMonthTime(ev))
+	}
+	return r.dbKey
+}
+
+// eventPayload builds the syslog message body (JSON) for an archived event; with
+// PayloadShape "envelope" it is wrapped as {"meta": labels, "body": ...}.
+func (r *Runner) eventPayload(ev SpoolEvent, labels map[string]string) string {
+	payload := map[string]any{
+		"source":      ev.SourcePath,
+		"event_index": ev.EventIndex,
+		"event":       json.RawMessage(ev.EventJSON),
+	}
+	if r.flattenEnabled() {
+		payload["flat"] = json.RawMessage(ev.FlatJSON)
+	}
+	if ev.DecodeError != "" {
+		payload["error"] = ev.DecodeError
+	}
+	if ev.AlertTypeSrc != "" {
+		payload["alert_type_src"] = ev.AlertTypeSrc
+	}
+	if r.cfg.PayloadIncludeNormalized {
+		payload["normalized"] = ev.Normalized
+	}
+	if id := r.traceID(ev); id != "" {
+		payload["trace_id"] = id
+	}
+	if r.cfg.PayloadShape == "envelope" {
+		payload = map[string]any{"meta": labels, "body": payload}
+	}
+	b, _ := json.Marshal(payload)
+	return string(b)
+}
+
+// encodePayload gzips and base64-encodes payloads of at least PayloadGzipMinBytes
+// and marks them with ct="gzip" in labels so Alloy can decompress them.
+func (r *Runner) encodePayload(labels map[string]string, payload string) string {
+	if r.cfg.PayloadGzipMinBytes <= 0 || len(payload) < r.cfg.PayloadGzipMinBytes {
+		return payload
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(payload)); err != nil {
+		return payload
+	}
+	if err := zw.Close(); err != nil {
+		return payload
+	}
+	labels["ct"] = "gzip"
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
 func jsonAnyFromString(s string) any {
 	var v any
 	_ = json.Unmarshal([]byte(s), &v)
 	return v
 }
 
+// tryDeleteProcessedFile removes the processed file at path and marks its row deleted. A
+// shard directory is removed as a whole only while its shards still hash to sha: shards
+// written after ingest have not been sent, so the directory is left for the next run to
+// ingest its new content.
 func (r *Runner) tryDeleteProcessedFile(path string, sha string) error {
-	removeErr := os.Remove(path)
+	remove := r.fs.Remove
+	if r.isShardDir(path) {
+		same, err := r.fileHasSHA(path, sha)
+		if err == nil && !same {
+			err = fmt.Errorf("shard directory changed since ingest")
+		}
+		if err != nil {
+			_ = r.db.Model(&ProcessedFile{}).
+				Where("path = ? AND sha256 = ?", path, sha).
+				Updates(map[string]any{"last_error": fmt.Sprintf("delete skipped: %v", err)}).Error
+			return err
+		}
+		remove = r.fs.RemoveAll
+	}
+	removeErr := remove(path)
 	now := time.Now().UTC()
 	if removeErr != nil {
 		_ = r.db.Model(&ProcessedFile{}).
@@ -911,120 +3100,267 @@ func (r *Runner) tryDeleteProcessedFile(path string, sha string) error {
 }
 
 func (r *Runner) resendPending(deadline time.Time, stats *runStats) error {
+	dbs, err := r.eventDBs()
+	if err != nil {
+		return err
+	}
+	r.warnStrandedPending()
+	for _, db := range dbs {
+		if err := r.resendPendingIn(db, r.dbMonthOf(db), deadline, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbMonthOf is the YYYYMM key of db, the current DB or one opened by dbForMonth; it is
+// empty for the legacy single DB.
+func (r *Runner) dbMonthOf(db *gorm.DB) string {
+	if strings.TrimSpace(r.cfg.DBFolder) == "" {
+		return ""
+	}
+	if db == r.db {
+		return r.dbKey
+	}
+	r.monthDBsMu.Lock()
+	defer r.monthDBsMu.Unlock()
+	for key, mdb := range r.monthDBs {
+		if mdb == db {
+			return key
+		}
+	}
+	return ""
+}
+
+// resendPendingIn resends the pending events of db, whose YYYYMM key is dbMonth.
+func (r *Runner) resendPendingIn(db *gorm.DB, dbMonth string, deadline time.Time, stats *runStats) error {
 	var pending []SpoolEvent
-	if err := r.db.Where("sent_syslog = ?", false).Find(&pending).Error; err != nil {
+	if err := db.Where("sent_syslog = ?", false).Find(&pending).Error; err != nil {
 		return err
 	}
 	for _, ev := range pending {
 		if isDeadlineExceeded(deadline) {
-			return fmt.Errorf("timeout exceeded")
-		}
-		if stats != nil {
-			if lag, ok := computeLag(time.Now().UTC(), jsonAnyFromString(ev.EventJSON)); ok {
-				if lag > stats.MaxLag {
-					stats.MaxLag = lag
-				}
-			}
+			return ErrRunTimeout
 		}
-		structured := buildStructuredData("cndp", map[string]string{
-			"job":        r.cfg.JobLabel,
-			"service":    r.cfg.ServiceLabel,
-			"env":        r.cfg.FixedLabels["env"],
-			"site":       r.cfg.FixedLabels["site"],
-			"cluster":    r.cfg.FixedLabels["cluster"],
-			"filename":   filepath.Base(ev.SourcePath),
-			"alert_type": ev.AlertType,
-			"alert_level": func() string {
-				if strings.TrimSpace(ev.AlertLevel) == "" {
-					return "unknown"
-				}
-				return ev.AlertLevel
-			}(),
-			"hash": ev.ContentHash,
-			"cccc": ev.CCCC,
-		})
-		payload := map[string]any{
-			"source":      ev.SourcePath,
-			"event_index": ev.EventIndex,
-			"event":       json.RawMessage(ev.EventJSON),
-			"flat":        json.RawMessage(ev.FlatJSON),
-		}
-		payloadBytes, _ := json.Marshal(payload)
-		err := r.syslog.SendRFC5424Timeout("alert-spooler", structured, string(payloadBytes), remainingTimeout(deadline, 3*time.Second))
-		if err != nil {
-			r.debugf("resend failed id=%d path=%q err=%v", ev.ID, ev.SourcePath, err)
-			_ = r.db.Model(&SpoolEvent{}).
+		_, _ = r.resendEvent(db, dbMonth, ev, deadline, stats)
+	}
+	return nil
+}
+
+// resendEvent resends the pending ev of db (YYYYMM key dbMonth) to the targets its SentTo
+// does not list yet, unless a quiet window holds it. ev is marked sent once every target
+// has it, and it reports whether ev is now done (sent, or suppressed without reemit). A
+// failed send is recorded on ev, counted and returned.
+func (r *Runner) resendEvent(db *gorm.DB, dbMonth string, ev SpoolEvent, deadline time.Time, stats *runStats) (bool, error) {
+	if w, ok := r.quietWindow(ev, time.Now()); ok {
+		// A failed send is held by a quiet window like a new event would be.
+		if !ev.Suppressed {
+			r.debugf("quiet hours: resend suppressed id=%d path=%q reemit=%v", ev.ID, ev.SourcePath, w.reemit)
+			_ = db.Model(&SpoolEvent{}).
 				Where("id = ?", ev.ID).
-				Updates(map[string]any{"send_error": err.Error()}).Error
+				Updates(map[string]any{"suppressed": true, "sent_syslog": !w.reemit}).Error
 			if stats != nil {
-				stats.EventsSentErr++
+				stats.EventsSuppressed++
 			}
-			continue
+			return !w.reemit, nil
 		}
-		r.debugf("resend ok id=%d path=%q", ev.ID, ev.SourcePath)
-		now := time.Now().UTC()
-		_ = r.db.Model(&SpoolEvent{}).
-			Where("id = ?", ev.ID).
-			Updates(map[string]any{"sent_syslog": true, "send_error": "", "sent_at": &now}).Error
-		if stats != nil {
-			stats.EventsSentOK++
+		return false, nil
+	}
+	if stats != nil {
+		if lag, ok := r.eventLag(time.Now().UTC(), ev); ok {
+			stats.noteLag(ev.AlertType, lag)
 		}
 	}
-	return nil
+	labels := r.eventLabels(ev, dbMonth)
+	labels["resend"] = "true"
+	if ev.Suppressed {
+		labels["quiet"] = "true"
+	}
+	sent, err := r.sendPaced(ev, labels, parseSentTo(ev.SentTo), deadline)
+	sentTo := addSentTo(ev.SentTo, sent)
+	if err != nil {
+		r.debugf("resend failed id=%d path=%q err=%v", ev.ID, ev.SourcePath, err)
+		_ = db.Model(&SpoolEvent{}).
+			Where("id = ?", ev.ID).
+			Updates(map[string]any{"send_error": err.Error(), "sent_to": sentTo}).Error
+		r.countSendError(err, stats)
+		return false, err
+	}
+	r.debugf("resend ok id=%d path=%q", ev.ID, ev.SourcePath)
+	now := time.Now().UTC()
+	_ = db.Model(&SpoolEvent{}).
+		Where("id = ?", ev.ID).
+		Updates(map[string]any{"sent_syslog": true, "send_error": "", "sent_to": sentTo, "sent_at": &now}).Error
+	if stats != nil {
+		stats.EventsSentOK++
+	}
+	return true, nil
 }
 
-func (r *Runner) finalizeFiles(stats *runStats) error {
-	var pfs []ProcessedFile
-	if err := r.db.Where("all_sent = ? OR deleted = ?", false, false).Find(&pfs).Error; err != nil {
+func (r *Runner) finalizeFiles(deadline time.Time, stats *runStats) error {
+	dbs, err := r.eventDBs()
+	if err != nil {
 		return err
 	}
-	for _, pf := range pfs {
-		var total int64
-		var sent int64
-		if err := r.db.Model(&SpoolEvent{}).
-			Where("source_path = ? AND file_sha256 = ?", pf.Path, pf.SHA256).
-			Count(&total).Error; err != nil {
-			continue
+	batchSize := r.cfg.FinalizeBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultFinalizeBatchSize
+	}
+	// Page by id so memory stays bounded and rows updated along the way are not revisited.
+	var lastID uint
+	for {
+		if isDeadlineExceeded(deadline) {
+			return ErrRunTimeout
 		}
-		if total == 0 {
-			continue
+		var pfs []ProcessedFile
+		if err := r.db.Where("(all_sent = ? OR deleted = ?) AND id > ?", false, false, lastID).
+			Order("id").
+			Limit(batchSize).
+			Find(&pfs).Error; err != nil {
+			return err
 		}
-		if err := r.db.Model(&SpoolEvent{}).
-			Where("source_path = ? AND file_sha256 = ? AND sent_syslog = ?", pf.Path, pf.SHA256, true).
-			Count(&sent).Error; err != nil {
-			continue
+		if len(pfs) == 0 {
+			break
 		}
-		allSent := sent == total
-		if allSent && !pf.AllSent {
-			_ = r.db.Model(&ProcessedFile{}).
-				Where("id = ?", pf.ID).
-				Updates(map[string]any{"all_sent": true, "last_error": ""}).Error
-		}
-		if r.cfg.DeleteAfterSend && allSent && !pf.Deleted {
-			// If file already missing, mark deleted to stop retry loop.
-			if _, statErr := os.Stat(pf.Path); statErr != nil {
-				now := time.Now().UTC()
-				_ = r.db.Model(&ProcessedFile{}).
-					Where("id = ?", pf.ID).
-					Updates(map[string]any{"deleted": true, "deleted_at": &now, "last_error": "file missing"}).Error
+		lastID = pfs[len(pfs)-1].ID
+
+		counts, err := countFileEvents(dbs, pfs)
+		if err != nil {
+			return err
+		}
+		for _, pf := range pfs {
+			c := counts[fileEventKey{Path: pf.Path, SHA256: pf.SHA256}]
+			if c.Total == 0 {
 				continue
 			}
-			if err := r.tryDeleteProcessedFile(pf.Path, pf.SHA256); err == nil {
-				r.debugf("finalize deleted path=%q", pf.Path)
-				if stats != nil {
-					stats.FilesDeleted++
-				}
-			}
+			r.finalizeFile(pf, c.Sent == c.Total, stats)
+		}
+		if len(pfs) < batchSize {
+			break
 		}
 	}
+	if err := r.pruneProcessedFiles(); err != nil {
+		return err
+	}
+	if err := r.pruneDecodePending(); err != nil {
+		return err
+	}
+	if stats != nil {
+		// The count only feeds the deadman; failing it must not fail the finalize.
+		stuck, err := r.countStuckFiles()
+		if err != nil {
+			log.Printf("warn: count stuck files failed: %v", err)
+		}
+		stats.FilesStuck = stuck
+	}
+	return nil
+}
+
+// pruneProcessedFiles drops bookkeeping rows of files deleted before the retention window;
+// their source files are gone, so the rows no longer guard against re-ingestion.
+func (r *Runner) pruneProcessedFiles() error {
+	if r.cfg.ProcessedFileRetention <= 0 {
+		return nil
+	}
+	cutoff := time.Now().UTC().Add(-r.cfg.ProcessedFileRetention)
+	res := r.db.Where("deleted = ? AND all_sent = ? AND COALESCE(deleted_at, processed_at) < ?", true, true, cutoff).
+		Delete(&ProcessedFile{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		r.debugf("pruned %d processed_file row(s) older than %s", res.RowsAffected, r.cfg.ProcessedFileRetention)
+	}
 	return nil
 }
 
+// finalizeFile marks a file all-sent and deletes it (DeleteAfterSend) once all its events are sent.
+func (r *Runner) finalizeFile(pf ProcessedFile, allSent bool, stats *runStats) {
+	if allSent && !pf.AllSent {
+		_ = r.db.Model(&ProcessedFile{}).
+			Where("id = ?", pf.ID).
+			Updates(map[string]any{"all_sent": true, "last_error": ""}).Error
+	}
+	if !r.cfg.DeleteAfterSend || !allSent || pf.Deleted {
+		return
+	}
+	// If file already missing, mark deleted to stop retry loop.
+	if _, statErr := r.fs.Stat(pf.Path); statErr != nil {
+		now := time.Now().UTC()
+		_ = r.db.Model(&ProcessedFile{}).
+			Where("id = ?", pf.ID).
+			Updates(map[string]any{"deleted": true, "deleted_at": &now, "last_error": "file missing"}).Error
+		return
+	}
+	if err := r.tryDeleteProcessedFile(pf.Path, pf.SHA256); err == nil {
+		r.debugf("finalize deleted path=%q", pf.Path)
+		if stats != nil {
+			stats.FilesDeleted++
+		}
+	}
+}
+
+type fileEventKey struct {
+	Path   string
+	SHA256 string
+}
+
+type fileEventCount struct {
+	Total int64
+	Sent  int64
+}
+
+// countFileEvents counts the events (total and sent) of each file in pfs across dbs,
+// with one grouped query per DB.
+func countFileEvents(dbs []*gorm.DB, pfs []ProcessedFile) (map[fileEventKey]fileEventCount, error) {
+	paths := make([]string, 0, len(pfs))
+	for _, pf := range pfs {
+		paths = append(paths, pf.Path)
+	}
+	out := make(map[fileEventKey]fileEventCount, len(pfs))
+	for _, db := range dbs {
+		var rows []struct {
+			SourcePath string
+			FileSHA256 string `gorm:"column:file_sha256"`
+			Total      int64
+			Sent       int64
+		}
+		if err := db.Model(&SpoolEvent{}).
+			Select("source_path, file_sha256, COUNT(*) AS total, SUM(CASE WHEN sent_syslog THEN 1 ELSE 0 END) AS sent").
+			Where("source_path IN ?", paths).
+			Group("source_path, file_sha256").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			k := fileEventKey{Path: row.SourcePath, SHA256: row.FileSHA256}
+			c := out[k]
+			c.Total += row.Total
+			c.Sent += row.Sent
+			out[k] = c
+		}
+	}
+	return out, nil
+}
+
+// countStuckFiles counts files that were sent OK but whose deletion keeps failing.
+// finalizeFiles retries them every run; surfacing the count lets operators alert on it.
+func (r *Runner) countStuckFiles() (int, error) {
+	var n int64
+	err := r.db.Model(&ProcessedFile{}).
+		Where("all_sent = ? AND deleted = ? AND last_error != ?", true, false, "").
+		Count(&n).Error
+	return int(n), err
+}
+
 func (r *Runner) sendDeadman(deadline time.Time, start time.Time, end time.Time, stats *runStats, runErr error) error {
 	status := "ok"
 	errMsg := ""
 	if runErr != nil {
 		status = "error"
+		if errors.Is(runErr, ErrRunTimeout) {
+			status = "timeout"
+		}
 		errMsg = runErr.Error()
 	}
 	maxLagMs := int64(0)
@@ -1032,24 +3368,46 @@ func (r *Runner) sendDeadman(deadline time.Time, start time.Time, end time.Time,
 		maxLagMs = stats.MaxLag.Milliseconds()
 	}
 	msg := map[string]any{
-		"deadman":           r.cfg.DeadmanToken,
-		"status":            status,
-		"error":             errMsg,
-		"started_at":        start.UTC().Format(time.RFC3339Nano),
-		"ended_at":          end.UTC().Format(time.RFC3339Nano),
-		"duration_ms":       end.Sub(start).Milliseconds(),
-		"events_new":        stats.EventsNew,
-		"events_sent_ok":    stats.EventsSentOK,
-		"events_sent_err":   stats.EventsSentErr,
-		"events_replay_ok":  stats.EventsReplayOK,
-		"events_replay_err": stats.EventsReplayErr,
-		"files_ingested":    stats.FilesIngested,
-		"files_deleted":     stats.FilesDeleted,
-		"max_lag_ms":        maxLagMs,
+		"deadman":               r.cfg.DeadmanToken,
+		"status":                status,
+		"error":                 errMsg,
+		"started_at":            start.UTC().Format(time.RFC3339Nano),
+		"ended_at":              end.UTC().Format(time.RFC3339Nano),
+		"duration_ms":           end.Sub(start).Milliseconds(),
+		"events_new":            stats.EventsNew,
+		"distinct_hashes":       stats.DistinctHashes,
+		"top_hashes":            stats.topHashes(topHashesInDeadman),
+		"events_sent_ok":        stats.EventsSentOK,
+		"events_sent_err":       stats.EventsSentErr,
+		"events_conn_limited":   stats.EventsConnLimited,
+		"events_replay_ok":      stats.EventsReplayOK,
+		"events_replay_err":     stats.EventsReplayErr,
+		"events_replay_skipped": stats.EventsReplaySkipped,
+		"events_suppressed":     stats.EventsSuppressed,
+		"files_ingested":        stats.FilesIngested,
+		"files_deleted":         stats.FilesDeleted,
+		"files_stuck":           stats.FilesStuck,
+		"config_hash":           r.configHash,
+		"run_id":                r.runID,
+		"decode_errors":         stats.DecodeErrors,
+		"flatten_truncated":     stats.FlattenTruncated,
+		"max_lag_ms":            maxLagMs,
+	}
+	lagByType := make(map[string]any, len(stats.LagByType))
+	for t, l := range stats.LagByType {
+		lagByType[t] = map[string]any{
+			"max_ms": l.Max.Milliseconds(),
+			"avg_ms": (l.Sum / time.Duration(l.Count)).Milliseconds(),
+			"count":  l.Count,
+		}
+	}
+	msg["lag_by_type"] = lagByType
+	if stats.DiskLow {
+		msg["disk_free_bytes"] = stats.DiskFreeBytes
 	}
 	b, _ := json.Marshal(msg)
 
-	structured := buildStructuredData("cndp", map[string]string{
+	structured := r.structuredData(map[string]string{
 		"job":         r.cfg.JobLabel,
 		"service":     r.cfg.ServiceLabel,
 		"env":         r.cfg.FixedLabels["env"],
@@ -1062,7 +3420,57 @@ func (r *Runner) sendDeadman(deadline time.Time, start time.Time, end time.Time,
 		"cccc":        "none",
 		"deadman":     r.cfg.DeadmanToken,
 	})
-	return r.syslog.SendRFC5424Timeout("alert-spooler", structured, string(b), remainingTimeout(deadline, 3*time.Second))
+	return r.syslog.SendRFC5424Timeout("alert-spooler", msgIDDeadman, structured, string(b), remainingTimeout(deadline, 3*time.Second))
+}
+
+// SendLifecycle sends a kind="lifecycle" event for phase ("start" or "stop") carrying the
+// version and a config fingerprint, so process restarts are visible apart from per-run deadman.
+func (r *Runner) SendLifecycle(phase string) error {
+	host, _ := hostname()
+	msg := map[string]any{
+		"lifecycle":          phase,
+		"version":            r.cfg.Version,
+		"config_fingerprint": configFingerprint(r.cfg),
+		"host":               host,
+		"pid":                os.Getpid(),
+		"at":                 time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	b, _ := json.Marshal(msg)
+
+	structured := r.structuredData(map[string]string{
+		"job":         r.cfg.JobLabel,
+		"service":     r.cfg.ServiceLabel,
+		"env":         r.cfg.FixedLabels["env"],
+		"site":        r.cfg.FixedLabels["site"],
+		"cluster":     r.cfg.FixedLabels["cluster"],
+		"filename":    "-",
+		"alert_type":  "lifecycle",
+		"alert_level": "unknown",
+		"hash":        "lifecycle",
+		"cccc":        "none",
+		"kind":        "lifecycle",
+	})
+	return r.syslog.SendRFC5424Timeout("alert-spooler", msgIDLifecycle, structured, string(b), remainingTimeout(time.Time{}, 3*time.Second))
+}
+
+// configFingerprint is a short hash of the effective config (excluding Version), to tell
+// whether restarted processes run the same configuration.
+func configFingerprint(cfg RunnerConfig) string {
+	h := configHash(cfg)
+	if h == "unknown" {
+		return h
+	}
+	return h[:12]
+}
+
+// configHash is the sha256 (hex) of the config as JSON, excluding Version.
+func configHash(cfg RunnerConfig) string {
+	cfg.Version = ""
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "unknown"
+	}
+	return HashNormalized(string(b), 0)
 }
 
 func newErrorEvent(sourcePath string, sourceType string, alertType string, fileSHA string, raw string, err error) SpoolEvent {
@@ -1080,20 +3488,100 @@ func newErrorEvent(sourcePath string, sourceType string, alertType string, fileS
 		FlatJSON:         "{}",
 		Normalized:       "",
 		ContentHash:      "",
+		DecodeError:      fmt.Sprintf("decode/build error: %v", err),
 		SentSyslog:       false,
-		SendError:        fmt.Sprintf("decode/build error: %v", err),
 		ArchivedAt:       now,
 	}
 }
 
+// defaultSDOrder is the structured-data param order used unless SDOrder is set.
+var defaultSDOrder = []string{"job", "service", "env", "site", "cluster", "filename", "alert_type", "alert_level", "hash", "cccc", "trace_id", "error", "ct", "resend", "replay", "db_month", "run_id", "seq", "run_errs", "deadman", "kind"}
+
+// defaultSDID is the SD-ID used unless SDID is set.
+const defaultSDID = "cndp"
+
+// sdID is SDID, or defaultSDID when unset.
+func (c RunnerConfig) sdID() string {
+	if c.SDID == "" {
+		return defaultSDID
+	}
+	return c.SDID
+}
+
+// structuredData builds the SDID structured data for kv in SDOrder (or defaultSDOrder).
+func (r *Runner) structuredData(kv map[string]string) string {
+	order := defaultSDOrder
+	if len(r.cfg.SDOrder) > 0 {
+		order = r.cfg.SDOrder
+	}
+	if len(r.cfg.SDGroups) == 0 {
+		return buildStructuredDataOrdered(r.cfg.sdID(), kv, order)
+	}
+	base := make(map[string]string, len(kv))
+	for k, v := range kv {
+		base[k] = v
+	}
+	ids := make([]string, 0, len(r.cfg.SDGroups))
+	for id := range r.cfg.SDGroups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	elems := []sdElement{{id: r.cfg.sdID(), kv: base}}
+	for _, id := range ids {
+		group := make(map[string]string)
+		for _, k := range r.cfg.SDGroups[id] {
+			if v, ok := base[k]; ok {
+				group[k] = v
+				delete(base, k)
+			}
+		}
+		elems = append(elems, sdElement{id: id, kv: group})
+	}
+	return buildStructuredDataElements(elems, order)
+}
+
+// sdElement is one structured-data element: an SD-ID and its params.
+type sdElement struct {
+	id string
+	kv map[string]string
+}
+
+// buildStructuredDataElements writes one element per entry, in order, each with its
+// params ordered as by buildStructuredDataOrdered. Elements after the first are omitted
+// when they have no non-empty params.
+func buildStructuredDataElements(elems []sdElement, preferredOrder []string) string {
+	var b strings.Builder
+	for i, e := range elems {
+		if i > 0 && !hasNonEmptyParam(e.kv) {
+			continue
+		}
+		b.WriteString(buildStructuredDataOrdered(e.id, e.kv, preferredOrder))
+	}
+	return b.String()
+}
+
+func hasNonEmptyParam(kv map[string]string) bool {
+	for k, v := range kv {
+		if strings.TrimSpace(v) != "" && sanitizeSDName(k) != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func buildStructuredData(sdID string, kv map[string]string) string {
+	return buildStructuredDataOrdered(sdID, kv, defaultSDOrder)
+}
+
+// buildStructuredDataOrdered writes kv's non-empty params in preferredOrder, then the
+// remaining ones sorted by key.
+func buildStructuredDataOrdered(sdID string, kv map[string]string, preferredOrder []string) string {
 	if sdID == "" {
-		sdID = "cndp"
+		sdID = defaultSDID
 	}
 	var b strings.Builder
 	b.WriteString("[")
 	b.WriteString(sdID)
-	preferredOrder := []string{"job", "service", "env", "site", "cluster", "filename", "alert_type", "alert_level", "hash", "cccc", "replay", "deadman"}
 	seen := make(map[string]struct{}, len(kv))
 	for _, k := range preferredOrder {
 		v, ok := kv[k]
@@ -1104,8 +3592,12 @@ func buildStructuredData(sdID string, kv map[string]string) string {
 			continue
 		}
 		seen[k] = struct{}{}
+		name := sanitizeSDName(k)
+		if name == "" {
+			continue
+		}
 		b.WriteString(" ")
-		b.WriteString(k)
+		b.WriteString(name)
 		b.WriteString("=\"")
 		b.WriteString(escapeSDParam(v))
 		b.WriteString("\"")
@@ -1123,8 +3615,12 @@ func buildStructuredData(sdID string, kv map[string]string) string {
 	sort.Strings(extraKeys)
 	for _, k := range extraKeys {
 		v := kv[k]
+		name := sanitizeSDName(k)
+		if name == "" {
+			continue
+		}
 		b.WriteString(" ")
-		b.WriteString(k)
+		b.WriteString(name)
 		b.WriteString("=\"")
 		b.WriteString(escapeSDParam(v))
 		b.WriteString("\"")
@@ -1133,6 +3629,25 @@ func buildStructuredData(sdID string, kv map[string]string) string {
 	return b.String()
 }
 
+// sdNameMaxLen is the RFC5424 limit on an SD-NAME (PARAM-NAME).
+const sdNameMaxLen = 32
+
+// sanitizeSDName makes a label key a valid SD-NAME: printable US-ASCII other than '=',
+// space, ']' and '"' (anything else becomes '_'), at most 32 bytes. Keys may come from
+// event fields, which must not break the structured-data grammar. Empty stays empty.
+func sanitizeSDName(k string) string {
+	name := strings.Map(func(c rune) rune {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			return '_'
+		}
+		return c
+	}, k)
+	if len(name) > sdNameMaxLen {
+		name = name[:sdNameMaxLen]
+	}
+	return name
+}
+
 func escapeSDParam(v string) string {
 	v = strings.ReplaceAll(v, "\\", "\\\\")
 	v = strings.ReplaceAll(v, "\"", "\\\"")
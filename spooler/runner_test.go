@@ -1,16 +1,28 @@
 package spooler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type mockSyslogSender struct {
@@ -21,15 +33,16 @@ type mockSyslogSender struct {
 
 type mockSyslogCall struct {
 	appName         string
+	msgID           string
 	structuredData  string
 	message         string
 	timeoutArgument time.Duration
 }
 
-func (m *mockSyslogSender) SendRFC5424Timeout(appName string, structuredData string, message string, timeout time.Duration) error {
+func (m *mockSyslogSender) SendRFC5424Timeout(appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.calls = append(m.calls, mockSyslogCall{appName: appName, structuredData: structuredData, message: message, timeoutArgument: timeout})
+	m.calls = append(m.calls, mockSyslogCall{appName: appName, msgID: msgID, structuredData: structuredData, message: message, timeoutArgument: timeout})
 	if m.failN > 0 {
 		m.failN--
 		return errors.New("mock syslog send failure")
@@ -354,6 +367,132 @@ func TestRunner_SendFailureDoesNotDelete_ThenResendDeletes(t *testing.T) {
 	}
 }
 
+func TestRunner_SendRetriesWithinRun(t *testing.T) {
+	tmp := t.TempDir()
+	p := filepath.Join(tmp, "a.warn")
+	if err := os.WriteFile(p, mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		SendRetries:     2,
+		SendBackoff:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	sender.FailNext(2)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Calls()); n != 3 {
+		t.Fatalf("expected two failed attempts and one success, got %d calls", n)
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !ev.SentSyslog || ev.SendError != "" {
+		t.Fatalf("expected the event sent within the run, got sent=%v send_error=%q", ev.SentSyslog, ev.SendError)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("expected the file deleted after the retried send, stat err=%v", err)
+	}
+}
+
+func TestRunner_ConnLimitTimeoutCountedApartFromSendErrors(t *testing.T) {
+	tmp := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	// The only connection slot is taken, so the send never reaches the receiver.
+	limiter := NewConnLimiter(1)
+	if err := limiter.acquire(0); err != nil {
+		t.Fatal(err)
+	}
+	runner.syslog = NewSyslogClientWithOptions("127.0.0.1:1", SyslogOptions{Limiter: limiter})
+
+	stats := &runStats{}
+	events := []SpoolEvent{{SourcePath: "a.warn", AlertType: "general"}}
+	if runner.sendNewEvents("a.warn", events, time.Now().Add(100*time.Millisecond), stats) {
+		t.Fatal("expected the send to fail")
+	}
+	if stats.EventsConnLimited != 1 || stats.EventsSentErr != 0 || runner.runErrs.Load() != 0 {
+		t.Fatalf("expected the timeout counted as conn limited only, got conn_limited=%d sent_err=%d run_errs=%d", stats.EventsConnLimited, stats.EventsSentErr, runner.runErrs.Load())
+	}
+	if !strings.Contains(events[0].SendError, "connection limit") || events[0].SentSyslog {
+		t.Fatalf("expected the event left pending with the limit error, got %+v", events[0])
+	}
+}
+
+func TestRunner_SendRetriesStopOnceExhausted(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"a.warn", "b.warn"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), mustBuildFixtureJSON(t, "detail "+name+" ZBBB"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SendRetries:  2,
+		SendBackoff:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	sender.FailNext(100)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	// The first event uses its retries; every later send (the second event, then both
+	// resends) is tried once.
+	if n := len(sender.Calls()); n != 6 {
+		t.Fatalf("expected 3 attempts for the first event and 1 for each later send, got %d calls", n)
+	}
+
+	// A new run retries again.
+	sender.FailNext(0)
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var pending int64
+	if err := runner.db.Model(&SpoolEvent{}).Where("sent_syslog = ?", false).Count(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected both events sent by the next run, %d pending", pending)
+	}
+}
+
 func TestRunner_FixedLabelsAppearInStructuredData(t *testing.T) {
 	tmp := t.TempDir()
 	if err := os.MkdirAll(filepath.Join(tmp, "general"), 0o755); err != nil {
@@ -463,6 +602,127 @@ func TestRunner_ErrorDirMovesBadJSON(t *testing.T) {
 	}
 }
 
+func TestRunner_DecodeRetriesIngestsFileFixedLater(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	errorDir := filepath.Join(tmp, "general_err")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half-written by the producer on the first run.
+	src := filepath.Join(alertDir, "late.warn")
+	full := mustBuildFixtureJSON(t, "detail ZBBB")
+	if err := os.WriteFile(src, full[:len(full)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general", ErrorDir: errorDir}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DecodeRetries:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected malformed file left in place for a retry: %v", err)
+	}
+	if len(sender.Calls()) != 0 {
+		t.Fatalf("expected nothing sent for a deferred decode error, got %d calls", len(sender.Calls()))
+	}
+	var pf ProcessedFile
+	if err := runner.db.Where("path = ?", src).First(&pf).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !pf.DecodePending || pf.DecodeAttempts != 1 {
+		t.Fatalf("expected pending row with 1 attempt, got %+v", pf)
+	}
+
+	if err := os.WriteFile(src, full, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 || strings.Contains(calls[0].structuredData, "error=") {
+		t.Fatalf("expected one successful event send, got %+v", calls)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected ingested file deleted, stat err=%v", err)
+	}
+	if moved, _ := filepath.Glob(filepath.Join(errorDir, "*")); len(moved) != 0 {
+		t.Fatalf("expected nothing quarantined, got %v", moved)
+	}
+	var pending int64
+	if err := runner.db.Model(&ProcessedFile{}).Where("decode_pending = ?", true).Count(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected the retry row cleared, got %d", pending)
+	}
+}
+
+func TestRunner_DecodeRetryRowDroppedWhenFileDisappears(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "late.warn")
+	if err := os.WriteFile(src, []byte(`{"code":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		JobLabel:      "mhdbs",
+		InputGlobs:    []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:    "127.0.0.1:1",
+		DecodeRetries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	countPending := func() int64 {
+		var n int64
+		if err := runner.db.Model(&ProcessedFile{}).Where("decode_pending = ?", true).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := countPending(); n != 1 {
+		t.Fatalf("expected a pending retry row, got %d", n)
+	}
+
+	// The producer gives up on the file before the retry.
+	if err := os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countPending(); n != 0 {
+		t.Fatalf("expected the retry row of the missing file dropped, got %d", n)
+	}
+}
+
 func mustBuildFixtureJSON(t *testing.T, detail string) []byte {
 	t.Helper()
 	fixture := map[string]any{
@@ -609,96 +869,3767 @@ func TestRunner_ReplayFrom_AddsReplayLabel(t *testing.T) {
 	}
 }
 
-func TestRunner_CCCCEnabledDerivedFromCodes_IgnoresFlag(t *testing.T) {
+func TestRunner_MsgIDByCategory(t *testing.T) {
 	tmp := t.TempDir()
-	alertDir := filepath.Join(tmp, "general")
-	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
 
-	// Content contains ZBBB; codes list is non-empty, but flag is false.
-	src := filepath.Join(alertDir, "one.warn")
-	b := mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart beat missing ZBBB")
-	if err := os.WriteFile(src, b, 0o644); err != nil {
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	runner.cfg.ReplayFrom = time.Now().Add(-10 * time.Minute).UTC()
+	if err := runner.RunOnce(); err != nil {
 		t.Fatal(err)
 	}
+	var got []string
+	for _, c := range sender.Calls() {
+		got = append(got, c.msgID)
+	}
+	if want := []string{"alert", "deadman", "replay", "deadman"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected msgIDs %v, got %v", want, got)
+	}
+}
 
+func TestRunner_ReplaySkipsAlreadyReplayed(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
 	runner, err := NewRunner(RunnerConfig{
-		DBFolder:        tmp,
-		DBPrefix:        "spooler_",
-		JobLabel:        "mhdbs",
-		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
-		SyslogAddr:      "127.0.0.1:1",
-		ServiceLabel:    "alerts",
-		HashHexLen:      24,
-		CCCCEnabled:     false,
-		CCCCCodes:       []string{"ZBBB"},
-		DeleteAfterSend: true,
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer runner.Close()
-
 	sender := &mockSyslogSender{}
 	runner.syslog = sender
-
 	if err := runner.RunOnce(); err != nil {
 		t.Fatal(err)
 	}
 
-	calls := sender.Calls()
-	if len(calls) != 1 {
-		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	runner.cfg.ReplayFrom = time.Now().Add(-10 * time.Minute).UTC()
+	for i := 0; i < 2; i++ {
+		if err := runner.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if !strings.Contains(calls[0].structuredData, ` cccc="ZBBB"`) {
-		t.Fatalf("expected cccc=ZBBB in structured data, got: %q", calls[0].structuredData)
+	if got := len(sender.Calls()); got != 2 {
+		t.Fatalf("expected the second replay over the same window to send nothing, got %d calls", got)
+	}
+
+	runner.cfg.ReplayForce = true
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sender.Calls()); got != 3 {
+		t.Fatalf("expected --replay-force to resend, got %d calls", got)
 	}
 }
 
-func TestRunner_CCCCIgnoresFlag_EmptyCodesDisablesTagging(t *testing.T) {
+func TestRunner_ReplayFrom_FindsEventsInPreviousMonthDB(t *testing.T) {
 	tmp := t.TempDir()
-	alertDir := filepath.Join(tmp, "general")
-	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+	now := time.Now()
+
+	// A run that started last month keeps its DB pinned, so an event archived now can
+	// still live in last month's DB.
+	prev := time.Date(now.Year(), now.Month()-1, 15, 0, 0, 0, 0, time.Local)
+	db, err := OpenDB(monthlyDBPath(tmp, "spooler_", prev))
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Content contains ZBBB, but codes list is empty; flag is true.
-	src := filepath.Join(alertDir, "one.warn")
-	b := mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart beat missing ZBBB")
-	if err := os.WriteFile(src, b, 0o644); err != nil {
+	if err := db.Create(&SpoolEvent{AlertType: "general", SourcePath: "late.warn", ArchivedAt: now.UTC()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
 		t.Fatal(err)
 	}
+	sqlDB.Close()
 
 	runner, err := NewRunner(RunnerConfig{
-		DBFolder:        tmp,
-		DBPrefix:        "spooler_",
-		JobLabel:        "mhdbs",
-		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
-		SyslogAddr:      "127.0.0.1:1",
-		ServiceLabel:    "alerts",
-		HashHexLen:      24,
-		CCCCEnabled:     true,
-		CCCCCodes:       nil,
-		DeleteAfterSend: true,
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		ReplayFrom:   now.Add(-time.Minute).UTC(),
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer runner.Close()
-
 	sender := &mockSyslogSender{}
 	runner.syslog = sender
 
 	if err := runner.RunOnce(); err != nil {
 		t.Fatal(err)
 	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected the previous-month DB event to be replayed, got %d calls", len(sender.Calls()))
+	}
+	if want := `db_month="` + monthKey(prev) + `"`; !strings.Contains(sender.Calls()[0].structuredData, want) {
+		t.Fatalf("expected replayed event to carry %s, got %q", want, sender.Calls()[0].structuredData)
+	}
+
+	// The replay is logged in the event's own DB, so it is still skipped once that month
+	// is no longer current.
+	prevDB, err := OpenQueryDB(monthlyDBPath(tmp, "spooler_", prev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prevSQL, err := prevDB.DB(); err == nil {
+		defer prevSQL.Close()
+	}
+	var logged []ReplayLog
+	if err := prevDB.Find(&logged).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 || logged[0].Destination != primaryDestination || logged[0].DBMonth != monthKey(prev) {
+		t.Fatalf("expected one primary replay log row in the previous-month DB, got %+v", logged)
+	}
+}
+
+func TestRunner_DBMonthLabel(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
 
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
 	calls := sender.Calls()
 	if len(calls) != 1 {
-		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+		t.Fatalf("expected 1 syslog call, got %d", len(calls))
 	}
-	if !strings.Contains(calls[0].structuredData, ` cccc="none"`) {
-		t.Fatalf("expected cccc=none when codes empty, got: %q", calls[0].structuredData)
+	want := `db_month="` + monthKey(time.Now()) + `"`
+	if !strings.Contains(calls[0].structuredData, want) {
+		t.Fatalf("expected %s in %q", want, calls[0].structuredData)
+	}
+}
+
+func TestRunner_DBMonthLabelOnResendIsTheSourceDB(t *testing.T) {
+	tmp := t.TempDir()
+	// A pending event archived three months ago that sits in last month's DB (stored
+	// before DBByEventTime was turned on).
+	prevMonth := time.Now().AddDate(0, -1, 0)
+	prev, err := OpenDB(monthlyDBPath(tmp, "spooler_", prevMonth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prev.Create(&SpoolEvent{AlertType: "general", SourcePath: "old.warn", ArchivedAt: time.Now().AddDate(0, -3, 0).UTC()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		DBByEventTime: true,
+		FlushOnly:     true,
+		JobLabel:      "mhdbs",
+		InputGlobs:    []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:    "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected the pending event resent, got %d calls", len(calls))
+	}
+	if want := `db_month="` + monthKey(prevMonth) + `"`; !strings.Contains(calls[0].structuredData, want) {
+		t.Fatalf("expected %s in %q", want, calls[0].structuredData)
+	}
+}
+
+func TestRunner_MinFileAgeSkipsFreshFiles(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		MinFileAge:      time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 0 {
+		t.Fatalf("expected a fresh file to be skipped, got %d calls", len(sender.Calls()))
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected fresh file left in place: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(src, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected the file ingested once old enough, got %d calls", len(sender.Calls()))
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected file deleted after ingest, stat err=%v", err)
+	}
+}
+
+func TestRunner_MTimeSkewToleratesFutureMTime(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Last written a while ago by a host whose clock runs 2s ahead.
+	future := time.Now().Add(2 * time.Second)
+	if err := os.Chtimes(src, future, future); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		MinFileAge: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 0 {
+		t.Fatalf("expected a future mtime to be skipped without a skew tolerance, got %d calls", len(sender.Calls()))
+	}
+
+	runner.cfg.MTimeSkew = 5 * time.Second
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected the file eligible within the skew tolerance, got %d calls", len(sender.Calls()))
+	}
+}
+
+func TestRunner_EmptyFilesRecordedAndMoved(t *testing.T) {
+	tmp := t.TempDir()
+	inDir := filepath.Join(tmp, "in")
+	errDir := filepath.Join(tmp, "error")
+	if err := os.MkdirAll(inDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(inDir, "empty.warn")
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(inDir, "*.warn"), AlertType: "general", ErrorDir: errDir}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		EmptyFiles:   "error_dir",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 0 {
+		t.Fatalf("expected no sends for an empty file, got %d", len(sender.Calls()))
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected empty file moved out of the input dir, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(errDir, "empty.warn")); err != nil {
+		t.Fatalf("expected empty file in error_dir: %v", err)
+	}
+
+	// A recorded empty file that reappears is removed again without a new row (Reappear
+	// "skip").
+	var first ProcessedFile
+	if err := runner.db.Where("path = ?", src).First(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	runner.cfg.EmptyFiles = "record"
+	runner.cfg.DeleteAfterSend = true
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var rows []ProcessedFile
+	if err := runner.db.Where("path = ?", src).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ID != first.ID {
+		t.Fatalf("expected the first record kept, got %+v", rows)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected the reappeared empty file removed, stat err=%v", err)
+	}
+
+	// Reappear "resend" records it anew.
+	runner.cfg.Reappear = "resend"
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	rows = nil
+	if err := runner.db.Where("path = ?", src).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ID == first.ID || !rows[0].Deleted {
+		t.Fatalf("expected the empty file recorded anew and deleted, got %+v", rows)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected the reappeared empty file removed, stat err=%v", err)
+	}
+}
+
+func TestNewRunner_UnsupportedEmptyFiles(t *testing.T) {
+	tmp := t.TempDir()
+	_, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		EmptyFiles: "delete",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported empty_files") {
+		t.Fatalf("expected unsupported empty_files error, got %v", err)
+	}
+}
+
+func TestRunner_ReappearedFilePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		reappear string
+		sends    int
+	}{
+		{"", 1},
+		{"resend", 2},
+	} {
+		t.Run("reappear="+tc.reappear, func(t *testing.T) {
+			tmp := t.TempDir()
+			inDir := filepath.Join(tmp, "in")
+			if err := os.MkdirAll(inDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			src := filepath.Join(inDir, "a.warn")
+			content := mustBuildFixtureJSON(t, "detail again ZBBB")
+			if err := os.WriteFile(src, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			runner, err := NewRunner(RunnerConfig{
+				DBFolder:        tmp,
+				DBPrefix:        "spooler_",
+				JobLabel:        "mhdbs",
+				Inputs:          []InputSpec{{Glob: filepath.Join(inDir, "*.warn")}},
+				SyslogAddr:      "127.0.0.1:1",
+				ServiceLabel:    "alerts",
+				HashHexLen:      24,
+				DeleteAfterSend: true,
+				Reappear:        tc.reappear,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+			sender := &mockSyslogSender{}
+			runner.syslog = sender
+
+			if err := runner.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Fatalf("expected the file deleted after the first send, stat err=%v", err)
+			}
+
+			// The producer writes the same file again.
+			if err := os.WriteFile(src, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := runner.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(sender.Calls()); n != tc.sends {
+				t.Fatalf("expected %d sends, got %d", tc.sends, n)
+			}
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Fatalf("expected the reappeared file deleted, stat err=%v", err)
+			}
+			var pfs []ProcessedFile
+			if err := runner.db.Where("path = ?", src).Find(&pfs).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(pfs) != 1 || !pfs[0].Deleted || !pfs[0].AllSent {
+				t.Fatalf("expected one sent and deleted row, got %+v", pfs)
+			}
+		})
+	}
+}
+
+func TestRunner_ReappearedFileAfterMonthRollover(t *testing.T) {
+	for _, tc := range []struct {
+		reappear string
+		sends    int
+	}{
+		{"", 0},
+		{"resend", 1},
+	} {
+		t.Run("reappear="+tc.reappear, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "a.warn")
+			content := mustBuildFixtureJSON(t, "detail again ZBBB")
+			if err := os.WriteFile(src, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// The first copy was sent and deleted last month.
+			prev, err := OpenDB(monthlyDBPath(tmp, "spooler_", time.Now().AddDate(0, -1, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256(content)
+			old := ProcessedFile{Path: src, SHA256: hex.EncodeToString(sum[:]), AllSent: true, Deleted: true}
+			if err := prev.Create(&old).Error; err != nil {
+				t.Fatal(err)
+			}
+			runner, err := NewRunner(RunnerConfig{
+				DBFolder:        tmp,
+				DBPrefix:        "spooler_",
+				JobLabel:        "mhdbs",
+				InputGlobs:      []string{filepath.Join(tmp, "*.warn")},
+				SyslogAddr:      "127.0.0.1:1",
+				ServiceLabel:    "alerts",
+				HashHexLen:      24,
+				DeleteAfterSend: true,
+				Reappear:        tc.reappear,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+			sender := &mockSyslogSender{}
+			runner.syslog = sender
+
+			if err := runner.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(sender.Calls()); n != tc.sends {
+				t.Fatalf("expected %d sends, got %d", tc.sends, n)
+			}
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Fatalf("expected the reappeared file deleted, stat err=%v", err)
+			}
+			var n int64
+			if err := prev.Model(&ProcessedFile{}).Where("path = ?", src).Count(&n).Error; err != nil {
+				t.Fatal(err)
+			}
+			if want := int64(1 - tc.sends); n != want {
+				t.Fatalf("expected %d row(s) left in the previous month, got %d", want, n)
+			}
+		})
+	}
+}
+
+func TestNewRunner_UnsupportedReappear(t *testing.T) {
+	tmp := t.TempDir()
+	_, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		Reappear:   "delete",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported reappear") {
+		t.Fatalf("expected unsupported reappear error, got %v", err)
+	}
+}
+
+func TestRunner_NoInputsMatchedWarnsOrFails(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "typo", "*.warn")},
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "general", "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatalf("expected no error by default, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "warn: no input files matched globs=1 inputs=1") {
+		t.Fatalf("expected a no-inputs warning, got:\n%s", logs.String())
+	}
+
+	runner.cfg.FailOnNoInputs = true
+	if err := runner.RunOnce(); err == nil || !strings.Contains(err.Error(), "no input files matched") {
+		t.Fatalf("expected no-inputs error, got %v", err)
+	}
+}
+
+func TestRunner_SeedArchivesWithoutSending(t *testing.T) {
+	tmp := t.TempDir()
+	seeded := map[string][]byte{
+		"a.warn": mustBuildFixtureJSON(t, "old alert one ZBBB"),
+		"b.warn": mustBuildFixtureJSON(t, "old alert two ZBBB"),
+	}
+	for name, b := range seeded {
+		if err := os.WriteFile(filepath.Join(tmp, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+		Seed:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Calls()); n != 0 {
+		t.Fatalf("expected no sends in seed mode, got %d", n)
+	}
+	for name := range seeded {
+		if _, err := os.Stat(filepath.Join(tmp, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be deleted after seeding, stat err=%v", name, err)
+		}
+	}
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 archived events, got %d", len(events))
+	}
+	for _, ev := range events {
+		if !ev.Seeded || !ev.SentSyslog {
+			t.Fatalf("expected seeded event recorded as sent, got seeded=%v sent=%v", ev.Seeded, ev.SentSyslog)
+		}
+	}
+
+	// A normal run ships only new input: a reappearing seeded file is already processed.
+	runner.cfg.Seed = false
+	runner.cfg.DeadmanToken = ""
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), seeded["a.warn"], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "c.warn"), mustBuildFixtureJSON(t, "new alert ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].message, "new alert") {
+		t.Fatalf("expected only the new file to be sent, got %+v", calls)
+	}
+}
+
+func TestRunner_CCCCEnabledDerivedFromCodes_IgnoresFlag(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Content contains ZBBB; codes list is non-empty, but flag is false.
+	src := filepath.Join(alertDir, "one.warn")
+	b := mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart beat missing ZBBB")
+	if err := os.WriteFile(src, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		CCCCEnabled:     false,
+		CCCCCodes:       []string{"ZBBB"},
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, ` cccc="ZBBB"`) {
+		t.Fatalf("expected cccc=ZBBB in structured data, got: %q", calls[0].structuredData)
+	}
+}
+
+func TestRunner_CCCCIgnoresFlag_EmptyCodesDisablesTagging(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Content contains ZBBB, but codes list is empty; flag is true.
+	src := filepath.Join(alertDir, "one.warn")
+	b := mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart beat missing ZBBB")
+	if err := os.WriteFile(src, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		CCCCEnabled:     true,
+		CCCCCodes:       nil,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, ` cccc="none"`) {
+		t.Fatalf("expected cccc=none when codes empty, got: %q", calls[0].structuredData)
+	}
+}
+
+func TestRunner_StuckFilesReportedInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	// A non-empty directory cannot be removed with os.Remove, which makes deletion fail
+	// the same way a permission error would.
+	stuckPath := filepath.Join(tmp, "stuck.warn")
+	if err := os.MkdirAll(stuckPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stuckPath, "keep"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.db.Create(&SpoolEvent{SourcePath: stuckPath, FileDigestSHA256: "sha", SentSyslog: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.db.Create(&ProcessedFile{Path: stuckPath, SHA256: "sha", AllSent: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if got := dm["files_stuck"]; got != float64(1) {
+		t.Fatalf("expected files_stuck=1, got %v", got)
+	}
+}
+
+func TestRunner_FlattenTruncatedInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	wide := map[string]any{"detail": "wide ZBBB"}
+	for i := 0; i < 5001; i++ {
+		wide[fmt.Sprintf("k%04d", i)] = i
+	}
+	b, err := json.Marshal(wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "wide.warn"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustDeadmanPayload(t, sender.Calls())["flatten_truncated"]; got != float64(1) {
+		t.Fatalf("expected flatten_truncated=1, got %v", got)
+	}
+}
+
+func TestRunner_ConfigHashInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	}
+	newRunner := func(cfg RunnerConfig) *Runner {
+		t.Helper()
+		r, err := NewRunner(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+
+	a := newRunner(cfg)
+	b := newRunner(cfg)
+	other := cfg
+	other.HashHexLen = 16
+	c := newRunner(other)
+
+	if len(a.configHash) != 64 {
+		t.Fatalf("expected a sha256 hex config hash, got %q", a.configHash)
+	}
+	if a.configHash != b.configHash {
+		t.Fatalf("expected identical configs to hash the same: %s != %s", a.configHash, b.configHash)
+	}
+	if a.configHash == c.configHash {
+		t.Fatalf("expected differing configs to hash differently")
+	}
+
+	sender := &mockSyslogSender{}
+	a.syslog = sender
+	if err := a.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustDeadmanPayload(t, sender.Calls())["config_hash"]; got != a.configHash {
+		t.Fatalf("expected deadman config_hash=%s, got %v", a.configHash, got)
+	}
+}
+
+func mustDeadmanPayload(t *testing.T, calls []mockSyslogCall) map[string]any {
+	t.Helper()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if !strings.Contains(calls[i].structuredData, `alert_type="deadman"`) {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(calls[i].message), &m); err != nil {
+			t.Fatalf("deadman message should be valid json: %v", err)
+		}
+		return m
+	}
+	t.Fatalf("no deadman call among %d calls", len(calls))
+	return nil
+}
+
+func TestRunner_DecodeErrorEventIsShippedAndTagged(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "bad.warn"), []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send for decode error, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, ` error="decode"`) {
+		t.Fatalf("expected error=decode in structured data, got: %q", calls[0].structuredData)
+	}
+	if !strings.Contains(calls[0].message, `"error":"decode/build error`) {
+		t.Fatalf("expected decode error in payload, got: %q", calls[0].message)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || !events[0].SentSyslog || events[0].DecodeError == "" {
+		t.Fatalf("expected 1 sent decode-error event, got %+v", events)
+	}
+}
+
+func TestRunner_DBByEventTime_RoutesEventsToEventMonthDB(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := map[string]string{
+		"jan.warn": "2025-01-15 12:00:00",
+		"feb.warn": "2025-02-15 12:00:00",
+	}
+	for name, tm := range inputs {
+		b, err := json.Marshal(map[string]any{"detail": "disk full " + name, "status": "1", "time": tm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(alertDir, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		DBByEventTime:   true,
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 2 {
+		t.Fatalf("expected 2 syslog sends, got %d", len(sender.Calls()))
+	}
+	for name := range inputs {
+		if _, err := os.Stat(filepath.Join(alertDir, name)); err == nil {
+			t.Fatalf("expected file deleted: %s", name)
+		}
+	}
+
+	for key, wantPath := range map[string]string{"202501": "jan.warn", "202502": "feb.warn"} {
+		month, ok := parseMonthlyDBKey("spooler_"+key+".db", "spooler_")
+		if !ok {
+			t.Fatalf("parse month key %s", key)
+		}
+		db, err := runner.dbForMonth(month)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var events []SpoolEvent
+		if err := db.Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || filepath.Base(events[0].SourcePath) != wantPath {
+			t.Fatalf("expected only %s in month db %s, got %+v", wantPath, key, events)
+		}
+	}
+
+	var current int64
+	if err := runner.db.Model(&SpoolEvent{}).Count(&current).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current != 0 {
+		t.Fatalf("expected no events in current month db, got %d", current)
+	}
+	var pfs int64
+	if err := runner.db.Model(&ProcessedFile{}).Where("deleted = ?", true).Count(&pfs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pfs != 2 {
+		t.Fatalf("expected 2 deleted processed_file rows in current db, got %d", pfs)
+	}
+}
+
+func TestRunner_PayloadIncludeNormalized(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "one.warn"), mustBuildFixtureJSON(t, "2026-02-07 12:00:00 heart  beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:                 tmp,
+		DBPrefix:                 "spooler_",
+		JobLabel:                 "mhdbs",
+		Inputs:                   []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:               "127.0.0.1:1",
+		ServiceLabel:             "alerts",
+		HashHexLen:               24,
+		DeleteAfterSend:          true,
+		PayloadIncludeNormalized: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(calls[0].message), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m["normalized"]; got != "heart beat missing ZBBB" {
+		t.Fatalf("expected normalized text in payload, got %v", got)
+	}
+
+	runner.cfg.PayloadIncludeNormalized = false
+	if strings.Contains(runner.eventPayload(SpoolEvent{EventJSON: "{}", FlatJSON: "{}", Normalized: "x"}, nil), `"normalized"`) {
+		t.Fatalf("did not expect normalized in payload when disabled")
+	}
+}
+
+func TestRunner_ArrayOfScalarsProducesOneEventPerElement(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "list.warn"), []byte(`["a","b"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 2 {
+		t.Fatalf("expected 2 syslog sends, got %d", len(sender.Calls()))
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Order("event_index asc").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for i, want := range []string{"a", "b"} {
+		ev := events[i]
+		if ev.EventIndex != i || ev.Normalized != want || ev.DecodeError != "" {
+			t.Fatalf("unexpected event %d: index=%d normalized=%q decodeError=%q", i, ev.EventIndex, ev.Normalized, ev.DecodeError)
+		}
+		if ev.ContentHash != HashNormalized(want, 24) {
+			t.Fatalf("expected hash of %q, got %q", want, ev.ContentHash)
+		}
+		if ev.AlertLevel != "warning" {
+			t.Fatalf("expected level from .warn extension, got %q", ev.AlertLevel)
+		}
+	}
+
+	if _, ok := computeLag(time.Now(), "a", nil, nil); ok {
+		t.Fatalf("expected no lag for scalar element")
+	}
+}
+
+func TestRunner_DrainEmptiesBacklogAndStops(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		p := filepath.Join(alertDir, fmt.Sprintf("backlog%d.warn", i))
+		if err := os.WriteFile(p, mustBuildFixtureJSON(t, fmt.Sprintf("backlog %d ZBBB", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	// First sweep: 3 sends + 3 in-run resends fail; second sweep: 3 more resends fail.
+	sender.FailNext(9)
+	runner.syslog = sender
+
+	if err := runner.Drain(10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	left, _ := filepath.Glob(filepath.Join(alertDir, "*.warn"))
+	if len(left) != 0 {
+		t.Fatalf("expected backlog drained, still on disk: %v", left)
+	}
+	pending, err := runner.countPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected no pending events, got %d", pending)
+	}
+	// 9 failed + 3 successful resends, then one empty sweep to confirm.
+	if got := len(sender.Calls()); got != 12 {
+		t.Fatalf("expected 12 syslog calls, got %d", got)
+	}
+
+	// A queue that never empties hits the iteration cap.
+	if err := runner.db.Create(&SpoolEvent{SourcePath: "x", SentSyslog: false}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sender.FailNext(100)
+	if err := runner.Drain(2, 0); err == nil {
+		t.Fatalf("expected drain to fail when pending events remain after the cap")
+	}
+}
+
+func TestRunner_DrainDoesNotStopOnTimedOutSweep(t *testing.T) {
+	tmp := t.TempDir()
+	p := filepath.Join(tmp, "backlog.warn")
+	if err := os.WriteFile(p, mustBuildFixtureJSON(t, "backlog ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		// Every sweep times out before reaching the input.
+		Timeout: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.Drain(2, 0); err == nil {
+		t.Fatalf("expected timed-out sweeps with nothing pending not to count as drained")
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatalf("expected the input still on disk: %v", err)
+	}
+}
+
+func TestRunner_ReprocessErrorsSendsNowValidFiles(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	errorDir := filepath.Join(tmp, "general_err")
+	for _, d := range []string{alertDir, errorDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fixed := filepath.Join(errorDir, "fixed.warn")
+	if err := os.WriteFile(fixed, mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stillBad := filepath.Join(errorDir, "still_bad.warn")
+	if err := os.WriteFile(stillBad, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general", ErrorDir: errorDir}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.ReprocessErrors(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send for the fixed file, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, `filename="fixed.warn"`) || !strings.Contains(calls[0].structuredData, `alert_type="general"`) {
+		t.Fatalf("unexpected structured data: %q", calls[0].structuredData)
+	}
+	if _, err := os.Stat(fixed); err == nil {
+		t.Fatalf("expected reprocessed file deleted from error_dir")
+	}
+	if _, err := os.Stat(stillBad); err != nil {
+		t.Fatalf("expected still-bad file left in error_dir: %v", err)
+	}
+	left, _ := filepath.Glob(filepath.Join(alertDir, "*"))
+	if len(left) != 0 {
+		t.Fatalf("expected nothing moved into alert dir, got %v", left)
+	}
+
+	// Running again must not resend anything.
+	if err := runner.ReprocessErrors(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected no further sends, got %d", len(sender.Calls()))
+	}
+}
+
+func TestRunner_AlertTypeSrcInPayload(t *testing.T) {
+	tmp := t.TempDir()
+	forcedDir := filepath.Join(tmp, "forced")
+	inferredDir := filepath.Join(tmp, "iec")
+	for _, d := range []string{forcedDir, inferredDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(forcedDir, "a.warn"), mustBuildFixtureJSON(t, "forced ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inferredDir, "b.warn"), mustBuildFixtureJSON(t, "inferred ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		InputGlobs:      []string{filepath.Join(inferredDir, "*.warn")},
+		Inputs:          []InputSpec{{Glob: filepath.Join(forcedDir, "*.warn"), AlertType: "business"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 syslog sends, got %d", len(calls))
+	}
+	srcByFile := map[string]string{}
+	for _, c := range calls {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(c.message), &m); err != nil {
+			t.Fatal(err)
+		}
+		srcByFile[filepath.Base(fmt.Sprint(m["source"]))] = fmt.Sprint(m["alert_type_src"])
+	}
+	if srcByFile["a.warn"] != "forced" {
+		t.Fatalf("expected alert_type_src=forced for forced input, got %q", srcByFile["a.warn"])
+	}
+	if srcByFile["b.warn"] != "path" {
+		t.Fatalf("expected alert_type_src=path for inferred input, got %q", srcByFile["b.warn"])
+	}
+}
+
+func TestRunner_PayloadGzipRoundTrips(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "big.warn"), mustBuildFixtureJSON(t, strings.Repeat("disk full ZBBB ", 200)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:            tmp,
+		DBPrefix:            "spooler_",
+		JobLabel:            "mhdbs",
+		Inputs:              []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:          "127.0.0.1:1",
+		ServiceLabel:        "alerts",
+		HashHexLen:          24,
+		DeleteAfterSend:     true,
+		PayloadGzipMinBytes: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, ` ct="gzip"`) {
+		t.Fatalf("expected ct=gzip in structured data, got: %q", calls[0].structuredData)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(calls[0].message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if want := runner.eventPayload(events[0], nil); string(plain) != want {
+		t.Fatalf("round-tripped payload mismatch:\n got: %s\nwant: %s", plain, want)
+	}
+
+	// Small payloads are sent as-is.
+	labels := map[string]string{}
+	if got := runner.encodePayload(labels, "{}"); got != "{}" || labels["ct"] != "" {
+		t.Fatalf("expected small payload untouched, got %q labels=%v", got, labels)
+	}
+}
+
+// denyRemoveFS is an OSFS whose Remove always fails with a permission error.
+type denyRemoveFS struct {
+	OSFS
+}
+
+func (denyRemoveFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+func TestRunner_FakeFSRemovePermissionErrorMarksFileStuck(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(alertDir, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	runner.fs = denyRemoveFS{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected source file kept when remove is denied: %v", err)
+	}
+	var pf ProcessedFile
+	if err := runner.db.First(&pf).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !pf.AllSent || pf.Deleted || !strings.Contains(pf.LastError, "permission denied") {
+		t.Fatalf("expected sent-but-undeleted file with permission error, got %+v", pf)
+	}
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if got := dm["files_stuck"]; got != float64(1) {
+		t.Fatalf("expected files_stuck=1, got %v", got)
+	}
+}
+
+// flakyOpenDB makes the first failures openDB calls fail like a briefly unavailable mount,
+// counting calls; it restores openDB when the test ends.
+func flakyOpenDB(t *testing.T, failures int) *int {
+	orig := openDB
+	t.Cleanup(func() { openDB = orig })
+	calls := new(int)
+	openDB = func(path string) (*gorm.DB, error) {
+		*calls++
+		if *calls <= failures {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("stale file handle")}
+		}
+		return orig(path)
+	}
+	return calls
+}
+
+func TestRunner_DBOpenRetriesTransientFailure(t *testing.T) {
+	defer func(d time.Duration) { dbOpenBackoff = d }(dbOpenBackoff)
+	dbOpenBackoff = time.Millisecond
+
+	tmp := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	// Force the next run to reopen its DB through a mount that fails once.
+	if err := runner.closeDBs(); err != nil {
+		t.Fatal(err)
+	}
+	calls := flakyOpenDB(t, 1)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatalf("expected the run to survive a transient open failure, got %v", err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected one retry, got %d opens", *calls)
+	}
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if e, ok := dm["error"]; ok && e != "" {
+		t.Fatalf("expected deadman without error, got %v", e)
+	}
+}
+
+func TestRunner_DBOpenRetriesStopAtRunDeadline(t *testing.T) {
+	defer func(d time.Duration) { dbOpenBackoff = d }(dbOpenBackoff)
+	dbOpenBackoff = time.Hour
+
+	tmp := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		Timeout:    time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	if err := runner.closeDBs(); err != nil {
+		t.Fatal(err)
+	}
+	calls := flakyOpenDB(t, 1)
+
+	start := time.Now()
+	if err := runner.RunOnce(); err == nil || !strings.Contains(err.Error(), "stale file handle") {
+		t.Fatalf("expected the open failure returned, got %v", err)
+	}
+	if *calls != 1 || time.Since(start) > 10*time.Second {
+		t.Fatalf("expected no retry past the run deadline, got %d opens in %s", *calls, time.Since(start))
+	}
+}
+
+// concurrentReadFS is an OSFS that records the most ReadFile calls in flight at once.
+type concurrentReadFS struct {
+	OSFS
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *concurrentReadFS) ReadFile(name string) ([]byte, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	return c.OSFS.ReadFile(name)
+}
+
+func TestRunner_MaxOpenFilesBoundsConcurrentReads(t *testing.T) {
+	tmp := t.TempDir()
+	for i := 0; i < 12; i++ {
+		if err := os.WriteFile(filepath.Join(tmp, fmt.Sprintf("f%02d.warn", i)), mustBuildFixtureJSON(t, fmt.Sprintf("alert %d ZBBB", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general", Workers: 6}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		MaxOpenFiles: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	counting := &concurrentReadFS{}
+	runner.fs = newBudgetFS(counting, runner.budget)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Calls()); n != 12 {
+		t.Fatalf("expected all 12 files ingested, got %d sends", n)
+	}
+	if counting.peak > 2 {
+		t.Fatalf("expected at most 2 concurrent reads, saw %d", counting.peak)
+	}
+}
+
+// globCountingFS is an OSFS that counts directory scans (Glob and WalkDir).
+type globCountingFS struct {
+	OSFS
+	scans int
+}
+
+func (g *globCountingFS) Glob(pattern string) ([]string, error) {
+	g.scans++
+	return g.OSFS.Glob(pattern)
+}
+
+func (g *globCountingFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	g.scans++
+	return g.OSFS.WalkDir(root, fn)
+}
+
+func TestRunner_FlushOnlyResendsAndFinalizesWithoutScanning(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(alertDir, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	// The first run archives the event but fails to send it (ingest and resend).
+	sender.FailNext(2)
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected unsent file kept: %v", err)
+	}
+
+	// A new file must not be picked up by a flush-only run.
+	if err := os.WriteFile(filepath.Join(alertDir, "two.warn"), mustBuildFixtureJSON(t, "link down ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	counting := &globCountingFS{}
+	runner.fs = counting
+	runner.cfg.FlushOnly = true
+	before := len(sender.Calls())
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if counting.scans != 0 {
+		t.Fatalf("expected no input scans in flush-only mode, got %d", counting.scans)
+	}
+	calls := sender.Calls()[before:]
+	if len(calls) != 2 || !strings.Contains(calls[0].structuredData, `resend="true"`) {
+		t.Fatalf("expected the pending event resent plus the deadman, got %+v", calls)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected the flushed file deleted, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(alertDir, "two.warn")); err != nil {
+		t.Fatalf("expected the new file left for a normal run: %v", err)
+	}
+}
+
+func TestParseTimeString_ConfiguredLayouts(t *testing.T) {
+	if _, ok := parseTimeString("20260207120000", nil); ok {
+		t.Fatalf("did not expect compact stamp to parse without a configured layout")
+	}
+	ts, ok := parseTimeString("20260207120000", []string{"20060102150405"})
+	if !ok {
+		t.Fatalf("expected compact stamp to parse with configured layout")
+	}
+	// Zone-less values are interpreted as Asia/Shanghai (UTC+8).
+	if want := time.Date(2026, 2, 7, 4, 0, 0, 0, time.UTC); !ts.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, ts)
+	}
+
+	if _, ok := extractEventTime(map[string]any{"time": "20260207120000"}, nil, []string{"20060102150405"}); !ok {
+		t.Fatalf("expected extractEventTime to use configured layouts")
+	}
+}
+
+func TestRunner_DistinctHashesReportedInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	details := []string{
+		"2026-02-07 12:00:00 heart beat missing ZBBB",
+		"2026-02-07 12:00:01 heart beat missing ZBBB",
+		"2026-02-07 12:00:02 heart beat missing ZBBB",
+		"2026-02-07 12:00:03 heart beat missing ZBBB",
+		"disk full ZGGG",
+		"link down ZHHH",
+	}
+	for i, d := range details {
+		if err := os.WriteFile(filepath.Join(alertDir, fmt.Sprintf("f%d.warn", i)), mustBuildFixtureJSON(t, d), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if got := dm["events_new"]; got != float64(6) {
+		t.Fatalf("expected events_new=6, got %v", got)
+	}
+	if got := dm["distinct_hashes"]; got != float64(3) {
+		t.Fatalf("expected distinct_hashes=3, got %v", got)
+	}
+}
+
+func TestRunner_TopHashesReportedInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	details := []string{"disk full ZGGG", "link down ZHHH", "link down ZHHH"}
+	for i := 0; i < 8; i++ {
+		details = append(details, fmt.Sprintf("2026-02-07 12:00:%02d heart beat missing ZBBB", i))
+	}
+	for i, d := range details {
+		if err := os.WriteFile(filepath.Join(tmp, fmt.Sprintf("f%02d.warn", i)), mustBuildFixtureJSON(t, d), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var storm SpoolEvent
+	if err := runner.db.Where("normalized = ?", "heart beat missing ZBBB").First(&storm).Error; err != nil {
+		t.Fatal(err)
+	}
+	dm := mustDeadmanPayload(t, sender.Calls())
+	top, ok := dm["top_hashes"].([]any)
+	if !ok || len(top) != 3 {
+		t.Fatalf("expected 3 top_hashes, got %v", dm["top_hashes"])
+	}
+	first := top[0].(map[string]any)
+	if first["hash"] != storm.ContentHash || first["count"] != float64(8) {
+		t.Fatalf("expected storm hash %s with count 8 first, got %v", storm.ContentHash, first)
+	}
+	if second := top[1].(map[string]any); second["count"] != float64(2) {
+		t.Fatalf("expected the repeated hash second with count 2, got %v", second)
+	}
+}
+
+// probingSender records sends like mockSyslogSender but probes a real address.
+type probingSender struct {
+	*mockSyslogSender
+	client *SyslogClient
+}
+
+func (p *probingSender) Probe(timeout time.Duration) error {
+	return p.client.Probe(timeout)
+}
+
+func TestRunner_RequireSyslogFailsEarlyAndSendsDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(alertDir, "one.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+		RequireSyslog:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &probingSender{mockSyslogSender: &mockSyslogSender{}, client: NewSyslogClient("127.0.0.1:1")}
+	runner.syslog = sender
+
+	err = runner.RunOnce()
+	if err == nil || !strings.Contains(err.Error(), "syslog unreachable") {
+		t.Fatalf("expected syslog unreachable error, got %v", err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected only the deadman send, got %d calls", len(calls))
+	}
+	dm := mustDeadmanPayload(t, calls)
+	if dm["status"] != "error" || dm["events_new"] != float64(0) {
+		t.Fatalf("expected error deadman with no events, got %v", dm)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("expected input file untouched: %v", err)
+	}
+	var n int64
+	if err := runner.db.Model(&SpoolEvent{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no ingest, got %d events", n)
+	}
+}
+
+func TestRunner_HostnameLabelsDeriveEnv(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "one.warn"), mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	origHostname := hostname
+	hostname = func() (string, error) { return "host-staging-07", nil }
+	defer func() { hostname = origHostname }()
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		FixedLabels:     map[string]string{"site": "bj"},
+		HostnameLabels: map[string]string{
+			"env":     `^host-(\w+)-`,
+			"cluster": `^nomatch-(\w+)`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	sd := calls[0].structuredData
+	if !strings.Contains(sd, ` env="staging"`) {
+		t.Fatalf("expected env derived from hostname, got: %q", sd)
+	}
+	if !strings.Contains(sd, ` site="bj"`) {
+		t.Fatalf("expected fixed site label kept, got: %q", sd)
+	}
+	if strings.Contains(sd, ` cluster=`) {
+		t.Fatalf("did not expect cluster label for non-matching pattern, got: %q", sd)
+	}
+}
+
+func TestRunner_ResendAddsResendLabel(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "one.warn"), mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	// The first send fails; resendPending in the same run succeeds.
+	sender.FailNext(1)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected first send + resend, got %d calls", len(calls))
+	}
+	if strings.Contains(calls[0].structuredData, "resend=") {
+		t.Fatalf("did not expect resend label on first send: %q", calls[0].structuredData)
+	}
+	if !strings.Contains(calls[1].structuredData, ` resend="true"`) {
+		t.Fatalf("expected resend label on resend: %q", calls[1].structuredData)
+	}
+}
+
+func TestRunner_KeepFieldsProjectsEventJSON(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "one.warn"), mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		KeepFields:      []string{"code", "detail"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	var ev map[string]any
+	if err := json.Unmarshal([]byte(events[0].EventJSON), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(ev) != 2 || ev["code"] != "NIL_REPORT" || ev["detail"] != "heart beat missing ZBBB" {
+		t.Fatalf("expected only code+detail in EventJSON, got %v", ev)
+	}
+	if strings.Contains(events[0].FlatJSON, "description") {
+		t.Fatalf("expected dropped fields absent from FlatJSON, got %s", events[0].FlatJSON)
+	}
+	// Level still comes from the full item (status=2).
+	if events[0].AlertLevel != "critical" || events[0].ContentHash != HashNormalized("heart beat missing ZBBB", 24) {
+		t.Fatalf("expected level/hash from full item, got level=%q hash=%q", events[0].AlertLevel, events[0].ContentHash)
+	}
+}
+
+func TestRunner_KeepFieldsKeepsEventTimeAndTraceID(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "jan.warn"), []byte(`{"code":"DISK","detail":"disk full ZBBB","time":"2025-01-15 12:00:00","ctx":{"trace_id":"abc123"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:                 tmp,
+		DBPrefix:                 "spooler_",
+		DBByEventTime:            true,
+		JobLabel:                 "mhdbs",
+		Inputs:                   []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:               "127.0.0.1:1",
+		ServiceLabel:             "alerts",
+		HashHexLen:               24,
+		KeepFields:               []string{"code", "detail"},
+		TraceIDField:             "ctx.trace_id",
+		SyslogTimestampFromEvent: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	var buf bytes.Buffer
+	runner.syslog = NewLineWriter(&buf)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimSpace(buf.String())
+	if !strings.Contains(line, `trace_id="abc123"`) {
+		t.Fatalf("expected trace_id from the unprojected event, got %q", line)
+	}
+	want, ok := parseTimeString("2025-01-15 12:00:00", nil)
+	if !ok {
+		t.Fatal("parse event time")
+	}
+	stamp, err := time.Parse(time.RFC3339Nano, strings.Fields(line)[1])
+	if err != nil || !stamp.Equal(want) {
+		t.Fatalf("expected the header timestamp %s from the unprojected event, got %s (%v)", want, stamp, err)
+	}
+	month, _ := parseMonthlyDBKey("spooler_202501.db", "spooler_")
+	db, err := runner.dbForMonth(month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := db.Model(&SpoolEvent{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected the event routed to its own month, got %d events in 202501", n)
+	}
+}
+
+func TestRunner_ProcessedFileRetentionPrunesOldDeletedRows(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:               tmp,
+		DBPrefix:               "spooler_",
+		JobLabel:               "mhdbs",
+		Inputs:                 []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:             "127.0.0.1:1",
+		ServiceLabel:           "alerts",
+		HashHexLen:             24,
+		DeleteAfterSend:        true,
+		ProcessedFileRetention: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	recent := time.Now().UTC().Add(-time.Hour)
+	rows := []ProcessedFile{
+		{Path: "old-deleted", SHA256: "a", ProcessedAt: old, AllSent: true, Deleted: true, DeletedAt: &old},
+		{Path: "recent-deleted", SHA256: "b", ProcessedAt: recent, AllSent: true, Deleted: true, DeletedAt: &recent},
+		{Path: "old-undeleted", SHA256: "c", ProcessedAt: old, AllSent: false, Deleted: false},
+	}
+	if err := runner.db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var left []ProcessedFile
+	if err := runner.db.Order("path asc").Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 || left[0].Path != "old-undeleted" || left[1].Path != "recent-deleted" {
+		t.Fatalf("expected only old deleted row pruned, got %+v", left)
+	}
+}
+
+func TestRunner_DBByEventTime_UndoesRoutedEventsWhenArchiveFails(t *testing.T) {
+	tmp := t.TempDir()
+	p := filepath.Join(tmp, "jan.warn")
+	if err := os.WriteFile(p, []byte(`{"detail":"disk full","time":"2025-01-15 12:00:00"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		DBByEventTime: true,
+		JobLabel:      "mhdbs",
+		InputGlobs:    []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:    "127.0.0.1:1",
+		ServiceLabel:  "alerts",
+		HashHexLen:    24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	// The file's row already exists, so the current DB's transaction fails.
+	if err := runner.db.Create(&ProcessedFile{Path: p, SHA256: "sha"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	events := []SpoolEvent{{SourcePath: p, FileDigestSHA256: "sha", EventJSON: `{"time":"2025-01-15 12:00:00"}`, ArchivedAt: time.Now().UTC()}}
+	if err := runner.archiveAndMarkFile(p, "sha", info, events, "", time.Time{}, nil, "", false); err == nil {
+		t.Fatalf("expected the archive to fail")
+	}
+	month, _ := parseMonthlyDBKey("spooler_202501.db", "spooler_")
+	db, err := runner.dbForMonth(month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := db.Model(&SpoolEvent{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected the routed event removed with the failed archive, got %d", n)
+	}
+}
+
+func TestRunner_EventTimeFromMTimeDrivesLag(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(alertDir, "notime.warn")
+	if err := os.WriteFile(src, []byte(`{"detail":"no timestamp here"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:           tmp,
+		DBPrefix:           "spooler_",
+		JobLabel:           "mhdbs",
+		Inputs:             []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:         "127.0.0.1:1",
+		ServiceLabel:       "alerts",
+		HashHexLen:         24,
+		DeleteAfterSend:    true,
+		DeadmanToken:       "spooler-run",
+		EventTimeFromMTime: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	lagMs, _ := dm["max_lag_ms"].(float64)
+	if lagMs < float64(time.Hour.Milliseconds()) || lagMs > float64((time.Hour+time.Minute).Milliseconds()) {
+		t.Fatalf("expected max_lag_ms of about 1h from mtime, got %v", dm["max_lag_ms"])
+	}
+}
+
+func TestRunner_DryRunOutCapturesSyslogLines(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	srcs := []string{filepath.Join(alertDir, "a.warn"), filepath.Join(alertDir, "b.warn")}
+	for i, p := range srcs {
+		if err := os.WriteFile(p, mustBuildFixtureJSON(t, fmt.Sprintf("heart beat missing ZBBB %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(tmp, "lines.log")
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		CCCCCodes:       []string{"ZBBB"},
+		DeleteAfterSend: true,
+		DryRun:          true,
+		DryRunOut:       out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := runner.db.Model(&SpoolEvent{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 captured lines, got %d: %q", len(lines), b)
+	}
+	lineRe := regexp.MustCompile(`^<134>1 \S+ \S+ alert-spooler \d+ alert \[cndp job="mhdbs" service="alerts" filename="([ab])\.warn" alert_type="general" alert_level="critical" hash="[0-9a-f]{24}" cccc="ZBBB" db_month="\d{6}" run_id="[0-9A-Z]{26}" seq="\d+" run_errs="0"\] \{.*\}$`)
+	for i, l := range lines {
+		m := lineRe.FindStringSubmatch(l)
+		if m == nil {
+			t.Fatalf("line %d does not match expected format: %q", i, l)
+		}
+	}
+
+	if n != 0 {
+		t.Fatalf("expected no events written in dry-run, got %d", n)
+	}
+	for _, p := range srcs {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected source kept in dry-run: %v", err)
+		}
+	}
+}
+
+func TestRunner_DryRunOutGzip(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(tmp, "lines.log.gz")
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		DryRun:       true,
+		DryRunOut:    out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "<134>1 ") || !strings.Contains(lines[0], `filename="a.warn"`) {
+		t.Fatalf("expected one syslog line after decompressing, got %q", b)
+	}
+}
+func TestRunner_OrderedInputSendsInMTimeOrder(t *testing.T) {
+	tmp := t.TempDir()
+	seqDir := filepath.Join(tmp, "seq")
+	parDir := filepath.Join(tmp, "par")
+	for _, d := range []string{seqDir, parDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Names sort opposite to mtimes so glob order alone would be wrong.
+	base := time.Now().Add(-time.Hour)
+	seq := []string{"c.warn", "b.warn", "a.warn"}
+	for i, name := range seq {
+		p := filepath.Join(seqDir, name)
+		if err := os.WriteFile(p, mustBuildFixtureJSON(t, fmt.Sprintf("ordered drop %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mt := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		p := filepath.Join(parDir, fmt.Sprintf("p%d.warn", i))
+		if err := os.WriteFile(p, mustBuildFixtureJSON(t, fmt.Sprintf("parallel drop %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder: tmp,
+		DBPrefix: "spooler_",
+		JobLabel: "mhdbs",
+		Inputs: []InputSpec{
+			{Glob: filepath.Join(parDir, "*.warn"), AlertType: "general", Workers: 4},
+			{Glob: filepath.Join(seqDir, "*.warn"), AlertType: "business", Ordered: true, Workers: 4},
+		},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != len(seq)+8 {
+		t.Fatalf("expected %d syslog sends, got %d", len(seq)+8, len(calls))
+	}
+	var got []string
+	for _, c := range calls {
+		if !strings.Contains(c.structuredData, `alert_type="business"`) {
+			continue
+		}
+		m := regexp.MustCompile(`filename="([^"]+)"`).FindStringSubmatch(c.structuredData)
+		if m == nil {
+			t.Fatalf("missing filename label: %q", c.structuredData)
+		}
+		got = append(got, m[1])
+	}
+	if strings.Join(got, ",") != strings.Join(seq, ",") {
+		t.Fatalf("expected ordered sends %v, got %v", seq, got)
+	}
+
+	var files int64
+	if err := runner.db.Model(&ProcessedFile{}).Count(&files).Error; err != nil {
+		t.Fatal(err)
+	}
+	if files != int64(len(seq)+8) {
+		t.Fatalf("expected %d processed files, got %d", len(seq)+8, files)
+	}
+}
+
+func TestMonthlyDBPath(t *testing.T) {
+	at := time.Date(2026, 2, 15, 12, 0, 0, 0, time.Local)
+	got := monthlyDBPath(filepath.Join("data", "db"), "alerts_", at)
+	if want := filepath.Join("data", "db", "alerts_202602.db"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	month, ok := parseMonthlyDBKey(filepath.Base(got), "alerts_")
+	if !ok || monthKey(month) != "202602" {
+		t.Fatalf("expected round trip to 202602, got %v ok=%v", month, ok)
+	}
+}
+
+func TestParseMonthlyDBKey_PrefixWithDigits(t *testing.T) {
+	cases := []struct {
+		base   string
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"site2024_202602.db", "site2024_", "202602", true},
+		{"alerts_202512.db", "alerts_", "202512", true},
+		// Digits that belong to the prefix must not be read as the key.
+		{"site2024_02.db", "site2024_", "", false},
+		{"site2024_202602.db", "site", "", false},
+		{"alerts_202613.db", "alerts_", "", false},
+		{"alerts_202602.db.bak", "alerts_", "", false},
+		{"other_202602.db", "alerts_", "", false},
+	}
+	for _, c := range cases {
+		month, ok := parseMonthlyDBKey(c.base, c.prefix)
+		if ok != c.ok {
+			t.Fatalf("%s (prefix %q): expected ok=%v, got %v", c.base, c.prefix, c.ok, ok)
+		}
+		if ok && monthKey(month) != c.want {
+			t.Fatalf("%s (prefix %q): expected %s, got %s", c.base, c.prefix, c.want, monthKey(month))
+		}
+	}
+}
+
+func TestListMonthlyDBs_PrefixWithDigits(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"site2024_202601.db", "site2024_202602.db", "site2024_202605.db", "site2024_notes.db"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := listMonthlyDBs(tmp, "site2024_", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(tmp, "site2024_202601.db"), filepath.Join(tmp, "site2024_202602.db")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestListMonthlyDBs_PrefixWithoutSeparator(t *testing.T) {
+	tmp := t.TempDir()
+	names := []string{
+		"db2024202511.db",
+		"db2024202602.db",
+		"db2024202600.db", // month 00
+		"db2024202613.db", // month 13
+		"db20242026021.db",
+		"db2024.db",
+		"xdb2024202602.db",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := listMonthlyDBs(tmp, "db2024", time.Time{}, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(tmp, "db2024202511.db"), filepath.Join(tmp, "db2024202602.db")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRunner_SendLifecycleStart(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		Version:      "v1.2.3",
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.SendLifecycle("start"); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, ` kind="lifecycle"`) {
+		t.Fatalf("expected kind=lifecycle in structured data, got: %q", calls[0].structuredData)
+	}
+	var msg struct {
+		Lifecycle         string `json:"lifecycle"`
+		Version           string `json:"version"`
+		ConfigFingerprint string `json:"config_fingerprint"`
+	}
+	if err := json.Unmarshal([]byte(calls[0].message), &msg); err != nil {
+		t.Fatalf("message is not JSON: %v: %q", err, calls[0].message)
+	}
+	if msg.Lifecycle != "start" || msg.Version != "v1.2.3" {
+		t.Fatalf("unexpected lifecycle message: %+v", msg)
+	}
+	if len(msg.ConfigFingerprint) != 12 {
+		t.Fatalf("expected 12-char config fingerprint, got %q", msg.ConfigFingerprint)
+	}
+
+	// Same config with another version keeps the fingerprint; a config change alters it.
+	other := runner.cfg
+	other.Version = "v2"
+	if configFingerprint(other) != msg.ConfigFingerprint {
+		t.Fatalf("expected fingerprint independent of version")
+	}
+	other.JobLabel = "other"
+	if configFingerprint(other) == msg.ConfigFingerprint {
+		t.Fatalf("expected fingerprint to change with config")
+	}
+}
+
+func TestRunner_SyslogTimestampFromEvent(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Fixture time is 2026-02-07 12:00:00; the second file has no time field.
+	if err := os.WriteFile(filepath.Join(alertDir, "a.warn"), mustBuildFixtureJSON(t, "past event"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "b.warn"), []byte(`{"detail":"no time"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:                 tmp,
+		DBPrefix:                 "spooler_",
+		JobLabel:                 "mhdbs",
+		Inputs:                   []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:               "127.0.0.1:1",
+		ServiceLabel:             "alerts",
+		HashHexLen:               24,
+		DeleteAfterSend:          true,
+		SyslogTimestampFromEvent: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	var buf bytes.Buffer
+	runner.syslog = NewLineWriter(&buf)
+
+	before := time.Now().UTC()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	want, ok := parseTimeString("2026-02-07 12:00:00", nil)
+	if !ok {
+		t.Fatal("parse fixture time")
+	}
+	stamps := map[string]time.Time{}
+	headerRe := regexp.MustCompile(`^<134>1 (\S+) .*filename="([^"]+)"`)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := headerRe.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("unexpected line: %q", line)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		stamps[m[2]] = ts
+	}
+	if got := stamps["a.warn"]; !got.Equal(want) {
+		t.Fatalf("expected header time %s for timed event, got %s", want.UTC(), got)
+	}
+	if got := stamps["b.warn"]; got.Before(before) {
+		t.Fatalf("expected header time now for untimed event, got %s", got)
+	}
+}
+
+func TestRunner_FinalizeFilesInBatches(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:          tmp,
+		DBPrefix:          "spooler_",
+		JobLabel:          "mhdbs",
+		Inputs:            []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:        "127.0.0.1:1",
+		ServiceLabel:      "alerts",
+		HashHexLen:        24,
+		DeleteAfterSend:   true,
+		FinalizeBatchSize: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	if err := runner.ensureDBForNow(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 25 files: even ones fully sent, odd ones with one unsent event.
+	const n = 25
+	for i := 0; i < n; i++ {
+		p := filepath.Join(alertDir, fmt.Sprintf("f%02d.warn", i))
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sha := fmt.Sprintf("sha%02d", i)
+		if err := runner.db.Create(&ProcessedFile{Path: p, SHA256: sha, ProcessedAt: time.Now().UTC()}).Error; err != nil {
+			t.Fatal(err)
+		}
+		events := []SpoolEvent{
+			{SourcePath: p, FileDigestSHA256: sha, EventIndex: 0, SentSyslog: true},
+			{SourcePath: p, FileDigestSHA256: sha, EventIndex: 1, SentSyslog: i%2 == 0},
+		}
+		if err := runner.db.Create(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var queries int
+	if err := runner.db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &runStats{}
+	if err := runner.finalizeFiles(time.Time{}, stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.FilesDeleted != (n+1)/2 {
+		t.Fatalf("expected %d files deleted, got %d", (n+1)/2, stats.FilesDeleted)
+	}
+	for i := 0; i < n; i++ {
+		_, statErr := os.Stat(filepath.Join(alertDir, fmt.Sprintf("f%02d.warn", i)))
+		if sent := i%2 == 0; sent != os.IsNotExist(statErr) {
+			t.Fatalf("file %d: sent=%v but stat err=%v", i, sent, statErr)
+		}
+	}
+	var allSent int64
+	if err := runner.db.Model(&ProcessedFile{}).Where("all_sent = ? AND deleted = ?", true, true).Count(&allSent).Error; err != nil {
+		t.Fatal(err)
+	}
+	if allSent != int64((n+1)/2) {
+		t.Fatalf("expected %d files marked sent+deleted, got %d", (n+1)/2, allSent)
+	}
+	// 3 pages x (page select + grouped count) + stuck count; per-file counting would need 50+.
+	if queries > 8 {
+		t.Fatalf("expected a bounded number of queries, got %d", queries)
+	}
+}
+
+func TestRunner_DecodeErrorWarnsWithSample(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const bad = maxDecodeWarningsPerRun + 2
+	for i := 0; i < bad; i++ {
+		content := fmt.Sprintf("{broken %02d ", i) + strings.Repeat("z", 500)
+		if err := os.WriteFile(filepath.Join(alertDir, fmt.Sprintf("bad%02d.warn", i)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := logs.String()
+	if got := strings.Count(out, "warn: decode error path="); got != maxDecodeWarningsPerRun {
+		t.Fatalf("expected %d rate-limited warnings, got %d:\n%s", maxDecodeWarningsPerRun, got, out)
+	}
+	first := filepath.Join(alertDir, "bad00.warn")
+	wantSample := fmt.Sprintf("sample=%q", "{broken 00 "+strings.Repeat("z", decodeSampleBytes-len("{broken 00 ")))
+	if !strings.Contains(out, fmt.Sprintf("path=%q", first)) || !strings.Contains(out, wantSample) {
+		t.Fatalf("expected warning with path and %d-byte sample, got:\n%s", decodeSampleBytes, out)
+	}
+	if !strings.Contains(out, "further ones are not logged") {
+		t.Fatalf("expected suppression notice, got:\n%s", out)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if got := dm["decode_errors"]; got != float64(bad) {
+		t.Fatalf("expected decode_errors=%d, got %v", bad, got)
+	}
+}
+
+func TestRunner_LowDiskSpaceWarns(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	errorDir := filepath.Join(tmp, "errors")
+	spillDir := filepath.Join(tmp, "spill")
+	for _, d := range []string{alertDir, errorDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:         tmp,
+		DBPrefix:         "spooler_",
+		JobLabel:         "mhdbs",
+		Inputs:           []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general", ErrorDir: errorDir}},
+		SyslogAddr:       "127.0.0.1:1",
+		ServiceLabel:     "alerts",
+		HashHexLen:       24,
+		DeadmanToken:     "spooler-run",
+		DiskFreeMinBytes: 1 << 20,
+		SpillDir:         spillDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	free := map[string]uint64{tmp: 4 << 20, errorDir: 1000, spillDir: 2000}
+	runner.diskFree = func(path string) (uint64, error) {
+		return free[path], nil
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("warn: low disk space dir=%q free_bytes=1000", errorDir); !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected %q in log, got:\n%s", want, logs.String())
+	}
+	if want := fmt.Sprintf("warn: low disk space dir=%q free_bytes=2000", spillDir); !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected %q in log, got:\n%s", want, logs.String())
+	}
+	if strings.Contains(logs.String(), fmt.Sprintf("dir=%q", tmp)) {
+		t.Fatalf("expected no warning for dir above threshold, got:\n%s", logs.String())
+	}
+	dm := mustDeadmanPayload(t, sender.Calls())
+	if got := dm["disk_free_bytes"]; got != float64(1000) {
+		t.Fatalf("expected disk_free_bytes=1000, got %v", got)
+	}
+
+	// Above the threshold: no warning and no deadman field.
+	free[errorDir] = 8 << 20
+	free[spillDir] = 8 << 20
+	logs.Reset()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "low disk space") {
+		t.Fatalf("expected no warning, got:\n%s", logs.String())
+	}
+	if _, ok := mustDeadmanPayload(t, sender.Calls())["disk_free_bytes"]; ok {
+		t.Fatalf("expected no disk_free_bytes above threshold")
+	}
+}
+
+func TestRunner_InputDefaultLevel(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "a.json"), []byte(`{"code":"PUMP","detail":"pump stopped ZBBB"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "b.json"), []byte(`{"code":"PUMP","detail":"pump slow ZBBB","status":"1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.json"), AlertType: "iec", DefaultLevel: "critical"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 syslog calls, got %d", len(calls))
+	}
+	for _, c := range calls {
+		want := `alert_level="critical"`
+		if strings.Contains(c.message, "pump slow") {
+			want = `alert_level="warning"`
+		}
+		if !strings.Contains(c.structuredData, want) {
+			t.Fatalf("expected %s, got %q", want, c.structuredData)
+		}
+	}
+}
+
+func TestNewRunner_RejectsUnknownDefaultLevel(t *testing.T) {
+	tmp := t.TempDir()
+	for _, level := range []string{"unknown", "info"} {
+		_, err := NewRunner(RunnerConfig{
+			DBFolder:   tmp,
+			JobLabel:   "mhdbs",
+			Inputs:     []InputSpec{{Glob: filepath.Join(tmp, "*.json"), DefaultLevel: level}},
+			SyslogAddr: "127.0.0.1:1",
+		})
+		if err == nil || !strings.Contains(err.Error(), "unsupported default_level") {
+			t.Fatalf("expected default_level %q rejected, got %v", level, err)
+		}
+	}
+}
+
+func TestRunner_InputTagRecordsFirstMatchingInput(t *testing.T) {
+	tmp := t.TempDir()
+	in := filepath.Join(tmp, "in")
+	if err := os.MkdirAll(in, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.warn", "b.json"} {
+		if err := os.WriteFile(filepath.Join(in, name), mustBuildFixtureJSON(t, "detail "+name+" ZBBB"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder: tmp,
+		DBPrefix: "spooler_",
+		JobLabel: "mhdbs",
+		// a.warn matches both; the first input wins.
+		Inputs: []InputSpec{
+			{Glob: filepath.Join(in, "*.warn"), AlertType: "iec"},
+			{Glob: filepath.Join(in, "*"), AlertType: "general"},
+		},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.warn": "inputs[0]:iec", "b.json": "inputs[1]:general"}
+	var pfs []ProcessedFile
+	if err := runner.db.Find(&pfs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(pfs) != 2 {
+		t.Fatalf("expected 2 processed files, got %d", len(pfs))
+	}
+	for _, pf := range pfs {
+		if got := pf.InputTag; got != want[filepath.Base(pf.Path)] {
+			t.Fatalf("file %s: expected input tag %q, got %q", pf.Path, want[filepath.Base(pf.Path)], got)
+		}
+	}
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range events {
+		if got := ev.InputTag; got != want[filepath.Base(ev.SourcePath)] {
+			t.Fatalf("event of %s: expected input tag %q, got %q", ev.SourcePath, want[filepath.Base(ev.SourcePath)], got)
+		}
+	}
+}
+
+func TestRunner_InputDedupFile(t *testing.T) {
+	tmp := t.TempDir()
+	content := []byte(`[{"code":"PUMP","detail":"pump stopped ZBBB"},{"code":"FAN","detail":"fan slow ZBBB"}]`)
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.json"), AlertType: "iec", Dedup: "file"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 syslog calls, got %d", len(calls))
+	}
+	sum := sha256.Sum256(content)
+	want := `hash="` + hex.EncodeToString(sum[:])[:24] + `"`
+	for _, c := range calls {
+		if !strings.Contains(c.structuredData, want) {
+			t.Fatalf("expected every event to carry the file digest %s, got %q", want, c.structuredData)
+		}
+	}
+}
+
+func TestNewRunner_UnsupportedDedup(t *testing.T) {
+	tmp := t.TempDir()
+	_, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		JobLabel:   "mhdbs",
+		Inputs:     []InputSpec{{Glob: filepath.Join(tmp, "*.json"), Dedup: "line"}},
+		SyslogAddr: "127.0.0.1:1",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported dedup") {
+		t.Fatalf("expected unsupported dedup error, got %v", err)
+	}
+}
+
+func TestRunner_TraceIDField(t *testing.T) {
+	tmp := t.TempDir()
+	withTrace := `{"code":"NIL_REPORT","detail":"traced ZBBB","ctx":{"trace_id":"4bf92f3577b34da6"}}`
+	without := `{"code":"NIL_REPORT","detail":"untraced ZBBB"}`
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(withTrace), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "b.warn"), []byte(without), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		TraceIDField: "ctx.trace_id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 syslog calls, got %d", len(calls))
+	}
+	for _, c := range calls {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(c.message), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(c.message, "untraced") {
+			if strings.Contains(c.structuredData, "trace_id=") || payload["trace_id"] != nil {
+				t.Fatalf("expected no trace_id for an event without one: %q %q", c.structuredData, c.message)
+			}
+			continue
+		}
+		if !strings.Contains(c.structuredData, `trace_id="4bf92f3577b34da6"`) {
+			t.Fatalf("expected trace_id label, got %q", c.structuredData)
+		}
+		if payload["trace_id"] != "4bf92f3577b34da6" {
+			t.Fatalf("expected trace_id payload field, got %v", payload["trace_id"])
+		}
+	}
+}
+
+func TestRunner_RunIDAndSeqLabels(t *testing.T) {
+	tmp := t.TempDir()
+	items := `[{"code":"A","detail":"one ZBBB"},{"code":"B","detail":"two ZBBB"},{"code":"C","detail":"three ZBBB"}]`
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(items), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`run_id="([0-9A-Z]{26})" seq="(\d+)"`)
+	calls := sender.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 syslog calls, got %d", len(calls))
+	}
+	var runID string
+	for i, c := range calls {
+		m := re.FindStringSubmatch(c.structuredData)
+		if m == nil {
+			t.Fatalf("expected run_id and seq, got %q", c.structuredData)
+		}
+		if i == 0 {
+			runID = m[1]
+		} else if m[1] != runID {
+			t.Fatalf("expected a constant run_id within the run, got %s then %s", runID, m[1])
+		}
+		if want := strconv.Itoa(i + 1); m[2] != want {
+			t.Fatalf("expected seq=%s for send %d, got %s", want, i, m[2])
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(tmp, "b.warn"), mustBuildFixtureJSON(t, "four ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	m := re.FindStringSubmatch(sender.Calls()[3].structuredData)
+	if m == nil || m[1] == runID || m[2] != "1" {
+		t.Fatalf("expected a new run_id with seq restarting at 1, got %v", m)
+	}
+}
+
+func TestRunner_RunErrsCountsFailedSends(t *testing.T) {
+	tmp := t.TempDir()
+	items := `[{"code":"A","detail":"one ZBBB"},{"code":"B","detail":"two ZBBB"},{"code":"C","detail":"three ZBBB"}]`
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(items), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	sender.FailNext(1)
+	runner.syslog = sender
+
+	_ = runner.RunOnce()
+	calls := sender.Calls()
+	if len(calls) < 2 {
+		t.Fatalf("expected sends after the failure, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].structuredData, `run_errs="0"`) {
+		t.Fatalf("expected run_errs=\"0\" on the first send, got %q", calls[0].structuredData)
+	}
+	for _, c := range calls[1:] {
+		if !strings.Contains(c.structuredData, `run_errs="1"`) {
+			t.Fatalf("expected run_errs=\"1\" after the failed send, got %q", c.structuredData)
+		}
+	}
+
+	// The next run starts from zero again.
+	if err := os.WriteFile(filepath.Join(tmp, "b.warn"), mustBuildFixtureJSON(t, "four ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	last := sender.Calls()
+	if c := last[len(last)-1]; !strings.Contains(c.structuredData, `run_errs="0"`) {
+		t.Fatalf("expected run_errs reset for a new run, got %q", c.structuredData)
+	}
+}
+
+func TestRunner_FlattenDisabledSkipsFlatView(t *testing.T) {
+	tmp := t.TempDir()
+	body := `{"code":"NIL_REPORT","detail":"deep ZBBB","ctx":{"trace_id":"t-1","nested":{"a":[1,2,3]}}}`
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:       tmp,
+		DBPrefix:       "spooler_",
+		JobLabel:       "mhdbs",
+		Inputs:         []InputSpec{{Glob: filepath.Join(tmp, "*.warn"), AlertType: "general"}},
+		SyslogAddr:     "127.0.0.1:1",
+		ServiceLabel:   "alerts",
+		HashHexLen:     24,
+		TraceIDField:   "ctx.trace_id",
+		FlattenEnabled: &disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog call, got %d", len(calls))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(calls[0].message), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["flat"]; ok {
+		t.Fatalf("expected no flat in payload, got %q", calls[0].message)
+	}
+	if payload["trace_id"] != "t-1" {
+		t.Fatalf("expected trace_id still resolved without flat, got %v", payload["trace_id"])
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ev.FlatJSON != "{}" {
+		t.Fatalf("expected FlatJSON {}, got %q", ev.FlatJSON)
+	}
+	// Rows archived before TraceID was stored read it from the event.
+	ev.TraceID = ""
+	if id := runner.traceID(ev); id != "t-1" {
+		t.Fatalf("expected trace_id read from the stored event, got %q", id)
+	}
+}
+
+func BenchmarkBuildEvent_Flatten(b *testing.B) {
+	item := map[string]any{"code": "NIL_REPORT", "detail": "deep ZBBB"}
+	cur := item
+	for i := 0; i < 12; i++ {
+		next := map[string]any{}
+		for j := 0; j < 8; j++ {
+			next[fmt.Sprintf("k%d", j)] = fmt.Sprintf("v%d-%d", i, j)
+		}
+		cur["child"] = next
+		cur = next
+	}
+	for _, enabled := range []bool{true, false} {
+		enabled := enabled
+		b.Run(fmt.Sprintf("enabled=%v", enabled), func(b *testing.B) {
+			r := &Runner{cfg: RunnerConfig{HashHexLen: 24, FlattenEnabled: &enabled}}
+			now := time.Now().UTC()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.buildEvent(item, "", "a.warn", "warn", "general", "sha", hashSpec{}, "", 0, now, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunner_PayloadShapeEnvelope(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "general")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(alertDir, "one.warn"), mustBuildFixtureJSON(t, "heart beat missing ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(alertDir, "*.warn"), AlertType: "general"}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		CCCCCodes:       []string{"ZBBB"},
+		DeleteAfterSend: true,
+		PayloadShape:    "envelope",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sender.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 syslog send, got %d", len(calls))
+	}
+	var m struct {
+		Meta map[string]string `json:"meta"`
+		Body map[string]any    `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(calls[0].message), &m); err != nil {
+		t.Fatalf("payload should be valid json: %v", err)
+	}
+	if m.Meta["job"] != "mhdbs" || m.Meta["alert_type"] != "general" || m.Meta["cccc"] != "ZBBB" || len(m.Meta["hash"]) != 24 {
+		t.Fatalf("expected labels under meta, got %v", m.Meta)
+	}
+	if m.Body["source"] != filepath.Join(alertDir, "one.warn") || m.Body["event"] == nil || m.Body["flat"] == nil {
+		t.Fatalf("expected flat payload under body, got %v", m.Body)
+	}
+
+	if _, err := NewRunner(RunnerConfig{DBFolder: tmp, InputGlobs: []string{"*.warn"}, SyslogAddr: "127.0.0.1:1", PayloadShape: "nested"}); err == nil {
+		t.Fatalf("expected error for unknown payload shape")
+	}
+}
+
+func TestRunner_HashScopeAlertType(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		scope    []string
+		wantSame bool
+	}{
+		{name: "text only", scope: nil, wantSame: true},
+		{name: "alert_type", scope: []string{"alert_type"}, wantSame: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			content := mustBuildFixtureJSON(t, "same text ZBBB")
+			for _, typ := range []string{"dev", "iec"} {
+				if err := os.MkdirAll(filepath.Join(tmp, typ), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(tmp, typ, "one.warn"), content, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			runner, err := NewRunner(RunnerConfig{
+				DBFolder: tmp,
+				DBPrefix: "spooler_",
+				JobLabel: "mhdbs",
+				Inputs: []InputSpec{
+					{Glob: filepath.Join(tmp, "dev", "*.warn"), AlertType: "dev"},
+					{Glob: filepath.Join(tmp, "iec", "*.warn"), AlertType: "iec"},
+				},
+				SyslogAddr:   "127.0.0.1:1",
+				ServiceLabel: "alerts",
+				HashHexLen:   24,
+				HashScope:    tc.scope,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+			runner.syslog = &mockSyslogSender{}
+
+			if err := runner.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+			var events []SpoolEvent
+			if err := runner.db.Order("alert_type").Find(&events).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 2 {
+				t.Fatalf("expected 2 events, got %d", len(events))
+			}
+			if same := events[0].ContentHash == events[1].ContentHash; same != tc.wantSame {
+				t.Fatalf("expected same hash=%v, got %s / %s", tc.wantSame, events[0].ContentHash, events[1].ContentHash)
+			}
+		})
+	}
+}
+
+func TestRunner_HashModeEvent(t *testing.T) {
+	tmp := t.TempDir()
+	eventDir := filepath.Join(tmp, "event")
+	if err := os.MkdirAll(eventDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// No free-text detail; a and b differ only in their timestamp.
+	files := map[string]string{
+		filepath.Join(eventDir, "a.warn"): `{"code":"PUMP_STOP","station":"S1","time":"2026-02-07 12:00:00"}`,
+		filepath.Join(eventDir, "b.warn"): `{"code":"PUMP_STOP","station":"S1","time":"2026-02-08 09:30:15"}`,
+		filepath.Join(eventDir, "c.warn"): `{"code":"PUMP_SLOW","station":"S1","time":"2026-02-08 09:30:15"}`,
+	}
+	for p, content := range files {
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(eventDir, "*.warn"), AlertType: "general", HashMode: "event"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]string{}
+	for _, ev := range events {
+		hashes[filepath.Base(ev.SourcePath)] = ev.ContentHash
+	}
+	if hashes["a.warn"] == "" || hashes["a.warn"] != hashes["b.warn"] {
+		t.Fatalf("expected events differing only by timestamp to share a hash, got %v", hashes)
+	}
+	if hashes["a.warn"] == hashes["c.warn"] {
+		t.Fatalf("expected different events to hash differently under event mode, got %v", hashes)
+	}
+
+	fields := hashInput(map[string]any{"code": "X", "station": map[string]any{"id": "S1", "name": "north"}}, "", hashSpec{Mode: "fields", Fields: []string{"code", "station.id"}})
+	if fields != `{"code":"X","station":{"id":"S1"}}` {
+		t.Fatalf("unexpected fields hash input: %s", fields)
+	}
+}
+
+func TestRunner_LagByAlertType(t *testing.T) {
+	tmp := t.TempDir()
+	devDir := filepath.Join(tmp, "dev")
+	bizDir := filepath.Join(tmp, "business")
+	for _, d := range []string{devDir, bizDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	at := func(ago time.Duration) string {
+		return fmt.Sprintf(`{"detail":"lag","time":%q}`, now.Add(-ago).Format(time.RFC3339))
+	}
+	files := map[string]string{
+		filepath.Join(devDir, "a.alarm"): at(2 * time.Hour),
+		filepath.Join(devDir, "b.alarm"): at(4 * time.Hour),
+		filepath.Join(bizDir, "c.warn"):  at(10 * time.Minute),
+	}
+	for p, content := range files {
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder: tmp,
+		DBPrefix: "spooler_",
+		JobLabel: "mhdbs",
+		Inputs: []InputSpec{
+			{Glob: filepath.Join(devDir, "*.alarm"), AlertType: "dev"},
+			{Glob: filepath.Join(bizDir, "*.warn"), AlertType: "business"},
+		},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		DeadmanToken:    "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	byType, ok := dm["lag_by_type"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected lag_by_type object, got %v", dm["lag_by_type"])
+	}
+	near := func(got any, want time.Duration) bool {
+		ms, ok := got.(float64)
+		return ok && math.Abs(ms-float64(want.Milliseconds())) < float64((time.Minute).Milliseconds())
+	}
+	dev, _ := byType["dev"].(map[string]any)
+	if !near(dev["max_ms"], 4*time.Hour) || !near(dev["avg_ms"], 3*time.Hour) || dev["count"] != float64(2) {
+		t.Fatalf("unexpected dev lag: %v", dev)
+	}
+	biz, _ := byType["business"].(map[string]any)
+	if !near(biz["max_ms"], 10*time.Minute) || !near(biz["avg_ms"], 10*time.Minute) || biz["count"] != float64(1) {
+		t.Fatalf("unexpected business lag: %v", biz)
+	}
+	if !near(dm["max_lag_ms"], 4*time.Hour) {
+		t.Fatalf("expected global max lag of 4h, got %v", dm["max_lag_ms"])
+	}
+}
+
+func TestRunner_LagFromNestedEventTimeKey(t *testing.T) {
+	tmp := t.TempDir()
+	stamp := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339)
+	body := fmt.Sprintf(`{"detail":"nested ZBBB","header":{"timestamp":%q}}`, stamp)
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		JobLabel:      "mhdbs",
+		Inputs:        []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:    "127.0.0.1:1",
+		ServiceLabel:  "alerts",
+		HashHexLen:    24,
+		DeadmanToken:  "spooler-run",
+		EventTimeKeys: []string{"header.timestamp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := mustDeadmanPayload(t, sender.Calls())
+	ms, _ := dm["max_lag_ms"].(float64)
+	if math.Abs(ms-float64((2*time.Hour).Milliseconds())) > float64(time.Minute.Milliseconds()) {
+		t.Fatalf("expected max_lag_ms of about 2h from header.timestamp, got %v", dm["max_lag_ms"])
+	}
+}
+
+func TestRunner_PollStopsAfterMaxIterations(t *testing.T) {
+	tmp := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		DeadmanToken: "spooler-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if n := runner.Poll(time.Millisecond, 3, nil); n != 3 {
+		t.Fatalf("expected 3 sweeps, got %d", n)
+	}
+	if got := len(sender.Calls()); got != 3 {
+		t.Fatalf("expected one deadman per sweep (3), got %d", got)
+	}
+
+	// A closed stop channel ends an unbounded loop after the current sweep.
+	stop := make(chan struct{})
+	close(stop)
+	if n := runner.Poll(time.Hour, 0, stop); n != 1 {
+		t.Fatalf("expected 1 sweep before stop, got %d", n)
+	}
+}
+
+func TestRunner_RunSummaryLine(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		InputGlobs:      []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:      "127.0.0.1:1",
+		DeleteAfterSend: true,
+		RunSummary:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+	var out bytes.Buffer
+	runner.stdout = &out
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`^ingested=1 new=1 sent=1 err=0 deleted=1 maxlag=\S+\n$`)
+	if !re.MatchString(out.String()) {
+		t.Fatalf("unexpected summary line: %q", out.String())
+	}
+}
+
+func TestRunner_TimeoutIsTypedAndReportedInDeadman(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		DeadmanToken: "spooler-run",
+		Timeout:      time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	err = runner.RunOnce()
+	if !errors.Is(err, ErrRunTimeout) {
+		t.Fatalf("expected ErrRunTimeout, got %v", err)
+	}
+	if got := mustDeadmanPayload(t, sender.Calls())["status"]; got != "timeout" {
+		t.Fatalf("expected deadman status=timeout, got %v", got)
+	}
+}
+
+func TestRunner_MaxDBScanLimitsResendToRecentMonths(t *testing.T) {
+	tmp := t.TempDir()
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		month := time.Date(now.Year(), now.Month()-time.Month(i), 15, 0, 0, 0, 0, time.Local)
+		db, err := OpenDB(monthlyDBPath(tmp, "spooler_", month))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&SpoolEvent{AlertType: "general", SourcePath: fmt.Sprintf("m%d.warn", i), ArchivedAt: month.UTC()}).Error; err != nil {
+			t.Fatal(err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlDB.Close()
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		DBByEventTime: true,
+		MaxDBScan:     3,
+		FlushOnly:     true,
+		JobLabel:      "mhdbs",
+		InputGlobs:    []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:    "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "3 pending event(s) in 3 monthly DB(s)") {
+		t.Fatalf("expected the stranded pending events logged, got %q", logs.String())
+	}
+	// The previous-month DBs are closed when the run ends.
+	if got := len(runner.monthDBs); got != 0 {
+		t.Fatalf("expected previous-month DBs closed after the run, %d still open", got)
+	}
+	// The current month plus the two before it.
+	if got := len(sender.Calls()); got != 2 {
+		t.Fatalf("expected pending events from the 2 most recent previous months, got %d sends", got)
+	}
+	for _, c := range sender.Calls() {
+		if !strings.Contains(c.structuredData, `filename="m1.warn"`) && !strings.Contains(c.structuredData, `filename="m2.warn"`) {
+			t.Fatalf("expected DBs beyond max_db_scan left unscanned, got %q", c.structuredData)
+		}
+	}
+}
+
+func TestRunner_LargeFileArchivesInBatches(t *testing.T) {
+	tmp := t.TempDir()
+	// 2000 events x 21 columns is past SQLite's 32766 bound-variable limit for one INSERT.
+	const n = 2000
+	items := make([]map[string]any, n)
+	for i := range items {
+		items[i] = map[string]any{"code": "BULK", "detail": fmt.Sprintf("bulk item %d ZBBB", i)}
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "bulk.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		DBPrefix:   "spooler_",
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.json")},
+		SyslogAddr: "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := runner.db.Model(&SpoolEvent{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("expected %d archived events, got %d", n, count)
 	}
 }
@@ -0,0 +1,92 @@
+package spooler
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ingestShardDir ingests a shard directory as one logical file: the merged shards are
+// hashed, archived and finalized like a file's content, keyed by the directory path.
+// Directories without shards yet are left for a later run.
+func (r *Runner) ingestShardDir(it inputItem, deadline time.Time, stats *runStats) error {
+	dir := it.Path
+	info, err := r.fs.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || r.tooYoung(dir, info) {
+		return nil
+	}
+	content, err := r.readShards(dir)
+	if err != nil {
+		// Best-effort: move unreadable directories out of the input directory.
+		if strings.TrimSpace(it.ErrorDir) != "" {
+			_, _ = MoveFileToDirFSVerify(r.fs, dir, it.ErrorDir, r.cfg.MoveVerify)
+		}
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	return r.ingestContent(it, info, content, deadline, stats)
+}
+
+// readShards merges dir's *.json shards, sorted by name, into one JSON array: array shards
+// contribute their elements, other shards themselves. When a shard is not valid JSON the
+// raw shards are returned newline-joined, so the directory fails to decode as a whole.
+// It returns nil when there are no shards.
+func (r *Runner) readShards(dir string) ([]byte, error) {
+	paths, err := r.fs.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	sort.Strings(paths)
+	raws := make([][]byte, 0, len(paths))
+	for _, p := range paths {
+		b, err := r.fs.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, b)
+	}
+
+	merged := []json.RawMessage{}
+	for _, b := range raws {
+		var items []json.RawMessage
+		if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+			if err := json.Unmarshal(b, &items); err != nil {
+				return bytes.Join(raws, []byte("\n")), nil
+			}
+			merged = append(merged, items...)
+			continue
+		}
+		if !json.Valid(b) {
+			return bytes.Join(raws, []byte("\n")), nil
+		}
+		merged = append(merged, json.RawMessage(bytes.TrimSpace(b)))
+	}
+	return json.Marshal(merged)
+}
+
+// isShardDir reports whether path is a directory matched by a Shards input, which is
+// deleted as a whole. Other directories still fail to delete with Remove.
+func (r *Runner) isShardDir(path string) bool {
+	for _, in := range r.cfg.Inputs {
+		if !in.Shards {
+			continue
+		}
+		if ok, _ := filepath.Match(in.Glob, path); !ok {
+			continue
+		}
+		info, err := r.fs.Stat(path)
+		return err == nil && info.IsDir()
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunner_ShardDirectoryIngestedAsOneFile(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "general", "alert-1.warn")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	first := "[" + string(mustBuildFixtureJSON(t, "first shard ZBBB")) + "]"
+	if err := os.WriteFile(filepath.Join(dir, "part-0000.json"), []byte(first), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "part-0001.json"), mustBuildFixtureJSON(t, "second shard ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "general", "*"), AlertType: "general", Shards: true}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 events from 2 shards, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].message, "first shard") || !strings.Contains(calls[1].message, "second shard") {
+		t.Fatalf("expected shard events in name order, got %q / %q", calls[0].message, calls[1].message)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected shard directory deleted, stat err=%v", err)
+	}
+
+	var pfs []ProcessedFile
+	if err := runner.db.Find(&pfs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(pfs) != 1 || pfs[0].Path != dir || !pfs[0].Deleted {
+		t.Fatalf("expected one deleted processed-file row for the directory, got %+v", pfs)
+	}
+}
+
+func TestRunner_ShardDirectoryKeptWhenShardsAddedAfterIngest(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "general", "alert-1.warn")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "part-0000.json"), mustBuildFixtureJSON(t, "first shard ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "general", "*"), AlertType: "general", Shards: true}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	// Keep the directory pending so a shard can land before it is finalized.
+	sender.FailNext(2)
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	var pf ProcessedFile
+	if err := runner.db.Where("path = ?", dir).First(&pf).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "part-0001.json"), mustBuildFixtureJSON(t, "late shard ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.tryDeleteProcessedFile(dir, pf.SHA256); err == nil {
+		t.Fatalf("expected the changed shard directory not to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "part-0001.json")); err != nil {
+		t.Fatalf("expected the late shard kept: %v", err)
+	}
+
+	// The next run ingests the new content, sends the late shard, then removes the directory.
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	sent := false
+	for _, c := range sender.Calls() {
+		sent = sent || strings.Contains(c.message, "late shard")
+	}
+	if !sent {
+		t.Fatalf("expected the late shard sent")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the directory removed once its content was sent, stat err=%v", err)
+	}
+}
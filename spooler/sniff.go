@@ -0,0 +1,86 @@
+package spooler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SourceTypeSniffRule derives the source type from the first line of a file's content,
+// for producers whose file names carry no meaningful extension. Set Prefix or Regex.
+type SourceTypeSniffRule struct {
+	Prefix     string `yaml:"prefix"`
+	Regex      string `yaml:"regex"`
+	SourceType string `yaml:"source_type"`
+	// StripLine drops the matched marker line before the content is decoded as JSON.
+	StripLine bool `yaml:"strip_line"`
+}
+
+type sourceTypeSniffer struct {
+	rule SourceTypeSniffRule
+	re   *regexp.Regexp
+}
+
+func compileSourceTypeSniff(rules []SourceTypeSniffRule) ([]sourceTypeSniffer, error) {
+	out := make([]sourceTypeSniffer, 0, len(rules))
+	for i, rule := range rules {
+		rule.SourceType = strings.TrimSpace(rule.SourceType)
+		if rule.SourceType == "" {
+			return nil, fmt.Errorf("source_type_sniff[%d]: source_type is required", i)
+		}
+		s := sourceTypeSniffer{rule: rule}
+		switch {
+		case rule.Regex != "":
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("source_type_sniff[%d]: invalid regex %q: %w", i, rule.Regex, err)
+			}
+			s.re = re
+		case rule.Prefix == "":
+			return nil, fmt.Errorf("source_type_sniff[%d]: prefix or regex is required", i)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// sniffSourceType matches content's first line against sniffers in order. It returns the
+// first matching rule's source type and the content to decode (without the marker line
+// when the rule strips it).
+func sniffSourceType(sniffers []sourceTypeSniffer, content []byte) (string, []byte, bool) {
+	first, rest := content, []byte(nil)
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		first, rest = content[:i], content[i+1:]
+	}
+	first = bytes.TrimRight(first, "\r")
+	for _, s := range sniffers {
+		var ok bool
+		if s.re != nil {
+			ok = s.re.Match(first)
+		} else {
+			ok = bytes.HasPrefix(first, []byte(s.rule.Prefix))
+		}
+		if !ok {
+			continue
+		}
+		if s.rule.StripLine {
+			return s.rule.SourceType, rest, true
+		}
+		return s.rule.SourceType, content, true
+	}
+	return "", content, false
+}
+
+// sourceTypeFor is inferSourceType, falling back to the SourceTypeSniff rules when the
+// extension is not a known type. It also returns the content to decode.
+func (r *Runner) sourceTypeFor(path string, content []byte) (string, []byte) {
+	sourceType := inferSourceType(path)
+	if sourceType == "warn" || sourceType == "alarm" || len(r.sniffers) == 0 {
+		return sourceType, content
+	}
+	if sniffed, body, ok := sniffSourceType(r.sniffers, content); ok {
+		return sniffed, body
+	}
+	return sourceType, content
+}
@@ -0,0 +1,79 @@
+package spooler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunner_SourceTypeFromLeadingMarker(t *testing.T) {
+	tmp := t.TempDir()
+	alertDir := filepath.Join(tmp, "drops")
+	if err := os.MkdirAll(alertDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Typeless names; the kind is only in the first line.
+	files := map[string]string{
+		"drop-0001":     "#KIND=alarm\n{\"detail\":\"pump stopped\"}\n",
+		"drop-0002.dat": "#KIND=warning\r\n{\"detail\":\"pump slow\"}",
+		"drop-0003":     "{\"detail\":\"no marker\"}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(alertDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(alertDir, "*"), AlertType: "general"}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SourceTypeSniff: []SourceTypeSniffRule{
+			{Prefix: "#KIND=alarm", SourceType: "alarm", StripLine: true},
+			{Regex: `^#KIND=warn(ing)?$`, SourceType: "warn", StripLine: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockSyslogSender{}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []SpoolEvent
+	if err := runner.db.Order("source_path").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"drop-0001": "alarm", "drop-0002.dat": "warn", "drop-0003": ""}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for _, ev := range events {
+		name := filepath.Base(ev.SourcePath)
+		if ev.SourceType != want[name] {
+			t.Fatalf("%s: expected source type %q, got %q", name, want[name], ev.SourceType)
+		}
+		if ev.DecodeError != "" {
+			t.Fatalf("%s: expected marker line stripped before decode, got %q", name, ev.DecodeError)
+		}
+	}
+}
+
+func TestCompileSourceTypeSniff_Invalid(t *testing.T) {
+	for _, rules := range [][]SourceTypeSniffRule{
+		{{Prefix: "#KIND"}},
+		{{SourceType: "alarm"}},
+		{{Regex: "(", SourceType: "alarm"}},
+	} {
+		if _, err := compileSourceTypeSniff(rules); err == nil {
+			t.Fatalf("expected error for %+v", rules)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package spooler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// spillSuffix marks the SpillDir files, one formatted syslog line each.
+const spillSuffix = ".syslog"
+
+// spillFileName is the SpillDir file of the event id stored in the DB keyed dbKey (the
+// YYYYMM month, or "static" for the legacy single DB). The zero-padded id keeps the
+// files in send order when listed.
+func spillFileName(dbKey string, id uint) string {
+	return fmt.Sprintf("%s_%010d%s", dbKey, id, spillSuffix)
+}
+
+// parseSpillFileName reverses spillFileName.
+func parseSpillFileName(name string) (string, uint, bool) {
+	base, ok := strings.CutSuffix(name, spillSuffix)
+	if !ok {
+		return "", 0, false
+	}
+	key, idText, ok := strings.Cut(base, "_")
+	if !ok {
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, false
+	}
+	return key, uint(id), true
+}
+
+// spill writes the line of each event that failed to send to SpillDir, so what is stuck
+// is visible on disk while the receiver is down. events must be stored (their IDs set),
+// each in the monthly DB eventDBMonth picks, whose key the file name records. Suppressed
+// events are not failures and are skipped. Lines carry the resend label but no
+// run_id/seq, since the event is resent by a later run. Best-effort: a failed write is
+// logged and the event stays pending in the DB regardless.
+func (r *Runner) spill(events []SpoolEvent) {
+	dir := strings.TrimSpace(r.cfg.SpillDir)
+	ls, ok := r.syslog.(SyslogLineSender)
+	if dir == "" || !ok {
+		return
+	}
+	for _, ev := range events {
+		if ev.SentSyslog || ev.Suppressed || ev.ID == 0 {
+			continue
+		}
+		dbMonth := r.eventDBMonth(ev)
+		labels, payload := r.spillRecord(ev, dbMonth)
+		ts := r.sendTimestamp(ev)
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		line := ls.FormatLine(ts, "alert-spooler", msgIDAlert, r.structuredData(labels), payload)
+		key := dbMonth
+		if key == "" {
+			key = r.dbKey
+		}
+		r.budget.acquire()
+		err := writeSpillFile(dir, spillFileName(key, ev.ID), []byte(line))
+		r.budget.release()
+		if err != nil {
+			log.Printf("warn: spill write failed dir=%q id=%d err=%v", dir, ev.ID, err)
+		}
+	}
+}
+
+// writeSpillFile writes b to dir/name through a synced temp file renamed into place, so a
+// crash never leaves a partial line for drainSpill to send. The temp name lacks
+// spillSuffix and is ignored by the drain.
+func writeSpillFile(dir string, name string, b []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// spillRecord is the labels and payload of ev's spilled line.
+func (r *Runner) spillRecord(ev SpoolEvent, dbMonth string) (map[string]string, string) {
+	labels := r.eventLabels(ev, dbMonth)
+	labels["resend"] = "true"
+	return labels, r.encodePayload(labels, r.eventPayload(ev, labels))
+}
+
+// drainSpill resends the events of the SpillDir files, oldest first, before a run ingests
+// new input. Each event goes through resendEvent as resendPending would send it: only to
+// the targets its SentTo does not list yet, held by a quiet window, and marked sent once
+// every target has it. The file is removed once its event is done (including an event
+// found already sent, e.g. by resendPending). The first failed send stops the drain, the
+// receiver being likely still down: that file and the rest stay for the next run.
+func (r *Runner) drainSpill(deadline time.Time, stats *runStats) error {
+	dir := strings.TrimSpace(r.cfg.SpillDir)
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spillSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if isDeadlineExceeded(deadline) {
+			return ErrRunTimeout
+		}
+		path := filepath.Join(dir, name)
+		key, id, ok := parseSpillFileName(name)
+		if !ok {
+			log.Printf("warn: spill: skipping unrecognized file %q", path)
+			continue
+		}
+		db, err := r.spillDB(key)
+		if err != nil {
+			log.Printf("warn: spill: skipping %q: %v", path, err)
+			continue
+		}
+		var ev SpoolEvent
+		err = db.Where("id = ?", id).First(&ev).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err != nil || ev.SentSyslog {
+			r.debugf("spill: event gone or already sent, removing path=%q", path)
+			_ = os.Remove(path)
+			continue
+		}
+		dbMonth := key
+		if strings.TrimSpace(r.cfg.DBFolder) == "" {
+			dbMonth = ""
+		}
+		done, err := r.resendEvent(db, dbMonth, ev, deadline, stats)
+		if err != nil {
+			log.Printf("warn: spill: send failed, drain stopped path=%q err=%v", path, err)
+			return nil
+		}
+		if !done {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("warn: spill: remove failed path=%q err=%v", path, err)
+		}
+		r.debugf("spill: done path=%q", path)
+	}
+	return nil
+}
+
+// spillDB is the DB a spill file's event is stored in, by spillFileName's key.
+func (r *Runner) spillDB(key string) (*gorm.DB, error) {
+	if key == r.dbKey {
+		return r.db, nil
+	}
+	month, err := time.ParseInLocation(monthKeyLayout, key, time.Local)
+	if err != nil || strings.TrimSpace(r.cfg.DBFolder) == "" {
+		return nil, fmt.Errorf("spill: unknown DB %q", key)
+	}
+	return r.dbForMonth(month)
+}
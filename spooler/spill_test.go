@@ -0,0 +1,368 @@
+package spooler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockLineSender is a mockSyslogSender that also sends preformatted lines; FailNext
+// applies to both kinds of send.
+type mockLineSender struct {
+	mockSyslogSender
+	lines []string
+}
+
+func (m *mockLineSender) FormatLine(ts time.Time, appName string, msgID string, structuredData string, message string) string {
+	return msgID + " " + structuredData + " " + message + "\n"
+}
+
+func (m *mockLineSender) SendLineTimeout(line string, timeout time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lines = append(m.lines, line)
+	if m.failN > 0 {
+		m.failN--
+		return errors.New("mock syslog send failure")
+	}
+	return nil
+}
+
+func TestRunner_SpillDirWritesFailedSendsAndDrains(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	src := filepath.Join(tmp, "a.warn")
+	if err := os.WriteFile(src, mustBuildFixtureJSON(t, "detail spilled ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:        tmp,
+		DBPrefix:        "spooler_",
+		JobLabel:        "mhdbs",
+		Inputs:          []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:      "127.0.0.1:1",
+		ServiceLabel:    "alerts",
+		HashHexLen:      24,
+		DeleteAfterSend: true,
+		SpillDir:        spillDir,
+		AuditDir:        filepath.Join(tmp, "audit"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockLineSender{}
+	// The new send and the in-run resend both fail.
+	sender.FailNext(2)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog"))
+	if len(spilled) != 1 {
+		t.Fatalf("expected one spill file, got %v", spilled)
+	}
+	b, err := os.ReadFile(spilled[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := string(b); !strings.Contains(line, "spilled") || !strings.Contains(line, `resend="true"`) {
+		t.Fatalf("unexpected spilled line %q", line)
+	}
+
+	// The receiver is back: the drain resends the event once and resendPending does not.
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected one send by the drain, got %d sends", len(calls))
+	}
+	if last := calls[2]; !strings.Contains(last.structuredData, `resend="true"`) || !strings.Contains(last.message, "spilled") {
+		t.Fatalf("unexpected drained send %+v", last)
+	}
+	if _, err := os.Stat(spilled[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected the spill file removed, stat err=%v", err)
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !ev.SentSyslog || ev.SentAt == nil {
+		t.Fatalf("expected the event marked sent by the drain, got %+v", ev)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected the source file deleted once sent, stat err=%v", err)
+	}
+	audit, err := os.ReadFile(auditFilePath(filepath.Join(tmp, "audit"), time.Now(), false))
+	if err != nil || !strings.Contains(string(audit), "spilled") {
+		t.Fatalf("expected the drained line audited, got %q err=%v", audit, err)
+	}
+}
+
+func TestRunner_SpillDrainStopsOnFailureAndDropsStale(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SpillDir:     spillDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	if err := runner.ensureDBForNow(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	events := []SpoolEvent{{SourcePath: "x", SentSyslog: true}, {SourcePath: "y"}, {SourcePath: "z"}}
+	if err := runner.db.Create(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(spillDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range events {
+		if err := os.WriteFile(filepath.Join(spillDir, spillFileName(runner.dbKey, ev.ID)), []byte(ev.SourcePath+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sender := &mockLineSender{}
+	sender.FailNext(1)
+	runner.syslog = sender
+
+	stats := &runStats{}
+	if err := runner.drainSpill(time.Now().Add(time.Minute), stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.EventsSentErr != 1 || runner.runErrs.Load() != 1 {
+		t.Fatalf("expected the failed drain send counted, got sent_err=%d run_errs=%d", stats.EventsSentErr, runner.runErrs.Load())
+	}
+	if calls := sender.Calls(); len(calls) != 1 || !strings.Contains(calls[0].structuredData, `filename="y"`) {
+		t.Fatalf("expected the stale file skipped and the drain stopped at y, got %+v", calls)
+	}
+	left, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog"))
+	if len(left) != 2 {
+		t.Fatalf("expected the stale file removed and two left, got %v", left)
+	}
+}
+
+func TestWriteSpillFile_LeavesNoTempFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spill")
+	name := spillFileName("202602", 7)
+	if err := writeSpillFile(dir, name, []byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != name {
+		t.Fatalf("expected only %q in the spill dir, got %v", name, entries)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != "line\n" {
+		t.Fatalf("unexpected spill file %q err=%v", b, err)
+	}
+}
+
+func TestRunner_SpillWritesShareTheOpenFileBudget(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		SpillDir:     spillDir,
+		MaxOpenFiles: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	runner.syslog = &mockLineSender{}
+
+	// An input read holds the only slot: the spill write waits for it.
+	runner.budget.acquire()
+	done := make(chan struct{})
+	go func() {
+		runner.spill([]SpoolEvent{{ID: 1, SourcePath: "x"}})
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog")); len(spilled) != 0 {
+		t.Fatalf("expected the spill write to wait for the budget, got %v", spilled)
+	}
+	runner.budget.release()
+	<-done
+	if spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog")); len(spilled) != 1 {
+		t.Fatalf("expected one spill file once the slot was free, got %v", spilled)
+	}
+}
+
+func TestRunner_SpillDrainSendsOnlyToDestinationsNotReached(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), mustBuildFixtureJSON(t, "detail split ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SpillDir:     spillDir,
+		SyslogDestinations: []SyslogDestination{
+			{Addr: "127.0.0.1:2"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	primary := &mockLineSender{}
+	dr := &mockSyslogSender{}
+	runner.syslog = primary
+	runner.destinations[0].sender = dr
+	// The secondary fails the new send and the in-run resend; the primary gets the event.
+	dr.FailNext(2)
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog")); len(spilled) != 1 {
+		t.Fatalf("expected one spill file, got %v", spilled)
+	}
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(primary.Calls()); n != 1 {
+		t.Fatalf("expected no duplicate on the primary, got %d sends", n)
+	}
+	if n := len(dr.Calls()); n != 3 {
+		t.Fatalf("expected the drain to send to the secondary, got %d sends", n)
+	}
+	var ev SpoolEvent
+	if err := runner.db.First(&ev).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !ev.SentSyslog || len(parseSentTo(ev.SentTo)) != 2 {
+		t.Fatalf("expected the event sent to both destinations, got %+v", ev)
+	}
+	if spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog")); len(spilled) != 0 {
+		t.Fatalf("expected the spill file removed, got %v", spilled)
+	}
+}
+
+func TestRunner_SpillDrainHeldByQuietHours(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	if err := os.WriteFile(filepath.Join(tmp, "a.warn"), []byte(`{"detail":"pump slow ZBBB","status":"1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		Inputs:       []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		HashHexLen:   24,
+		SpillDir:     spillDir,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &mockLineSender{}
+	sender.FailNext(2)
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	runner.Close()
+
+	// Quiet all day from now on: the drain holds the spilled event instead of sending it.
+	cfg.QuietHours = []QuietHours{{Levels: []string{"warning"}, Start: "00:00", End: "00:00"}}
+	runner, err = NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender = &mockLineSender{}
+	runner.syslog = sender
+	stats := &runStats{}
+	if err := runner.drainSpill(time.Now().Add(time.Minute), stats); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Calls()); n != 0 {
+		t.Fatalf("expected no send in the quiet window, got %d", n)
+	}
+	if stats.EventsSuppressed != 1 {
+		t.Fatalf("expected the event counted suppressed, got %d", stats.EventsSuppressed)
+	}
+	if spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog")); len(spilled) != 0 {
+		t.Fatalf("expected the spill file of the suppressed event removed, got %v", spilled)
+	}
+}
+
+func TestRunner_SpillRoutedEventUsesItsMonthDB(t *testing.T) {
+	tmp := t.TempDir()
+	spillDir := filepath.Join(tmp, "spill")
+	if err := os.WriteFile(filepath.Join(tmp, "jan.warn"), []byte(`{"detail":"disk full ZBBB","status":"1","time":"2025-01-15 12:00:00"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:      tmp,
+		DBPrefix:      "spooler_",
+		DBByEventTime: true,
+		JobLabel:      "mhdbs",
+		Inputs:        []InputSpec{{Glob: filepath.Join(tmp, "*.warn")}},
+		SyslogAddr:    "127.0.0.1:1",
+		ServiceLabel:  "alerts",
+		HashHexLen:    24,
+		SpillDir:      spillDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockLineSender{}
+	sender.FailNext(2)
+	runner.syslog = sender
+
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	spilled, _ := filepath.Glob(filepath.Join(spillDir, "*.syslog"))
+	if len(spilled) != 1 {
+		t.Fatalf("expected the routed event spilled, got %v", spilled)
+	}
+	key, id, ok := parseSpillFileName(filepath.Base(spilled[0]))
+	if !ok || key != "202501" {
+		t.Fatalf("expected the spill file keyed by the event's month, got %q", spilled[0])
+	}
+	month, _ := parseMonthlyDBKey("spooler_202501.db", "spooler_")
+	db, err := runner.dbForMonth(month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev SpoolEvent
+	if err := db.Where("id = ?", id).First(&ev).Error; err != nil || ev.SourcePath != filepath.Join(tmp, "jan.warn") {
+		t.Fatalf("expected the spill file to name the routed event, got %+v err=%v", ev, err)
+	}
+}
@@ -10,9 +10,16 @@ func OpenDB(path string) (*gorm.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := db.AutoMigrate(&ProcessedFile{}, &SpoolEvent{}); err != nil {
+	if err := db.AutoMigrate(&ProcessedFile{}, &SpoolEvent{}, &IngestOffset{}, &ReplayLog{}); err != nil {
 		return nil, err
 	}
+	// SQLite allows one writer; a single connection serializes concurrent ingest workers
+	// instead of failing them with SQLITE_BUSY.
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
 	return db, nil
 }
 
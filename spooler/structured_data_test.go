@@ -1,8 +1,12 @@
 package spooler
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildStructuredData_DefaultSDIDWhenEmpty(t *testing.T) {
@@ -40,3 +44,144 @@ func TestBuildStructuredData_SkipsEmptyAndSortsExtraKeys(t *testing.T) {
 		t.Fatalf("expected extra keys sorted (aaa before zzz), got: %q", sd)
 	}
 }
+
+func TestRunner_StructuredDataCustomOrder(t *testing.T) {
+	r := &Runner{cfg: RunnerConfig{SDOrder: []string{"hash", "job", "alert_type"}}}
+	sd := r.structuredData(map[string]string{
+		"job":        "mhdbs",
+		"service":    "alerts",
+		"alert_type": "general",
+		"hash":       "h",
+		"cccc":       "ZBBB",
+	})
+	want := `[cndp hash="h" job="mhdbs" alert_type="general" cccc="ZBBB" service="alerts"]`
+	if sd != want {
+		t.Fatalf("expected %q, got %q", want, sd)
+	}
+}
+
+func TestBuildStructuredData_SanitizesParamNames(t *testing.T) {
+	sd := buildStructuredData("cndp", map[string]string{
+		"job":         "mhdbs",
+		`bad "key]=x`: "v",
+		"a_very_long_event_field_name_over_32_bytes": "w",
+	})
+	want := `[cndp job="mhdbs" a_very_long_event_field_name_ove="w" bad__key__x="v"]`
+	if sd != want {
+		t.Fatalf("expected %q, got %q", want, sd)
+	}
+	element := regexp.MustCompile(`^\[cndp( [!#-<>-\\^-~]{1,32}="(\\.|[^"\\\]])*")*\]$`)
+	if !element.MatchString(sd) {
+		t.Fatalf("structured data is not well-formed: %q", sd)
+	}
+}
+
+func TestRunner_SDGroupsEmitsSeveralElements(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		FixedLabels:  map[string]string{"env": "prod", "site": "sh"},
+		SDGroups:     map[string][]string{"meta@32473": {"env", "site"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	runner.syslog = sender
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls()) != 1 {
+		t.Fatalf("expected 1 send, got %d", len(sender.Calls()))
+	}
+
+	sd := sender.Calls()[0].structuredData
+	element := `\[[!#-<>-\\^-~]{1,32}( [!#-<>-\\^-~]{1,32}="(\\.|[^"\\\]])*")*\]`
+	if !regexp.MustCompile(`^` + element + element + `$`).MatchString(sd) {
+		t.Fatalf("expected two well-formed SD elements, got %q", sd)
+	}
+	cndp, meta, _ := strings.Cut(sd, "][")
+	for _, want := range []string{`[cndp `, `job="mhdbs"`, `service="alerts"`, `hash="`} {
+		if !strings.Contains(cndp, want) {
+			t.Fatalf("expected %s in the cndp element, got %q", want, cndp)
+		}
+	}
+	if strings.Contains(cndp, "env=") || strings.Contains(cndp, "site=") {
+		t.Fatalf("expected grouped labels moved out of cndp, got %q", cndp)
+	}
+	if want := `meta@32473 env="prod" site="sh"]`; meta != want {
+		t.Fatalf("expected meta element %q, got %q", want, meta)
+	}
+
+	id, params := parseStructuredData(sd)
+	if id != "cndp" || params[len(params)-1] != [2]string{"site", "sh"} {
+		t.Fatalf("expected params of both elements parsed, got %s %v", id, params)
+	}
+}
+
+func TestNewRunner_InvalidSDGroupID(t *testing.T) {
+	tmp := t.TempDir()
+	_, err := NewRunner(RunnerConfig{
+		DBFolder:   tmp,
+		JobLabel:   "mhdbs",
+		InputGlobs: []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr: "127.0.0.1:1",
+		SDGroups:   map[string][]string{"bad id": {"env"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid sd_groups SD-ID") {
+		t.Fatalf("expected invalid SD-ID error, got %v", err)
+	}
+}
+
+func TestRunner_SDIDReplacesCndp(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "one.warn"), mustBuildFixtureJSON(t, "detail ZBBB"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   "127.0.0.1:1",
+		ServiceLabel: "alerts",
+		DeadmanToken: "spooler-run",
+		SDID:         "acme@32473",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	sender := &mockSyslogSender{}
+	sender.FailNext(1)
+	runner.syslog = sender
+
+	// New event (fails), deadman, then resend and deadman, then replay and deadman.
+	for i := 0; i < 2; i++ {
+		if err := runner.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner.cfg.ReplayFrom = time.Now().Add(-10 * time.Minute).UTC()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	calls := sender.Calls()
+	if len(calls) != 6 {
+		t.Fatalf("expected 6 sends, got %d", len(calls))
+	}
+	for _, c := range calls {
+		if !strings.HasPrefix(c.structuredData, "[acme@32473 ") {
+			t.Fatalf("expected structured data to begin with [acme@32473, got %q", c.structuredData)
+		}
+	}
+}
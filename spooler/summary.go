@@ -0,0 +1,150 @@
+package spooler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SummaryCount is one group of a summary aggregation.
+type SummaryCount struct {
+	Value string
+	Count int64
+}
+
+// Summary aggregates archived events over [From, To) by archived_at.
+type Summary struct {
+	From         time.Time
+	To           time.Time
+	ByAlertType  []SummaryCount
+	ByAlertLevel []SummaryCount
+	ByCCCC       []SummaryCount
+	Sent         int64
+	Pending      int64
+}
+
+// Summarize queries the monthly DBs (or the legacy single DB when folder is empty)
+// read-only and groups events archived in the window by alert_type, alert_level and cccc.
+// Every monthly DB is queried: with DBByEventTime a DB's month is its events' event time,
+// not when they were archived.
+func Summarize(folder string, prefix string, dbPath string, from time.Time, to time.Time) (*Summary, error) {
+	var paths []string
+	if strings.TrimSpace(folder) == "" {
+		if strings.TrimSpace(dbPath) == "" {
+			return nil, fmt.Errorf("DBPath or DBFolder is required")
+		}
+		paths = []string{dbPath}
+	} else {
+		if strings.TrimSpace(prefix) == "" {
+			prefix = "alerts_"
+		}
+		var err error
+		paths, err = listMonthlyDBs(folder, prefix, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byType := map[string]int64{}
+	byLevel := map[string]int64{}
+	byCCCC := map[string]int64{}
+	s := &Summary{From: from.UTC(), To: to.UTC()}
+	for _, p := range paths {
+		if err := summarizeDB(p, s, byType, byLevel, byCCCC); err != nil {
+			return nil, fmt.Errorf("summarize %s: %w", p, err)
+		}
+	}
+	s.ByAlertType = sortedCounts(byType)
+	s.ByAlertLevel = sortedCounts(byLevel)
+	s.ByCCCC = sortedCounts(byCCCC)
+	return s, nil
+}
+
+func summarizeDB(path string, s *Summary, byType, byLevel, byCCCC map[string]int64) error {
+	db, err := OpenQueryDB(path)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	window := func() *gorm.DB {
+		return db.Model(&SpoolEvent{}).Where("archived_at >= ? AND archived_at < ?", s.From, s.To)
+	}
+	groups := []struct {
+		column string
+		out    map[string]int64
+	}{
+		{"alert_type", byType},
+		{"alert_level", byLevel},
+		{"cccc", byCCCC},
+	}
+	for _, g := range groups {
+		var rows []SummaryCount
+		if err := window().
+			Select(g.column + " AS value, COUNT(*) AS count").
+			Group(g.column).
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			g.out[row.Value] += row.Count
+		}
+	}
+
+	var sent, pending int64
+	if err := window().Where("sent_syslog = ?", true).Count(&sent).Error; err != nil {
+		return err
+	}
+	if err := window().Where("sent_syslog = ?", false).Count(&pending).Error; err != nil {
+		return err
+	}
+	s.Sent += sent
+	s.Pending += pending
+	return nil
+}
+
+func sortedCounts(m map[string]int64) []SummaryCount {
+	out := make([]SummaryCount, 0, len(m))
+	for v, n := range m {
+		out = append(out, SummaryCount{Value: v, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// WriteText prints the summary as a plain-text table.
+func (s *Summary) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "window: %s .. %s\n", s.From.Format(time.RFC3339), s.To.Format(time.RFC3339))
+	fmt.Fprintf(w, "total: %d sent: %d pending: %d\n", s.Sent+s.Pending, s.Sent, s.Pending)
+	sections := []struct {
+		name   string
+		counts []SummaryCount
+	}{
+		{"alert_type", s.ByAlertType},
+		{"alert_level", s.ByAlertLevel},
+		{"cccc", s.ByCCCC},
+	}
+	for _, sec := range sections {
+		fmt.Fprintf(w, "\n%s:\n", sec.name)
+		for _, c := range sec.counts {
+			v := c.Value
+			if v == "" {
+				v = "-"
+			}
+			fmt.Fprintf(w, "  %-16s %d\n", v, c.Count)
+		}
+	}
+}
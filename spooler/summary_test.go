@@ -0,0 +1,69 @@
+package spooler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummarize_GroupsByTypeLevelCCCC(t *testing.T) {
+	tmp := t.TempDir()
+	now := time.Now().UTC()
+
+	db, err := OpenDB(filepath.Join(tmp, "spooler_"+monthKey(now)+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	seed := []SpoolEvent{
+		{AlertType: "dev", AlertLevel: "critical", CCCC: "ZBBB", SentSyslog: true, ArchivedAt: now},
+		{AlertType: "dev", AlertLevel: "warning", CCCC: "ZBBB", SentSyslog: true, ArchivedAt: now},
+		{AlertType: "iec", AlertLevel: "critical", CCCC: "none", SentSyslog: false, ArchivedAt: now},
+		// Outside the window.
+		{AlertType: "business", AlertLevel: "warning", CCCC: "ZGGG", SentSyslog: true, ArchivedAt: now.Add(-48 * time.Hour)},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Archived now into an older month's DB (DBByEventTime).
+	old, err := OpenDB(filepath.Join(tmp, "spooler_"+monthKey(now.AddDate(-1, 0, 0))+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSQL, err := old.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldSQL.Close()
+	if err := old.Create(&SpoolEvent{AlertType: "dev", AlertLevel: "critical", CCCC: "ZBBB", SentSyslog: true, ArchivedAt: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Summarize(tmp, "spooler_", "", now.Add(-time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sent != 3 || s.Pending != 1 {
+		t.Fatalf("expected sent=3 pending=1, got sent=%d pending=%d", s.Sent, s.Pending)
+	}
+	assertCounts(t, "alert_type", s.ByAlertType, map[string]int64{"dev": 3, "iec": 1})
+	assertCounts(t, "alert_level", s.ByAlertLevel, map[string]int64{"critical": 3, "warning": 1})
+	assertCounts(t, "cccc", s.ByCCCC, map[string]int64{"ZBBB": 3, "none": 1})
+}
+
+func assertCounts(t *testing.T, name string, got []SummaryCount, want map[string]int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: expected %d groups, got %+v", name, len(want), got)
+	}
+	for _, c := range got {
+		if want[c.Value] != c.Count {
+			t.Fatalf("%s: expected %s=%d, got %d", name, c.Value, want[c.Value], c.Count)
+		}
+	}
+}
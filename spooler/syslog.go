@@ -2,82 +2,516 @@ package spooler
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// SyslogSender sends one line. msgID is the RFC5424 MSGID, the line's category (see
+// msgIDAlert etc.); PROCID is the process id.
 type SyslogSender interface {
-	SendRFC5424Timeout(appName string, structuredData string, message string, timeout time.Duration) error
+	SendRFC5424Timeout(appName string, msgID string, structuredData string, message string, timeout time.Duration) error
+}
+
+// SyslogTimestampSender is implemented by senders that can stamp the RFC5424 TIMESTAMP
+// with a given time instead of the send time.
+type SyslogTimestampSender interface {
+	SendRFC5424AtTimeout(ts time.Time, appName string, msgID string, structuredData string, message string, timeout time.Duration) error
+}
+
+// SyslogLineSender is implemented by senders that can format a line up front and send it
+// later unchanged, as SpillDir needs.
+type SyslogLineSender interface {
+	FormatLine(ts time.Time, appName string, msgID string, structuredData string, message string) string
+	SendLineTimeout(line string, timeout time.Duration) error
+}
+
+// RFC5424 MSGIDs by line category.
+const (
+	msgIDAlert     = "alert"
+	msgIDReplay    = "replay"
+	msgIDDeadman   = "deadman"
+	msgIDLifecycle = "lifecycle"
+)
+
+// syslogProcID is the RFC5424 PROCID: the process id, so a run's lines can be told apart
+// from another instance's.
+var syslogProcID = strconv.Itoa(os.Getpid())
+
+// SyslogSession is implemented by senders that can keep one connection open across many
+// sends: between OpenSession and CloseSession, sends reuse it instead of dialing per line.
+// The runner opens a session per run.
+type SyslogSession interface {
+	OpenSession()
+	CloseSession() error
+}
+
+// SyslogProber is implemented by senders that can check the receiver is reachable.
+type SyslogProber interface {
+	Probe(timeout time.Duration) error
+}
+
+// SyslogOptions tunes the connection used for each send.
+type SyslogOptions struct {
+	// Network is "tcp" (default), "udp", "unix" or "unixgram"; for the unix networks the
+	// address is the socket path. Stream networks send newline-terminated lines, datagram
+	// networks one message per datagram without the trailing newline.
+	Network string
+	// NoDelay disables Nagle's algorithm (TCP_NODELAY); syslog lines are small and latency-sensitive.
+	NoDelay bool
+	// KeepAlive enables TCP keep-alive with this period when > 0.
+	KeepAlive time.Duration
+	// Limiter bounds concurrent connections; share one across clients to cap all destinations. Nil means unlimited.
+	Limiter *ConnLimiter
+	// Hostname is the RFC5424 HOSTNAME; empty means os.Hostname().
+	Hostname string
+	// Format is the line format: "rfc5424" (default) or "rfc3164" (BSD, structured data
+	// folded into the message as key=value pairs).
+	Format string
+	// Framing is the stream framing: "lf" (default, newline-terminated lines) or "octet"
+	// (RFC6587 octet counting: "<len> <line>" without the newline). Datagrams are unframed.
+	Framing string
+	// Facility (0-23) and Severity (0-7) make up the PRI, facility*8 + severity; nil means
+	// local0 (16) and info (6), i.e. PRI 134. See ValidateSyslogPriority.
+	Facility *int
+	Severity *int
+	// TLSConfig, when set, wraps tcp connections in TLS; the handshake shares the send
+	// timeout with the dial (see SyslogTLSConfig).
+	TLSConfig *tls.Config
+}
+
+// ErrConnLimit is returned (wrapped) by a send that timed out waiting for a ConnLimiter
+// slot: the receiver was not tried.
+var ErrConnLimit = errors.New("syslog connection limit reached")
+
+// ConnLimiter is a counting semaphore bounding concurrently open syslog connections.
+type ConnLimiter struct {
+	slots chan struct{}
+}
+
+// NewConnLimiter returns a limiter allowing max open connections, or nil (unlimited) when max <= 0.
+func NewConnLimiter(max int) *ConnLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ConnLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire waits for a free slot, giving up after timeout (> 0).
+func (l *ConnLimiter) acquire(timeout time.Duration) error {
+	if l == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		l.slots <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w (%d)", ErrConnLimit, cap(l.slots))
+	}
+}
+
+func (l *ConnLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// limitedConn releases its limiter slot once when closed.
+type limitedConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.limiter.release)
+	return err
+}
+
+// DefaultSyslogOptions returns the options used by NewSyslogClient.
+func DefaultSyslogOptions() SyslogOptions {
+	return SyslogOptions{NoDelay: true}
+}
+
+// tcpConnOptions is the subset of *net.TCPConn used to apply SyslogOptions.
+type tcpConnOptions interface {
+	SetNoDelay(noDelay bool) error
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
 }
 
 type SyslogClient struct {
 	addr string
+	opts SyslogOptions
+	// dial is net.DialTimeout; overridable in tests. timeout <= 0 means no timeout.
+	dial func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+	// mu guards the session state. A send takes the session's conn out while it writes
+	// (dialing outside mu when there is none) and puts it back after, so neither a dial
+	// nor another send's write holds up the lock.
+	mu        sync.Mutex
+	inSession bool
+	// conn is the session's idle connection, dialed on first use and dropped after a
+	// failed write; idleSince is when it was last put back.
+	conn      net.Conn
+	idleSince time.Time
 }
 
+// sessionProbeIdle is how long a session conn may sit idle before it is probed for a
+// peer close (see connClosed) on reuse; overridable in tests.
+var sessionProbeIdle = time.Second
+
 func NewSyslogClient(addr string) *SyslogClient {
-	return &SyslogClient{addr: addr}
+	return NewSyslogClientWithOptions(addr, DefaultSyslogOptions())
+}
+
+func NewSyslogClientWithOptions(addr string, opts SyslogOptions) *SyslogClient {
+	return &SyslogClient{addr: addr, opts: opts, dial: net.DialTimeout}
+}
+
+// dialConn dials the receiver and applies SyslogOptions when the connection supports them.
+// With a Limiter, the returned conn holds a slot until it is closed.
+func (c *SyslogClient) dialConn(timeout time.Duration) (net.Conn, error) {
+	if err := c.opts.Limiter.acquire(timeout); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, err := c.dialOptions(timeout)
+	if err == nil && c.opts.TLSConfig != nil {
+		// The handshake gets what the dial left of the timeout.
+		left := timeout
+		if timeout > 0 {
+			left = max(timeout-time.Since(start), time.Millisecond)
+		}
+		conn, err = tlsHandshake(conn, c.addr, c.opts.TLSConfig, left)
+	}
+	if err != nil {
+		c.opts.Limiter.release()
+		return nil, err
+	}
+	if c.opts.Limiter == nil {
+		return conn, nil
+	}
+	return &limitedConn{Conn: conn, limiter: c.opts.Limiter}, nil
+}
+
+func (c *SyslogClient) dialOptions(timeout time.Duration) (net.Conn, error) {
+	dial := c.dial
+	if dial == nil {
+		dial = net.DialTimeout
+	}
+	conn, err := dial(c.network(), c.addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	tc, ok := conn.(tcpConnOptions)
+	if !ok {
+		return conn, nil
+	}
+	if err := tc.SetNoDelay(c.opts.NoDelay); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("set nodelay: %w", err)
+	}
+	if c.opts.KeepAlive > 0 {
+		if err := tc.SetKeepAlive(true); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("set keepalive: %w", err)
+		}
+		if err := tc.SetKeepAlivePeriod(c.opts.KeepAlive); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("set keepalive period: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *SyslogClient) network() string {
+	if c.opts.Network == "" {
+		return "tcp"
+	}
+	return c.opts.Network
+}
+
+// datagram reports whether the network sends one message per datagram.
+func (c *SyslogClient) datagram() bool {
+	switch c.network() {
+	case "udp", "unixgram":
+		return true
+	}
+	return false
 }
 
-func (c *SyslogClient) SendRFC5424(appName string, structuredData string, message string) error {
-	conn, err := net.Dial("tcp", c.addr)
+// Probe dials the receiver and closes the connection without sending anything.
+func (c *SyslogClient) Probe(timeout time.Duration) error {
+	conn, err := c.dialConn(timeout)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	return conn.Close()
+}
 
-	host, _ := os.Hostname()
-	if host == "" {
-		host = "-"
+func (c *SyslogClient) SendRFC5424(appName string, msgID string, structuredData string, message string) error {
+	return c.SendRFC5424AtTimeout(time.Now(), appName, msgID, structuredData, message, 0)
+}
+
+func (c *SyslogClient) SendRFC5424Timeout(appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
+	return c.SendRFC5424AtTimeout(time.Now(), appName, msgID, structuredData, message, timeout)
+}
+
+// OpenSession makes later sends share one connection until CloseSession.
+func (c *SyslogClient) OpenSession() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inSession = true
+}
+
+// CloseSession closes the session's connection, if any; sends dial per line again.
+func (c *SyslogClient) CloseSession() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inSession = false
+	if c.conn == nil {
+		return nil
 	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
 
-	pri := 134 // local0.info
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
-	if appName == "" {
-		appName = "alert-spooler"
+// SendRFC5424AtTimeout sends a line whose header TIMESTAMP is ts. timeout <= 0 means no timeout.
+func (c *SyslogClient) SendRFC5424AtTimeout(ts time.Time, appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
+	return c.SendLineTimeout(c.FormatLine(ts, appName, msgID, structuredData, message), timeout)
+}
+
+// FormatLine formats a line as SendRFC5424AtTimeout sends it, newline included.
+func (c *SyslogClient) FormatLine(ts time.Time, appName string, msgID string, structuredData string, message string) string {
+	return formatSyslogLine(c.opts.Format, syslogPriority(c.opts.Facility, c.opts.Severity), ts, headerHostname(c.opts.Hostname), appName, msgID, structuredData, message)
+}
+
+// SendLineTimeout sends a line built by FormatLine, framed for the connection.
+func (c *SyslogClient) SendLineTimeout(line string, timeout time.Duration) error {
+	c.mu.Lock()
+	inSession, conn, idleSince := c.inSession, c.conn, c.idleSince
+	c.conn = nil
+	c.mu.Unlock()
+
+	if !inSession {
+		conn, err := c.dialConn(timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return c.writeLine(conn, line, timeout)
+	}
+	if conn != nil && !c.datagram() && time.Since(idleSince) >= sessionProbeIdle && connClosed(conn) {
+		// The receiver dropped the idle conn (e.g. its idle timeout): a write would
+		// still succeed once and the line be lost, so redial instead.
+		conn.Close()
+		conn = nil
 	}
+	if conn == nil {
+		var err error
+		if conn, err = c.dialConn(timeout); err != nil {
+			return err
+		}
+	}
+	if err := c.writeLine(conn, line, timeout); err != nil {
+		// The next send redials; the failed event stays pending.
+		conn.Close()
+		return err
+	}
+	c.putSessionConn(conn)
+	return nil
+}
+
+// putSessionConn puts conn back as the session's idle conn, or closes it when the session
+// ended meanwhile or a concurrent send already put one back.
+func (c *SyslogClient) putSessionConn(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.inSession || c.conn != nil {
+		conn.Close()
+		return
+	}
+	c.conn, c.idleSince = conn, time.Now()
+}
+
+// connClosed reports whether the peer closed conn, by a read with a short deadline: a
+// syslog receiver never writes back, so anything but a timeout means the conn is gone.
+func connClosed(conn net.Conn) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	var ne net.Error
+	return !(errors.As(err, &ne) && ne.Timeout())
+}
 
-	line := fmt.Sprintf("<%d>1 %s %s %s - - %s %s\n", pri, ts, sanitizeSyslogToken(host), sanitizeSyslogToken(appName), structuredData, strings.TrimSpace(message))
+// writeLine writes one formatted line to conn within timeout (<= 0 means none).
+func (c *SyslogClient) writeLine(conn net.Conn, line string, timeout time.Duration) error {
+	// Always (re)set: a session conn keeps the previous send's deadline otherwise.
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = conn.SetDeadline(deadline)
+	if c.datagram() {
+		_, err := conn.Write([]byte(strings.TrimSuffix(line, "\n")))
+		return err
+	}
 
 	w := bufio.NewWriter(conn)
+	if c.opts.Framing == "octet" {
+		msg := strings.TrimSuffix(line, "\n")
+		line = strconv.Itoa(len(msg)) + " " + msg
+	}
 	if _, err := w.WriteString(line); err != nil {
 		return err
 	}
 	return w.Flush()
 }
 
-func (c *SyslogClient) SendRFC5424Timeout(appName string, structuredData string, message string, timeout time.Duration) error {
-	if timeout <= 0 {
-		return c.SendRFC5424(appName, structuredData, message)
+// Default PRI parts: local0.info, PRI 134.
+const (
+	defaultSyslogFacility = 16
+	defaultSyslogSeverity = 6
+)
+
+// ValidateSyslogPriority checks a configured facility (0-23) and severity (0-7); nil
+// values use the defaults.
+func ValidateSyslogPriority(facility *int, severity *int) error {
+	if facility != nil && (*facility < 0 || *facility > 23) {
+		return fmt.Errorf("syslog facility %d out of range (0-23)", *facility)
 	}
+	if severity != nil && (*severity < 0 || *severity > 7) {
+		return fmt.Errorf("syslog severity %d out of range (0-7)", *severity)
+	}
+	return nil
+}
 
-	conn, err := net.DialTimeout("tcp", c.addr, timeout)
-	if err != nil {
-		return err
+// syslogPriority is the PRI for facility and severity (nil: the defaults).
+func syslogPriority(facility *int, severity *int) int {
+	f, s := defaultSyslogFacility, defaultSyslogSeverity
+	if facility != nil {
+		f = *facility
+	}
+	if severity != nil {
+		s = *severity
+	}
+	return f*8 + s
+}
+
+// formatSyslogLine builds a line with PRI pri in format ("rfc3164", otherwise RFC5424),
+// PROCID syslogProcID.
+func formatSyslogLine(format string, pri int, ts time.Time, host string, appName string, msgID string, structuredData string, message string) string {
+	if format == "rfc3164" {
+		return FormatRFC3164(pri, ts, host, appName, syslogProcID, structuredData, message)
 	}
-	defer conn.Close()
-	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return FormatRFC5424(pri, ts, host, appName, syslogProcID, msgID, structuredData, message)
+}
 
-	host, _ := os.Hostname()
+// FormatRFC5424 builds the newline-terminated line SyslogClient sends. Empty procID or
+// msgID is written as the nil value "-"; MSGID is cut to its 32-character limit.
+func FormatRFC5424(pri int, ts time.Time, host string, appName string, procID string, msgID string, structuredData string, message string) string {
 	if host == "" {
 		host = "-"
 	}
+	if appName == "" {
+		appName = "alert-spooler"
+	}
+	// sanitizeSyslogToken writes an empty value as "-".
+	procID, msgID = sanitizeSyslogToken(procID), sanitizeSyslogToken(msgID)
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s\n", pri, ts.UTC().Format(time.RFC3339Nano), sanitizeSyslogToken(host), sanitizeSyslogToken(appName), procID, msgID, structuredData, strings.TrimSpace(message))
+}
 
-	pri := 134 // local0.info
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
+// FormatRFC3164 builds a BSD syslog line, "<PRI>Mmm dd hh:mm:ss host tag[procID]: message",
+// for receivers without RFC5424 support. The timestamp is local time (seconds, no year) and
+// the tag is cut to 32 characters, without "[procID]" when procID is empty; BSD syslog has
+// no MSGID. The structured-data params are folded into the message as key=value pairs
+// ahead of it, values quoted when they contain spaces, quotes or '='.
+func FormatRFC3164(pri int, ts time.Time, host string, appName string, procID string, structuredData string, message string) string {
+	if host == "" {
+		host = "-"
+	}
 	if appName == "" {
 		appName = "alert-spooler"
 	}
+	tag := sanitizeSyslogToken(appName)
+	if len(tag) > 32 {
+		tag = tag[:32]
+	}
+	// An empty procID drops the brackets rather than writing RFC5424's nil "-".
+	if procID = strings.TrimSpace(procID); procID != "" {
+		tag += "[" + sanitizeSyslogToken(procID) + "]"
+	}
+	var b strings.Builder
+	_, params := parseStructuredData(structuredData)
+	for _, kv := range params {
+		v := kv[1]
+		if v == "" || strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(kv[0])
+		b.WriteString("=")
+		b.WriteString(v)
+		b.WriteString(" ")
+	}
+	b.WriteString(strings.TrimSpace(message))
+	return fmt.Sprintf("<%d>%s %s %s: %s\n", pri, ts.Local().Format(time.Stamp), sanitizeSyslogToken(host), tag, b.String())
+}
 
-	line := fmt.Sprintf("<%d>1 %s %s %s - - %s %s\n", pri, ts, sanitizeSyslogToken(host), sanitizeSyslogToken(appName), structuredData, strings.TrimSpace(message))
+// LineWriter is a SyslogSender that writes formatted lines to w instead of sending them (dry-run).
+type LineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// host overrides the HOSTNAME like SyslogOptions.Hostname.
+	host string
+	// format is the line format, like SyslogOptions.Format.
+	format string
+	// pri is the PRI, like SyslogOptions.Facility/Severity.
+	pri int
+}
 
-	w := bufio.NewWriter(conn)
-	if _, err := w.WriteString(line); err != nil {
-		return err
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: w, pri: syslogPriority(nil, nil)}
+}
+
+func (l *LineWriter) SendRFC5424Timeout(appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
+	return l.SendRFC5424AtTimeout(time.Now(), appName, msgID, structuredData, message, timeout)
+}
+
+func (l *LineWriter) SendRFC5424AtTimeout(ts time.Time, appName string, msgID string, structuredData string, message string, timeout time.Duration) error {
+	line := formatSyslogLine(l.format, l.pri, ts, headerHostname(l.host), appName, msgID, structuredData, message)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := io.WriteString(l.w, line)
+	return err
+}
+
+// headerHostname is override, or os.Hostname() when override is empty.
+func headerHostname(override string) string {
+	if strings.TrimSpace(override) != "" {
+		return override
 	}
-	return w.Flush()
+	host, _ := os.Hostname()
+	return host
 }
 
 func sanitizeSyslogToken(s string) string {
@@ -0,0 +1,460 @@
+package spooler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTCPConn records writes and TCP option calls without a real socket.
+type fakeTCPConn struct {
+	net.Conn
+	buf             bytes.Buffer
+	noDelay         *bool
+	keepAlive       bool
+	keepAlivePeriod time.Duration
+}
+
+func (f *fakeTCPConn) Write(b []byte) (int, error)       { return f.buf.Write(b) }
+func (f *fakeTCPConn) Close() error                      { return nil }
+func (f *fakeTCPConn) SetDeadline(t time.Time) error     { return nil }
+func (f *fakeTCPConn) SetNoDelay(noDelay bool) error     { f.noDelay = &noDelay; return nil }
+func (f *fakeTCPConn) SetKeepAlive(keepalive bool) error { f.keepAlive = keepalive; return nil }
+func (f *fakeTCPConn) SetKeepAlivePeriod(d time.Duration) error {
+	f.keepAlivePeriod = d
+	return nil
+}
+
+func TestSyslogClient_AppliesTCPOptions(t *testing.T) {
+	lineRe := regexp.MustCompile(`^<134>1 \S+ \S+ alert-spooler \d+ alert \[cndp job="j"\] hello\n$`)
+
+	cases := []struct {
+		name          string
+		opts          SyslogOptions
+		wantNoDelay   bool
+		wantKeepAlive time.Duration
+	}{
+		{name: "default", opts: DefaultSyslogOptions(), wantNoDelay: true},
+		{name: "keepalive", opts: SyslogOptions{NoDelay: false, KeepAlive: 30 * time.Second}, wantNoDelay: false, wantKeepAlive: 30 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := &fakeTCPConn{}
+			c := NewSyslogClientWithOptions("127.0.0.1:1", tc.opts)
+			c.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+				return conn, nil
+			}
+			if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if conn.noDelay == nil || *conn.noDelay != tc.wantNoDelay {
+				t.Fatalf("expected nodelay=%v, got %v", tc.wantNoDelay, conn.noDelay)
+			}
+			if conn.keepAlive != (tc.wantKeepAlive > 0) || conn.keepAlivePeriod != tc.wantKeepAlive {
+				t.Fatalf("expected keepalive period %s, got enabled=%v period=%s", tc.wantKeepAlive, conn.keepAlive, conn.keepAlivePeriod)
+			}
+			if !lineRe.MatchString(conn.buf.String()) {
+				t.Fatalf("unexpected syslog line: %q", conn.buf.String())
+			}
+		})
+	}
+}
+
+func TestSyslogClient_HostnameOverride(t *testing.T) {
+	conn := &fakeTCPConn{}
+	c := NewSyslogClientWithOptions("127.0.0.1:1", SyslogOptions{Hostname: "edge 01"})
+	c.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		return conn, nil
+	}
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<134>1 \S+ edge_01 alert-spooler \d+ alert `).MatchString(conn.buf.String()) {
+		t.Fatalf("expected the configured hostname in the header: %q", conn.buf.String())
+	}
+}
+
+func TestSyslogClient_FacilitySeverityPRI(t *testing.T) {
+	conn := &fakeTCPConn{}
+	facility, severity := 17, 4
+	c := NewSyslogClientWithOptions("127.0.0.1:1", SyslogOptions{Facility: &facility, Severity: &severity})
+	c.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		return conn, nil
+	}
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(conn.buf.String(), "<140>1 ") {
+		t.Fatalf("expected PRI 17*8+4=140, got %q", conn.buf.String())
+	}
+
+	for _, tc := range []struct{ facility, severity int }{{24, 6}, {-1, 6}, {16, 8}} {
+		if err := ValidateSyslogPriority(&tc.facility, &tc.severity); err == nil {
+			t.Fatalf("expected facility=%d severity=%d to be rejected", tc.facility, tc.severity)
+		}
+	}
+	if got := syslogPriority(nil, nil); got != 134 {
+		t.Fatalf("expected the default PRI 134, got %d", got)
+	}
+}
+
+func TestFormatRFC5424_ProcIDAndMsgID(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 7, 8, 9, 0, time.UTC)
+	got := FormatRFC5424(134, ts, "host1", "alert-spooler", "4242", "dead man", `[cndp]`, "hello")
+	if want := "<134>1 2024-03-05T07:08:09Z host1 alert-spooler 4242 dead_man [cndp] hello\n"; got != want {
+		t.Fatalf("unexpected header:\n got %q\nwant %q", got, want)
+	}
+	got = FormatRFC5424(134, ts, "host1", "alert-spooler", "", strings.Repeat("m", 40), `[cndp]`, "hello")
+	if want := "<134>1 2024-03-05T07:08:09Z host1 alert-spooler - " + strings.Repeat("m", 32) + " [cndp] hello\n"; got != want {
+		t.Fatalf("expected a nil PROCID and a MSGID cut to 32 chars:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatSyslogLine_EmptyProcID(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 7, 8, 9, 0, time.Local)
+	for _, procID := range []string{"", "  "} {
+		got := FormatRFC5424(134, ts, "host1", "alert-spooler", procID, "", `[cndp]`, "hello")
+		if want := "<134>1 " + ts.UTC().Format(time.RFC3339Nano) + " host1 alert-spooler - - [cndp] hello\n"; got != want {
+			t.Fatalf("expected nil PROCID and MSGID for procID %q:\n got %q\nwant %q", procID, got, want)
+		}
+		got = FormatRFC3164(134, ts, "host1", "alert-spooler", procID, `[cndp]`, "hello")
+		if want := "<134>Mar  5 07:08:09 host1 alert-spooler: hello\n"; got != want {
+			t.Fatalf("expected no brackets for procID %q:\n got %q\nwant %q", procID, got, want)
+		}
+	}
+}
+
+func TestFormatSyslogLine_HeaderShapes(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 7, 8, 9, 0, time.Local)
+	sd := `[cndp job="mhdbs" alert_type="general" detail="disk full"]`
+
+	rfc5424 := formatSyslogLine("rfc5424", 134, ts, "host1", "alert-spooler", msgIDAlert, sd, "hello")
+	if !regexp.MustCompile(`^<134>1 2024-03-0\dT\S+Z host1 alert-spooler ` + syslogProcID + ` alert \[cndp job="mhdbs" alert_type="general" detail="disk full"\] hello\n$`).MatchString(rfc5424) {
+		t.Fatalf("unexpected rfc5424 line: %q", rfc5424)
+	}
+
+	rfc3164 := formatSyslogLine("rfc3164", 134, ts, "host1", "alert-spooler", msgIDAlert, sd, "hello")
+	if want := "<134>Mar  5 07:08:09 host1 alert-spooler[" + syslogProcID + "]: job=mhdbs alert_type=general detail=\"disk full\" hello\n"; rfc3164 != want {
+		t.Fatalf("unexpected rfc3164 line:\n got %q\nwant %q", rfc3164, want)
+	}
+}
+
+func TestSyslogClient_OctetCountingFraming(t *testing.T) {
+	conn := &fakeTCPConn{}
+	c := NewSyslogClientWithOptions("127.0.0.1:1", SyslogOptions{Hostname: "h", Framing: "octet"})
+	c.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		return conn, nil
+	}
+	for _, msg := range []string{"hello", "wörld"} {
+		if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j" detail="ä b"]`, msg, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rest := conn.buf.String()
+	for i := 0; i < 2; i++ {
+		sp := strings.IndexByte(rest, ' ')
+		n, err := strconv.Atoi(rest[:sp])
+		if err != nil {
+			t.Fatalf("expected an octet count prefix, got %q", rest)
+		}
+		msg := rest[sp+1 : sp+1+n]
+		if !regexp.MustCompile(`^<134>1 \S+ h alert-spooler \d+ alert \[cndp job="j" detail="ä b"\] \S+$`).MatchString(msg) {
+			t.Fatalf("frame %d does not hold exactly one line: %q", i, msg)
+		}
+		rest = rest[sp+1+n:]
+	}
+	if rest != "" {
+		t.Fatalf("unexpected trailing bytes %q", rest)
+	}
+}
+
+// countingConn tracks how many connections are open at once across all destinations.
+type countingConn struct {
+	net.Conn
+	open *int32
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	return len(b), nil
+}
+func (c *countingConn) SetDeadline(t time.Time) error { return nil }
+func (c *countingConn) Close() error                  { atomic.AddInt32(c.open, -1); return nil }
+
+func TestSyslogClient_ConnLimiterCapsConcurrentConns(t *testing.T) {
+	const maxConns = 2
+	limiter := NewConnLimiter(maxConns)
+
+	var open, peak int32
+	dial := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		n := atomic.AddInt32(&open, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		return &countingConn{open: &open}, nil
+	}
+
+	var clients []*SyslogClient
+	for i := 0; i < 6; i++ {
+		c := NewSyslogClientWithOptions(fmt.Sprintf("dest-%d:1514", i), SyslogOptions{Limiter: limiter})
+		c.dial = dial
+		clients = append(clients, c)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 60)
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(c *SyslogClient) {
+			defer wg.Done()
+			errs <- c.SendRFC5424Timeout("alert-spooler", msgIDAlert, "[cndp]", "hello", 5*time.Second)
+		}(clients[i%len(clients)])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if peak > maxConns {
+		t.Fatalf("expected at most %d concurrent connections, saw %d", maxConns, peak)
+	}
+	if open != 0 {
+		t.Fatalf("expected all connections closed, %d still open", open)
+	}
+}
+
+func TestSyslogClient_UnixSocket(t *testing.T) {
+	lineRe := regexp.MustCompile(`^<134>1 \S+ \S+ alert-spooler \d+ alert \[cndp job="j"\] hello\n$`)
+	sock := filepath.Join(t.TempDir(), "syslog.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		got <- string(b)
+	}()
+
+	c := NewSyslogClientWithOptions(sock, SyslogOptions{Network: "unix"})
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-got; !lineRe.MatchString(line) {
+		t.Fatalf("unexpected syslog line: %q", line)
+	}
+}
+
+func TestSyslogClient_UnixgramSocketSendsOneDatagram(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "syslog.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer pc.Close()
+
+	c := NewSyslogClientWithOptions(sock, SyslogOptions{Network: "unixgram"})
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<134>1 \S+ \S+ alert-spooler \d+ alert \[cndp job="j"\] hello$`).Match(buf[:n]) {
+		t.Fatalf("unexpected datagram: %q", buf[:n])
+	}
+}
+
+// countingSyslogListener is a TCP syslog receiver counting accepted connections and
+// delivering received lines.
+func countingSyslogListener(t *testing.T) (string, *atomic.Int32, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	accepted := &atomic.Int32{}
+	lines := make(chan string, 64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					lines <- sc.Text()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), accepted, lines
+}
+
+func TestSyslogClient_SessionReusesOneConnection(t *testing.T) {
+	addr, accepted, lines := countingSyslogListener(t)
+
+	c := NewSyslogClient(addr)
+	c.OpenSession()
+	for i := 0; i < 5; i++ {
+		if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, fmt.Sprintf("hello %d", i), time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.CloseSession(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-lines:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected 5 lines, got %d", i)
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected one connection for the session, got %d", n)
+	}
+}
+
+func TestSyslogClient_SessionRedialsAfterPeerClose(t *testing.T) {
+	old := sessionProbeIdle
+	sessionProbeIdle = 0
+	defer func() { sessionProbeIdle = old }()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Like a receiver's idle timeout: one line, then the conn is closed.
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- line
+			conn.Close()
+		}
+	}()
+
+	c := NewSyslogClient(ln.Addr().String())
+	c.OpenSession()
+	defer c.CloseSession()
+	for i := 0; i < 2; i++ {
+		if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, fmt.Sprintf("hello %d", i), time.Second); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case line := <-lines:
+			if !strings.Contains(line, fmt.Sprintf("hello %d", i)) {
+				t.Fatalf("unexpected line %q", line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("line %d lost on a conn the receiver had closed", i)
+		}
+	}
+}
+
+func TestSyslogClient_SessionSendDoesNotWaitOnAnotherDial(t *testing.T) {
+	release := make(chan struct{})
+	var dials atomic.Int32
+	c := NewSyslogClient("receiver:514")
+	c.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		client, server := net.Pipe()
+		go io.Copy(io.Discard, server)
+		if dials.Add(1) == 1 {
+			<-release
+		}
+		return client, nil
+	}
+	c.OpenSession()
+	defer c.CloseSession()
+	defer close(release)
+
+	go c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "slow dial", time.Second)
+	for dials.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "second", 200*time.Millisecond)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a send not to wait on another send's dial")
+	}
+}
+
+func TestRunner_OneSyslogConnectionPerRun(t *testing.T) {
+	addr, accepted, lines := countingSyslogListener(t)
+	tmp := t.TempDir()
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(filepath.Join(tmp, fmt.Sprintf("f%d.warn", i)), mustBuildFixtureJSON(t, fmt.Sprintf("detail %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runner, err := NewRunner(RunnerConfig{
+		DBFolder:     tmp,
+		DBPrefix:     "spooler_",
+		JobLabel:     "mhdbs",
+		InputGlobs:   []string{filepath.Join(tmp, "*.warn")},
+		SyslogAddr:   addr,
+		DeadmanToken: "spooler-run",
+		Timeout:      5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	if err := runner.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	// 3 events plus the deadman.
+	for i := 0; i < 4; i++ {
+		select {
+		case <-lines:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected 4 lines, got %d", i)
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected the run to reuse one connection, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package spooler
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// selfSignedCert returns a server certificate for 127.0.0.1 and its PEM encoding.
+func selfSignedCert(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "alert-spooler-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestSyslogClient_TLSRoundTrip(t *testing.T) {
+	cert, certPEM := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		got <- line
+	}()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := SyslogTLSConfig{Enabled: true, CAFile: caFile}.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSyslogClientWithOptions(ln.Addr().String(), SyslogOptions{TLSConfig: tlsCfg})
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-got; !regexp.MustCompile(`^<134>1 \S+ \S+ alert-spooler \d+ alert \[cndp job="j"\] hello\n$`).MatchString(line) {
+		t.Fatalf("unexpected syslog line over tls: %q", line)
+	}
+}
+
+func TestSyslogClient_TLSHandshakeFailureIsSendError(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// The system pool does not trust the self-signed certificate.
+	tlsCfg, err := SyslogTLSConfig{Enabled: true}.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSyslogClientWithOptions(ln.Addr().String(), SyslogOptions{TLSConfig: tlsCfg})
+	if err := c.SendRFC5424Timeout("alert-spooler", msgIDAlert, `[cndp job="j"]`, "hello", 2*time.Second); err == nil {
+		t.Fatalf("expected an untrusted certificate to fail the send")
+	}
+}